@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
+)
+
+const (
+	// AppHomeMaxBlocks is the number of blocks a Home view can have
+	AppHomeMaxBlocks = 100
+	// AppHomeBridgedChannels is the number of bridged channels listed
+	AppHomeBridgedChannels = 10
+	// AppHomeBridgedPeriod is how long a channel is listed after its last bridged message
+	AppHomeBridgedPeriod = 24 * time.Hour
+)
+
+// AppHome publishes the App Home tab showing the Discord voice channels
+type AppHome struct {
+	discord      *discordgo.Session
+	slackHook    *slack_webhook.Handler
+	settings     *SettingsHandler
+	messageLinks *MessageLinks
+
+	// users who have opened the Home tab
+	users   map[string]bool
+	mu      sync.Mutex
+	refresh chan struct{}
+}
+
+func NewAppHome(discord *discordgo.Session, slackHook *slack_webhook.Handler, settings *SettingsHandler, messageLinks *MessageLinks) *AppHome {
+	var a = &AppHome{
+		discord:      discord,
+		slackHook:    slackHook,
+		settings:     settings,
+		messageLinks: messageLinks,
+		users:        map[string]bool{},
+		refresh:      make(chan struct{}, 1),
+	}
+	go a.run()
+	return a
+}
+
+// Open publishes the Home view to the user who opened it
+func (a *AppHome) Open(userID string) {
+	a.mu.Lock()
+	a.users[userID] = true
+	a.mu.Unlock()
+
+	err := a.slackHook.PublishView(userID, slack_webhook.HomeView(a.blocks()))
+	if err != nil {
+		log.Printf("PublishHome: %s\n", err.Error())
+	}
+}
+
+// Refresh requests to republish the Home view to all users.
+// It can be called while holding voiceChannels.Mutex.
+func (a *AppHome) Refresh() {
+	if a == nil {
+		return
+	}
+	select {
+	case a.refresh <- struct{}{}:
+	default:
+		// already requested
+	}
+}
+
+func (a *AppHome) run() {
+	for range a.refresh {
+		var view = slack_webhook.HomeView(a.blocks())
+
+		a.mu.Lock()
+		var users = make([]string, 0, len(a.users))
+		for userID := range a.users {
+			users = append(users, userID)
+		}
+		a.mu.Unlock()
+
+		for _, userID := range users {
+			err := a.slackHook.PublishView(userID, view)
+			if err != nil {
+				log.Printf("PublishHome: %s\n", err.Error())
+			}
+		}
+	}
+}
+
+func (a *AppHome) blocks() []slack_webhook.BlockBase {
+	var lc = locale.Default()
+	var blocks = []slack_webhook.BlockBase{
+		slack_webhook.HeaderBlock(lc.T("home.voice_title")),
+	}
+
+	voiceChannels.Mutex.Lock()
+	for _, guildID := range a.settings.Guilds() {
+		var guildName = guildID
+		if guild, err := a.discord.State.Guild(guildID); err == nil {
+			guildName = guild.Name
+		}
+
+		var title = slack_webhook.SectionBlock()
+		title.Text = slack_webhook.MrkdwnElement(fmt.Sprintf("*<https://discord.com/channels/%s|%s>*", guildID, guildName))
+		blocks = append(blocks, title)
+
+		var guildLocale = a.settings.Locale(guildID)
+		var channels = voiceChannels.Guilds[guildID]
+		if channels == nil {
+			channels = &VoiceChannels{}
+		}
+		voiceBlocks, err := channels.SlackBlocksMultiChannel(VoiceIndicators{}, guildLocale)
+		if err != nil {
+			log.Printf("HomeVoiceBlocks: %s\n", err.Error())
+			continue
+		}
+		blocks = append(blocks, voiceBlocks...)
+	}
+	voiceChannels.Mutex.Unlock()
+
+	blocks = append(blocks,
+		slack_webhook.DividerBlock(),
+		slack_webhook.HeaderBlock(lc.T("home.bridged_title")),
+	)
+
+	var links = a.messageLinks.RecentChannels(time.Now().Add(-AppHomeBridgedPeriod), AppHomeBridgedChannels)
+	if len(links) == 0 {
+		blocks = append(blocks, slack_webhook.ContextBlock(slack_webhook.MrkdwnElement(lc.T("home.no_bridged"))))
+	}
+	for _, link := range links {
+		var discordChannel = link.DiscordChannel
+		if channel, err := a.discord.State.Channel(link.DiscordChannel); err == nil {
+			discordChannel = fmt.Sprintf("<https://discord.com/channels/%s/%s|#%s>", channel.GuildID, channel.ID, channel.Name)
+		}
+		blocks = append(blocks, slack_webhook.ContextBlock(slack_webhook.MrkdwnElement(fmt.Sprintf(
+			"<#%s> ⇄ %s  <!date^%d^{date_short_pretty} {time}|%s>",
+			link.SlackChannel, discordChannel, link.Created.Unix(), link.Created.Format("2006-01-02 15:04"),
+		))))
+	}
+
+	var now = time.Now()
+	var footer = slack_webhook.ContextBlock(slack_webhook.MrkdwnElement(lc.T(
+		"home.updated", now.Unix(), now.Format("2006-01-02 15:04"),
+	)))
+
+	if len(blocks) >= AppHomeMaxBlocks {
+		blocks = blocks[:AppHomeMaxBlocks-1]
+	}
+	return append(blocks, footer)
+}
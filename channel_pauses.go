@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ChannelPauses keeps the bridged channels whose relaying is paused, by Slack channel
+type ChannelPauses struct {
+	path   string
+	pauses map[string]time.Time // zero time pauses until resumed
+	mu     sync.RWMutex
+}
+
+func NewChannelPauses(path string) *ChannelPauses {
+	var p = &ChannelPauses{path: path, pauses: map[string]time.Time{}}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("ReadChannelPauses: %s\n", err.Error())
+		}
+		return p
+	}
+
+	err = json.Unmarshal(b, &p.pauses)
+	if err != nil {
+		log.Printf("ParseChannelPauses: %s\n", err.Error())
+		p.pauses = map[string]time.Time{}
+	}
+
+	return p
+}
+
+// Pause pauses relaying for d, or until resumed if d is zero
+func (p *ChannelPauses) Pause(slackChannel string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var until time.Time
+	if d > 0 {
+		until = time.Now().Add(d)
+	}
+	p.pauses[slackChannel] = until
+	p.save()
+}
+
+func (p *ChannelPauses) Resume(slackChannel string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.pauses, slackChannel)
+	p.save()
+}
+
+// Paused reports whether relaying is paused, and until when
+func (p *ChannelPauses) Paused(slackChannel string) (bool, time.Time) {
+	if p == nil {
+		return false, time.Time{}
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	until, ok := p.pauses[slackChannel]
+	if !ok {
+		return false, time.Time{}
+	}
+	if !until.IsZero() && time.Now().After(until) {
+		return false, time.Time{}
+	}
+	return true, until
+}
+
+func (p *ChannelPauses) save() {
+	b, err := json.Marshal(p.pauses)
+	if err != nil {
+		log.Printf("EncodeChannelPauses: %s\n", err.Error())
+		return
+	}
+
+	err = ioutil.WriteFile(p.path, b, 0644)
+	if err != nil {
+		log.Printf("SaveChannelPauses: %s\n", err.Error())
+	}
+}
@@ -3,6 +3,8 @@ package configurator
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
 )
 
 func (s *SettingsHandler) GetClientInfo(w http.ResponseWriter, r *http.Request) {
@@ -14,7 +16,7 @@ func (s *SettingsHandler) GetClientInfo(w http.ResponseWriter, r *http.Request)
 	err := json.NewEncoder(w).Encode(resp)
 	if err != nil {
 		w.WriteHeader(500)
-		w.Write([]byte("InternalServerError: JsonEncodeError"))
+		w.Write([]byte(locale.Default().T("configurator.encode_error")))
 		return
 	}
 
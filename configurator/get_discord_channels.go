@@ -3,6 +3,8 @@ package configurator
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
 )
 
 func (s SettingsHandler) GetDiscordChannels(w http.ResponseWriter, r *http.Request) {
@@ -10,14 +12,14 @@ func (s SettingsHandler) GetDiscordChannels(w http.ResponseWriter, r *http.Reque
 	channels, err := s.Discord.Session.GuildChannels(guildID)
 	if err != nil {
 		w.WriteHeader(500)
-		w.Write([]byte("InternalServerError: GetChannelsError\n" + err.Error()))
+		w.Write([]byte(locale.Default().T("configurator.get_channels_error") + "\n" + err.Error()))
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(channels)
 	if err != nil {
 		w.WriteHeader(500)
-		w.Write([]byte("InternalServerError: JsonEncodeError\n" + err.Error()))
+		w.Write([]byte(locale.Default().T("configurator.encode_error") + "\n" + err.Error()))
 		return
 	}
 
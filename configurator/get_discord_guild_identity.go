@@ -3,6 +3,8 @@ package configurator
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
 )
 
 func (s SettingsHandler) GetDiscordGuildIdentity(w http.ResponseWriter, r *http.Request) {
@@ -10,21 +12,21 @@ func (s SettingsHandler) GetDiscordGuildIdentity(w http.ResponseWriter, r *http.
 
 	if guildID == "" {
 		w.WriteHeader(400)
-		w.Write([]byte("BadRequest: guild_id not specified"))
+		w.Write([]byte(locale.Default().T("configurator.guild_id_missing")))
 		return
 	}
 
 	identity, err := s.Discord.Session.Guild(guildID)
 	if err != nil {
 		w.WriteHeader(500)
-		w.Write([]byte("InternalServerError: GetIdentityError\n" + err.Error()))
+		w.Write([]byte(locale.Default().T("configurator.get_identity_error") + "\n" + err.Error()))
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(identity)
 	if err != nil {
 		w.WriteHeader(500)
-		w.Write([]byte("InternalServerError: JsonMarshalError\n" + err.Error()))
+		w.Write([]byte(locale.Default().T("configurator.encode_error") + "\n" + err.Error()))
 		return
 	}
 
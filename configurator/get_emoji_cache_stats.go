@@ -0,0 +1,26 @@
+package configurator
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
+)
+
+// GetEmojiCacheStats returns the hits, misses and size of the emoji image cache for monitoring
+func (s *SettingsHandler) GetEmojiCacheStats(w http.ResponseWriter, r *http.Request) {
+	if s.EmojiCacheStats == nil {
+		w.WriteHeader(404)
+		w.Write([]byte(locale.Default().T("configurator.bad_request")))
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json")
+
+	err := json.NewEncoder(w).Encode(s.EmojiCacheStats())
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(locale.Default().T("configurator.encode_error") + "\n" + err.Error()))
+		return
+	}
+}
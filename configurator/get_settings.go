@@ -3,6 +3,8 @@ package configurator
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
 )
 
 func (s *SettingsHandler) GetCurrentSettings(w http.ResponseWriter, r *http.Request) {
@@ -10,14 +12,14 @@ func (s *SettingsHandler) GetCurrentSettings(w http.ResponseWriter, r *http.Requ
 	err = s.ReadSettings()
 	if err != nil {
 		w.WriteHeader(500)
-		w.Write([]byte("InternalServerError: ParseSettingsError\n" + err.Error()))
+		w.Write([]byte(locale.Default().T("configurator.parse_settings_error") + "\n" + err.Error()))
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(s.Settings)
 	if err != nil {
 		w.WriteHeader(500)
-		w.Write([]byte("InternalServerError: JsonEncodeError\n" + err.Error()))
+		w.Write([]byte(locale.Default().T("configurator.encode_error") + "\n" + err.Error()))
 		return
 	}
 
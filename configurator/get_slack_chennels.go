@@ -3,20 +3,22 @@ package configurator
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
 )
 
 func (s *SettingsHandler) GetSlackChannels(w http.ResponseWriter, r *http.Request) {
 	channels, err := s.Slack.GetChannels()
 	if err != nil {
 		w.WriteHeader(500)
-		w.Write([]byte("InternalServerError: GetChannelsError\n" + err.Error()))
+		w.Write([]byte(locale.Default().T("configurator.get_channels_error") + "\n" + err.Error()))
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(channels)
 	if err != nil {
 		w.WriteHeader(500)
-		w.Write([]byte("InternalServerError: JsonMarshalError\n" + err.Error()))
+		w.Write([]byte(locale.Default().T("configurator.encode_error") + "\n" + err.Error()))
 		return
 	}
 
@@ -3,6 +3,8 @@ package configurator
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
 )
 
 func (s *SettingsHandler) SetSettings(w http.ResponseWriter, r *http.Request) {
@@ -11,14 +13,14 @@ func (s *SettingsHandler) SetSettings(w http.ResponseWriter, r *http.Request) {
 	err = json.NewDecoder(r.Body).Decode(&s.Settings)
 	if err != nil {
 		w.WriteHeader(500)
-		w.Write([]byte("InternalServerError: ParseRequestedSettingsError\n" + err.Error()))
+		w.Write([]byte(locale.Default().T("configurator.parse_request_error") + "\n" + err.Error()))
 		return
 	}
 
 	err = s.WriteSettings()
 	if err != nil {
 		w.WriteHeader(500)
-		w.Write([]byte("InternalServerError: WriteRequestedSettingsError\n" + err.Error()))
+		w.Write([]byte(locale.Default().T("configurator.write_settings_error") + "\n" + err.Error()))
 		return
 	}
 
@@ -7,6 +7,8 @@ import (
 	"net"
 	"net/http"
 	"os"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
 )
 
 type SettingsHandler struct {
@@ -15,6 +17,9 @@ type SettingsHandler struct {
 	Discord *DiscordHandler
 	Slack   *SlackHandler
 
+	// EmojiCacheStats returns the statistics of the emoji image cache, and may be nil
+	EmojiCacheStats func() interface{}
+
 	controller chan int
 
 	Settings []SlackDiscordTable
@@ -29,6 +34,24 @@ type SlackDiscordTable struct {
 	Channel       []ChannelSetting `json:"channel"`
 	SlackSuffix   string           `json:"slack_suffix"`
 	DiscordSuffix string           `json:"discord_suffix"`
+	VoiceRoutes   []VoiceRoute     `json:"voice_routes,omitempty"`
+	Locale        string           `json:"locale,omitempty"`
+	EmojiSync     EmojiSyncSetting `json:"emoji_sync"`
+}
+
+// EmojiSyncSetting selects the Slack custom emoji mirrored as the guild emoji
+type EmojiSyncSetting struct {
+	Enabled bool `json:"enabled"`
+	// Names are the Slack emoji to mirror, and nothing is mirrored if empty
+	Names []string `json:"names,omitempty"`
+}
+
+// VoiceRoute sends the voice events of a voice channel or a category to a Slack channel
+type VoiceRoute struct {
+	Discord string      `json:"discord"`
+	Slack   string      `json:"slack"`
+	Style   string      `json:"style"`
+	Setting SendSetting `json:"setting"`
 }
 
 //ChannelSetting Put send settings
@@ -48,6 +71,42 @@ type SendSetting struct {
 	SendVoiceState           bool `json:"SendVoiceState"`
 	SendMuteState            bool `json:"SendMuteState"`
 	CreateSlackChannelOnSend bool `json:"CreateSlackChannelOnSend"`
+	ReplyAsThread            bool `json:"ReplyAsThread"`
+	SendVoiceSummary         bool `json:"SendVoiceSummary"`
+	VoiceSummaryMinMinutes   int  `json:"VoiceSummaryMinMinutes"`
+	SendStreamState          bool `json:"SendStreamState"`
+	SendVideoState           bool `json:"SendVideoState"`
+	SendStageState           bool `json:"SendStageState"`
+	KeepDiscordOriginal      bool `json:"KeepDiscordOriginal"`
+	KeepSlackOriginal        bool `json:"KeepSlackOriginal"`
+
+	SlackToDiscordReactions string `json:"SlackToDiscordReactions,omitempty"`
+	DiscordToSlackReactions string `json:"DiscordToSlackReactions,omitempty"`
+
+	VoiceIndicators VoiceIndicators `json:"VoiceIndicators"`
+	ReactionImage   ReactionImage   `json:"ReactionImage"`
+}
+
+// ReactionImage is how the images of Slack reactions are rendered
+type ReactionImage struct {
+	Size        int    `json:"Size,omitempty"`
+	Columns     int    `json:"Columns,omitempty"`
+	Theme       string `json:"Theme,omitempty"`
+	Transparent bool   `json:"Transparent,omitempty"`
+	StaticPNG   bool   `json:"StaticPNG,omitempty"`
+	Reactors    string `json:"Reactors,omitempty"`
+}
+
+// VoiceIndicators are the emoji shown beside user names on the voice state
+type VoiceIndicators struct {
+	Muted          string `json:"Muted,omitempty"`
+	Deafened       string `json:"Deafened,omitempty"`
+	ServerMuted    string `json:"ServerMuted,omitempty"`
+	ServerDeafened string `json:"ServerDeafened,omitempty"`
+	Streaming      string `json:"Streaming,omitempty"`
+	Video          string `json:"Video,omitempty"`
+	Suppressed     string `json:"Suppressed,omitempty"`
+	Speaker        string `json:"Speaker,omitempty"`
 }
 
 func NewSettingsHandler(confPath string, discord *DiscordHandler, slackHandler *SlackHandler) *SettingsHandler {
@@ -78,7 +137,7 @@ func (s *SettingsHandler) Start(prefix, sock, addr string) (chan int, error) {
 	mux.Handle(prefix+"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadFile("index.html")
 		if err != nil {
-			w.Write([]byte("Error: index.html not found"))
+			w.Write([]byte(locale.Default().T("configurator.index_not_found")))
 			return
 		}
 		w.Write(b)
@@ -119,9 +178,11 @@ func (s *SettingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.GetSlackChannels(w, r)
 	case "getDiscordGuildIdentity":
 		s.GetDiscordGuildIdentity(w, r)
+	case "getEmojiCacheStats":
+		s.GetEmojiCacheStats(w, r)
 	default:
-		w.Write([]byte("Bad Request"))
-		w.WriteHeader(500)
+		w.WriteHeader(400)
+		w.Write([]byte(locale.Default().T("configurator.bad_request")))
 	}
 	return
 }
@@ -13,6 +13,8 @@ type Handler struct {
 	}
 	confPath string
 
+	emojiCacheStats func() interface{}
+
 	settings *SettingsHandler
 }
 
@@ -25,6 +27,11 @@ func New(discord, slack, confPath string) *Handler {
 	return &handler
 }
 
+// SetEmojiCacheStats sets the function returning the statistics of the emoji image cache
+func (h *Handler) SetEmojiCacheStats(stats func() interface{}) {
+	h.emojiCacheStats = stats
+}
+
 func (h Handler) Start(prefix, sock, addr string) (chan int, error) {
 	Discord, err := NewDiscordHandler(h.discord.API)
 	if err != nil {
@@ -39,6 +46,7 @@ func (h Handler) Start(prefix, sock, addr string) (chan int, error) {
 		Slack,
 	)
 
+	s.EmojiCacheStats = h.emojiCacheStats
 	h.settings = s
 
 	return s.Start(prefix, sock, addr)
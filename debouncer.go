@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// ReactionDebounceDelay is how long reaction events of a message are collected before it is updated
+	ReactionDebounceDelay = 2 * time.Second
+	// ReactionDebounceMaxWait is the longest delay of an update while reactions keep coming
+	ReactionDebounceMaxWait = 10 * time.Second
+)
+
+// Debouncer coalesces the events of each key, running only the last function once the events stop.
+// Events while the function runs make it run again afterwards, so the final state is always handled.
+type Debouncer struct {
+	delay   time.Duration
+	maxWait time.Duration
+
+	mutex   sync.Mutex
+	pending map[string]*debounced
+}
+
+type debounced struct {
+	fn       func()
+	first    time.Time
+	deadline time.Time
+	running  bool
+	again    bool
+}
+
+func NewDebouncer(delay, maxWait time.Duration) *Debouncer {
+	return &Debouncer{
+		delay:   delay,
+		maxWait: maxWait,
+		pending: map[string]*debounced{},
+	}
+}
+
+// Do runs fn after no other Do of the key is called for the delay, or at most maxWait after the first one
+func (d *Debouncer) Do(key string, fn func()) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var now = time.Now()
+
+	var e, ok = d.pending[key]
+	if !ok {
+		e = &debounced{first: now}
+		d.pending[key] = e
+		d.schedule(key, d.delay)
+	}
+
+	e.fn = fn
+	if e.running {
+		e.again = true
+		return
+	}
+
+	e.deadline = now.Add(d.delay)
+	if limit := e.first.Add(d.maxWait); e.deadline.After(limit) {
+		e.deadline = limit
+	}
+}
+
+func (d *Debouncer) schedule(key string, wait time.Duration) {
+	time.AfterFunc(wait, func() {
+		d.fire(key)
+	})
+}
+
+func (d *Debouncer) fire(key string) {
+	d.mutex.Lock()
+	var e = d.pending[key]
+	if wait := time.Until(e.deadline); wait > 0 {
+		// postponed by later events
+		d.schedule(key, wait)
+		d.mutex.Unlock()
+		return
+	}
+	e.running = true
+	var fn = e.fn
+	d.mutex.Unlock()
+
+	fn()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	e.running = false
+	if !e.again {
+		delete(d.pending, key)
+		return
+	}
+
+	var now = time.Now()
+	e.again = false
+	e.first = now
+	e.deadline = now.Add(d.delay)
+	d.schedule(key, d.delay)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDebouncer(t *testing.T) {
+	var debouncer = NewDebouncer(50*time.Millisecond, 200*time.Millisecond)
+
+	var mutex sync.Mutex
+	var calls = map[string][]int{}
+	var record = func(key string, n int) func() {
+		return func() {
+			mutex.Lock()
+			calls[key] = append(calls[key], n)
+			mutex.Unlock()
+		}
+	}
+
+	for i := 1; i <= 5; i++ {
+		debouncer.Do("a", record("a", i))
+		time.Sleep(10 * time.Millisecond)
+	}
+	debouncer.Do("b", record("b", 1))
+
+	time.Sleep(150 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(calls["a"]) != 1 || calls["a"][0] != 5 {
+		t.Errorf("a: %v; want only the last call", calls["a"])
+	}
+	if len(calls["b"]) != 1 {
+		t.Errorf("b: %v; want 1 call", calls["b"])
+	}
+}
+
+func TestDebouncerMaxWait(t *testing.T) {
+	var debouncer = NewDebouncer(40*time.Millisecond, 100*time.Millisecond)
+
+	var mutex sync.Mutex
+	var count int
+	var start = time.Now()
+	var first time.Duration
+
+	for time.Since(start) < 300*time.Millisecond {
+		debouncer.Do("a", func() {
+			mutex.Lock()
+			if count == 0 {
+				first = time.Since(start)
+			}
+			count++
+			mutex.Unlock()
+		})
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if count == 0 || first > 200*time.Millisecond {
+		t.Errorf("first call after %v; want within the max wait", first)
+	}
+}
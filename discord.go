@@ -2,14 +2,19 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_embed_maker"
 	dp "github.com/kmc-jp/DiscordSlackSynchronizer/discord_plugin"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_webhook"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_attachment_maker"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
 	"github.com/pkg/errors"
 )
@@ -17,6 +22,9 @@ import (
 const DiscordAPIEndpoint = "https://discord.com/api"
 const SlackMessageDummyURI = "http://example?discord_message_ts="
 
+// errNotReplace is returned by replaceMessage for replies which are not ss/ commands
+var errNotReplace = errors.New("NotReplaceCommand")
+
 type DiscordHandler struct {
 	Session *discordgo.Session
 	regExp  struct {
@@ -30,10 +38,29 @@ type DiscordHandler struct {
 
 	hook *discord_webhook.Handler
 
-	slackLastMessages SlackLastMessages
+	slackLastMessages *SlackLastMessages
 	slackHook         *slack_webhook.Handler
 
 	reactionHandler *DiscordReactionHandler
+	messageLinks    *MessageLinks
+	voiceSessions   *VoiceSessionStore
+	slackStatus     *SlackStatusUpdater
+	appHome         *AppHome
+	pauses          *ChannelPauses
+	userLinks       *UserLinks
+	linkCodes       *LinkCodes
+
+	// reactionDebouncer coalesces the reaction events of a message
+	reactionDebouncer *Debouncer
+
+	// applicationID is fetched once to register the application commands
+	applicationID     string
+	applicationIDOnce sync.Once
+
+	registeredGuilds      map[string]bool
+	registeredGuildsMutex sync.Mutex
+
+	slackMembers slackMemberCache
 
 	settings *SettingsHandler
 }
@@ -53,16 +80,18 @@ func NewDiscordBot(apiToken string, settings *SettingsHandler) *DiscordHandler {
 	d.regExp.Channel = regexp.MustCompile(`<#(\d+)>`)
 	d.regExp.ImageURI = regexp.MustCompile(`\S\.png|\.jpg|\.jpeg|\.gif`)
 	d.regExp.replace = regexp.MustCompile(`\s*ss\/(.+)\/(.*)(\/)??\s*`)
-	d.regExp.refURI = regexp.MustCompile(`\(RefURI:\s<https:.+>\)`)
+	d.regExp.refURI = locale.Pattern("message.ref_uri", `https:.+`)
 
-	dg.AddHandler(d.voiceState)
+	dg.AddHandler(d.gatewayEvent)
 	dg.AddHandler(d.watch)
+	dg.AddHandler(d.messageUpdate)
 	dg.AddHandler(d.ReactionAdd)
 	dg.AddHandler(d.ReactionRemove)
 	dg.AddHandler(d.ReactionRemoveAll)
 
-	d.slackLastMessages = SlackLastMessages{}
+	d.slackLastMessages = LoadSlackLastMessages(statePath("slack_last_messages.json"))
 	d.settings = settings
+	d.reactionDebouncer = NewDebouncer(ReactionDebounceDelay, ReactionDebounceMaxWait)
 
 	return &d
 }
@@ -79,6 +108,34 @@ func (d *DiscordHandler) SetDiscordReactionHandler(handler *DiscordReactionHandl
 	d.reactionHandler = handler
 }
 
+func (d *DiscordHandler) SetMessageLinks(links *MessageLinks) {
+	d.messageLinks = links
+}
+
+func (d *DiscordHandler) SetVoiceSessionStore(store *VoiceSessionStore) {
+	d.voiceSessions = store
+}
+
+func (d *DiscordHandler) SetSlackStatusUpdater(updater *SlackStatusUpdater) {
+	d.slackStatus = updater
+}
+
+func (d *DiscordHandler) SetAppHome(home *AppHome) {
+	d.appHome = home
+}
+
+func (d *DiscordHandler) SetChannelPauses(pauses *ChannelPauses) {
+	d.pauses = pauses
+}
+
+func (d *DiscordHandler) SetUserLinks(links *UserLinks) {
+	d.userLinks = links
+}
+
+func (d *DiscordHandler) SetLinkCodes(codes *LinkCodes) {
+	d.linkCodes = codes
+}
+
 func (d *DiscordHandler) Close() error {
 	return d.Session.Close()
 }
@@ -103,6 +160,9 @@ func (d *DiscordHandler) watch(s *discordgo.Session, m *discordgo.MessageCreate)
 	if !sdt.Setting.DiscordToSlack {
 		return
 	}
+	if paused, _ := d.pauses.Paused(sdt.SlackChannel); paused {
+		return
+	}
 
 	var reference *discordgo.Message
 	var err error
@@ -114,112 +174,12 @@ func (d *DiscordHandler) watch(s *discordgo.Session, m *discordgo.MessageCreate)
 			return
 		}
 
-		err = func() (err error) {
-			if !d.regExp.replace.MatchString(m.Content) {
-				return
-			}
-
-			id, err := d.parseUserName(reference.Author)
-			if err != nil {
-				return err
-			}
-
-			ids, err := dp.GetDiscordID(id)
-			if err != nil {
-				return err
-			}
-
-			var check bool
-			for _, id := range ids {
-				if id == m.Author.ID {
-					check = true
-				}
-			}
-			if !check {
-				return fmt.Errorf("InvalidUpdateMessage")
-			}
-
-			err = d.deleteMessage(m.ChannelID, m.ID)
+		// ss/ commands are never relayed, even if they failed
+		err = d.replaceMessage(m, reference)
+		if err != errNotReplace {
 			if err != nil {
-				log.Println(err)
-			}
-
-			var message discord_webhook.Message
-			message.Message = reference
-			message.Attachments = make([]discord_webhook.Attachment, 0)
-
-			for i := range message.Message.Attachments {
-				if message.Message.Attachments[i] == nil {
-					continue
-				}
-
-				var oldAtt = message.Message.Attachments[i]
-
-				message.Attachments = append(message.Attachments, discord_webhook.Attachment{
-					URL:      oldAtt.URL,
-					ID:       oldAtt.ID,
-					ProxyURL: oldAtt.ProxyURL,
-					Filename: oldAtt.Filename,
-					Width:    oldAtt.Width,
-					Height:   oldAtt.Height,
-					Size:     oldAtt.Size,
-				})
+				log.Printf("ReplaceMessage: %s\n", err.Error())
 			}
-
-			var newContent = reference.Content
-			var newContentSlice = strings.Split(newContent, "\n")
-
-			var refMatch = d.regExp.refURI.MatchString(newContentSlice[len(newContentSlice)-1])
-			if refMatch {
-				newContent = strings.Join(newContentSlice[1:len(newContentSlice)-1], "\n")
-			}
-
-			// replace and update message
-			for _, pattern := range strings.Split(m.Content, "\n") {
-				var matches = strings.Split(pattern, "/")
-				var escapedMatch = []string{}
-				var tmp string
-				for i, match := range matches {
-					if i < 1 {
-						continue
-					}
-					if tmp != "" {
-						match = tmp + "/" + match
-						tmp = ""
-					}
-					if strings.HasSuffix(match, "\\") && !strings.HasSuffix(match, "\\\\") {
-						tmp = strings.TrimSuffix(match, "\\")
-						continue
-					}
-
-					escapedMatch = append(escapedMatch, match)
-				}
-				if len(escapedMatch) < 2 {
-					return fmt.Errorf("Mal-formedExpression")
-				}
-				newContent = strings.ReplaceAll(newContent, escapedMatch[0], escapedMatch[1])
-			}
-
-			if refMatch {
-				newContent = strings.Join(
-					[]string{
-						newContentSlice[0],
-						newContent,
-						newContentSlice[len(newContentSlice)-1],
-					}, "\n",
-				)
-			}
-
-			message.Content = newContent
-			_, err = d.hook.Edit(message.ChannelID, message.ID, message, []discord_webhook.File{})
-			if err != nil {
-				log.Printf("EditError: %s\n", err)
-				return
-			}
-
-			return
-		}()
-		if err == nil {
 			return
 		}
 	}
@@ -244,66 +204,53 @@ func (d *DiscordHandler) watch(s *discordgo.Session, m *discordgo.MessageCreate)
 		},
 	}
 
-	var dFiles = []discord_webhook.File{}
-
-	if m.Message != nil {
-		if m.Message.Attachments != nil {
-			// Add original attachments to new message
-			for i := range m.Message.Attachments {
-				if m.Message.Attachments[i] == nil {
-					continue
-				}
+	// the messages kept on Discord are relayed as they are
+	var repost = !sdt.Setting.KeepDiscordOriginal
 
-				var dfile discord_webhook.File
-
-				resp, err := http.Get(m.Message.Attachments[i].URL)
-				if err != nil {
-					log.Printf("DownloadErr: %s\n", err.Error())
-					continue
-				}
-				defer resp.Body.Close()
-
-				dfile.Reader = resp.Body
-				dfile.FileName = m.Message.Attachments[i].Filename
-				dFiles = append(dFiles, dfile)
-			}
-		}
-
-		if m.Embeds != nil {
-			dMessage.Embeds = m.Embeds
-		}
+	if m.Message != nil && m.Embeds != nil {
+		dMessage.Embeds = m.Embeds
 	}
 
 	if reference != nil {
 		// if sent text has reference, add its first line text to message
-		var refText string
-		var refSlice = strings.Split(reference.Content, "\n")
-		if len(refSlice) > 1 {
-			refText = refSlice[0] + "..."
-		} else {
-			refText = refSlice[0]
-		}
-		dMessage.Content = fmt.Sprintf("> %s\n%s\n(RefURI: <%s>)",
-			refText,
+		var lc = d.settings.Locale(m.GuildID)
+		dMessage.Content = fmt.Sprintf("%s\n%s\n%s",
+			quote(reference.Content, lc),
 			m.Content,
-			fmt.Sprintf("https://discord.com/channels/%s/%s/%s",
+			lc.T("message.ref_uri", fmt.Sprintf("https://discord.com/channels/%s/%s/%s",
 				m.GuildID, reference.ChannelID, reference.ID,
-			),
+			)),
 		)
 	}
 
-	// Delete message on Discord
-	err = d.deleteMessage(m.ChannelID, m.ID)
-	if err != nil {
+	var previews []*discordgo.MessageEmbed
+	dMessage.Content, previews = d.previewSlackLinks(m.GuildID, dMessage.Content)
+	dMessage.Embeds = discord_embed_maker.Limit(append(dMessage.Embeds, previews...))
+
+	if !repost {
+		for _, attach := range m.Attachments {
+			if attach == nil {
+				continue
+			}
+			dMessage.Attachments = append(dMessage.Attachments, discord_webhook.Attachment{
+				URL:      attach.URL,
+				ID:       attach.ID,
+				Filename: attach.Filename,
+			})
+		}
+	} else if err = d.deleteMessage(m.ChannelID, m.ID); err != nil {
+		// Delete message on Discord
 		log.Println(err)
 	} else {
-		// if it was successed, send message by webhook
-		message, err := d.hook.Send(m.ChannelID, dMessage, false, dFiles)
+		// if it was successed, send message by webhook with the original attachments
+		var dFiles, closeFiles = downloadAttachments(m.Attachments)
+		message, err := d.hook.Send(m.ChannelID, dMessage, true, dFiles)
+		closeFiles()
 		if err != nil {
 			log.Printf("MessageSendError: %s", err)
+		} else {
+			dMessage = *message
 		}
-
-		dMessage = *message
 	}
 
 	var imageURIs = []string{}
@@ -339,51 +286,19 @@ func (d *DiscordHandler) watch(s *discordgo.Session, m *discordgo.MessageCreate)
 		}
 	}
 
-	var content = m.Content
+	var content = d.slackMentions(s, m.GuildID, m.Content)
 
-	for _, id := range d.regExp.UserID.FindAllStringSubmatch(content, -1) {
-		if len(id) < 2 {
-			continue
-		}
-
-		mem, err := s.GuildMember(m.GuildID, id[1])
-		if err != nil {
-			continue
-		}
-
-		var idName = mem.Nick
-		if idName == "" {
-			idName = mem.User.Username
-		}
-		content = strings.Join(strings.Split(content, "!"+id[1]), idName)
-	}
-
-	for _, ch := range d.regExp.Channel.FindAllStringSubmatch(content, -1) {
-		if len(ch) < 2 {
-			continue
-		}
-
-		channel, err := s.State.GuildChannel(m.GuildID, ch[1])
-		if err != nil {
-			continue
-		}
-
-		content = strings.Join(strings.Split(content,
-			fmt.Sprintf("<#%s>", ch[1])),
-			fmt.Sprintf(
-				"<https://discord.com/channels/%s/%s|#%s>",
-				m.GuildID, ch[1], channel.Name,
-			),
-		)
+	var threadTS string
+	if reference != nil && sdt.Setting.ReplyAsThread {
+		threadTS, content = d.replyThread(d.settings.Locale(m.GuildID), sdt.SlackChannel, reference, content)
 	}
 
 	if sdt.Setting.ShowChannelName {
-		channelData, err := s.State.GuildChannel(m.GuildID, m.ChannelID)
+		content, err = d.withChannelName(s, m.GuildID, m.ChannelID, content)
 		if err != nil {
 			fmt.Printf("%s\n", err.Error())
 			return
 		}
-		content = "`#" + channelData.Name + "` " + content
 	}
 
 	var blocks = []slack_webhook.BlockBase{}
@@ -409,202 +324,171 @@ func (d *DiscordHandler) watch(s *discordgo.Session, m *discordgo.MessageCreate)
 	}
 
 	var message = slack_webhook.Message{
-		IconURL:     m.Author.AvatarURL(""),
-		Username:    name,
-		Channel:     sdt.SlackChannel,
-		Text:        content,
-		Blocks:      blocks,
-		UnfurlLinks: true,
-		UnfurlMedia: true,
-		LinkNames:   true,
+		IconURL:         m.Author.AvatarURL(""),
+		Username:        name,
+		Channel:         sdt.SlackChannel,
+		Text:            content,
+		Blocks:          blocks,
+		Attachments:     slack_attachment_maker.Build(m.Embeds, m.Content),
+		ThreadTimestamp: threadTS,
+		UnfurlLinks:     true,
+		UnfurlMedia:     true,
+		LinkNames:       true,
 	}
 
 	// Send message to Slack
-	_, err = d.slackHook.Send(message)
+	ts, err := d.slackHook.Send(message)
 	if err != nil {
 		log.Printf("ErrorInSendingMessageToSlack: %s\n", err.Error())
 		return
 	}
 
-}
-
-type VoiceEvent int
-
-const (
-	VoiceLeft         VoiceEvent = iota
-	VoiceEmptied      VoiceEvent = iota
-	VoiceStateChanged VoiceEvent = iota
-	VoiceEntered      VoiceEvent = iota
-)
-
-func (d *DiscordHandler) voiceState(s *discordgo.Session, vs *discordgo.VoiceStateUpdate) {
-	voiceChannels.Mutex.Lock()
-	defer voiceChannels.Mutex.Unlock()
-
-	if vs.UserID == s.State.User.ID {
-		return
+	var discordMessageID = m.ID
+	if dMessage.Message != nil && dMessage.ID != "" {
+		// the message was reposted by webhook
+		discordMessageID = dMessage.ID
 	}
 
-	channel, e := s.State.Channel(vs.VoiceState.ChannelID)
+	d.messageLinks.Add(MessageLink{
+		DiscordChannel: m.ChannelID,
+		DiscordMessage: discordMessageID,
+		SlackChannel:   sdt.SlackChannel,
+		SlackTS:        ts,
+		SlackThreadTS:  threadTS,
+		DiscordAuthor:  m.Author.ID,
+	})
 
-	if voiceChannels.Guilds[vs.GuildID] == nil {
-		voiceChannels.Guilds[vs.GuildID] = &VoiceChannels{}
-	}
+}
 
-	channels := voiceChannels.Guilds[vs.GuildID]
+// slackMentions replaces the mentions of Discord members and channels in the text with their names for Slack
+func (d *DiscordHandler) slackMentions(s *discordgo.Session, guildID, text string) string {
+	var content = text
 
-	if e != nil || vs.ChannelID == "" { // If the channel is missing, the user has left
-		channel, ok := channels.FindChannelHasUser(vs.UserID)
-		if !ok {
-			return
-		}
-		channels.Leave(vs.UserID)
-		setting := d.settings.FindSlackChannel(channel, vs.VoiceState.GuildID)
-		if len(channels.Channels[channel].Users) == 0 {
-			d.sendVoiceState(setting, channels, VoiceEmptied)
-		} else {
-			d.sendVoiceState(setting, channels, VoiceLeft)
+	for _, id := range d.regExp.UserID.FindAllStringSubmatch(content, -1) {
+		if len(id) < 2 {
+			continue
 		}
-	} else { // User joind or State changed
-		setting := d.settings.FindSlackChannel(vs.VoiceState.ChannelID, vs.VoiceState.GuildID)
-		mem, err := s.GuildMember(vs.GuildID, vs.UserID)
+
+		mem, err := s.GuildMember(guildID, id[1])
 		if err != nil {
-			fmt.Printf("Failed to get info of a member: %v\n", err)
-			return
+			continue
 		}
-		exists := channels.Join(channel, mem)
 
-		if vs.SelfDeaf {
-			channels.Deafened(vs.UserID)
-		} else if vs.Mute || vs.SelfMute {
-			channels.Muted(vs.UserID)
+		var idName = mem.Nick
+		if idName == "" {
+			idName = mem.User.Username
 		}
+		content = strings.Join(strings.Split(content, "!"+id[1]), idName)
+	}
 
-		if !exists {
-			d.sendVoiceState(setting, channels, VoiceEntered)
-		} else if setting.Setting.SendMuteState {
-			d.sendVoiceState(setting, channels, VoiceStateChanged)
+	for _, ch := range d.regExp.Channel.FindAllStringSubmatch(content, -1) {
+		if len(ch) < 2 {
+			continue
 		}
-	}
-}
 
-func (d *DiscordHandler) ReactionAdd(_ *discordgo.Session, ev *discordgo.MessageReactionAdd) {
-	err := d.reactionHandler.GetReaction(ev.GuildID, ev.ChannelID, ev.MessageID)
-	if err != nil {
-		log.Println(err)
+		channel, err := s.State.GuildChannel(guildID, ch[1])
+		if err != nil {
+			continue
+		}
+
+		content = strings.Join(strings.Split(content,
+			fmt.Sprintf("<#%s>", ch[1])),
+			fmt.Sprintf(
+				"<https://discord.com/channels/%s/%s|#%s>",
+				guildID, ch[1], channel.Name,
+			),
+		)
 	}
+
+	return content
 }
-func (d *DiscordHandler) ReactionRemove(_ *discordgo.Session, ev *discordgo.MessageReactionRemove) {
-	err := d.reactionHandler.GetReaction(ev.GuildID, ev.ChannelID, ev.MessageID)
+
+// withChannelName puts the name of the Discord channel before the content
+func (d *DiscordHandler) withChannelName(s *discordgo.Session, guildID, channelID, content string) (string, error) {
+	channelData, err := s.State.GuildChannel(guildID, channelID)
 	if err != nil {
-		log.Println(err)
+		return "", err
 	}
+	return "`#" + channelData.Name + "` " + content, nil
 }
-func (d *DiscordHandler) ReactionRemoveAll(_ *discordgo.Session, ev *discordgo.MessageReactionRemoveAll) {
-	err := d.reactionHandler.GetReaction(ev.GuildID, ev.ChannelID, ev.MessageID)
-	if err != nil {
-		log.Println(err)
+
+// messageUpdate relays the edits of the messages kept on Discord to their Slack copies.
+// Reposted messages are edited only by ss/ commands, and their links have the IDs of the reposts.
+func (d *DiscordHandler) messageUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) {
+	// updates of embeds only have no author
+	if m.Author == nil || m.Author.ID == s.State.User.ID || m.Author.Bot {
+		return
 	}
-}
 
-func (d *DiscordHandler) sendVoiceState(setting ChannelSetting, channels *VoiceChannels, event VoiceEvent) {
-	if setting.SlackChannel == "" {
+	var sdt = d.settings.FindSlackChannel(m.ChannelID, m.GuildID)
+	if sdt.SlackChannel == "" || !sdt.Setting.DiscordToSlack {
 		return
 	}
-	if !setting.Setting.SendVoiceState {
+	if paused, _ := d.pauses.Paused(sdt.SlackChannel); paused {
 		return
 	}
-	var blocks []slack_webhook.BlockBase
-	var err error
-	if setting.DiscordChannel == "all" {
-		blocks, err = channels.SlackBlocksMultiChannel()
-		if err != nil {
-			fmt.Printf("%v\n", errors.Wrapf(err, "Failed SlackBlocks"))
-			return
-		}
-	} else {
-		channel, ok := channels.Channels[setting.DiscordChannel]
-		if !ok {
-			fmt.Print("Failed to find channel")
-		}
-		blocks = channel.SlackBlocksSingleChannel()
-		if err != nil {
-			fmt.Printf("%v\n", errors.Wrapf(err, "Failed SlackBlock"))
-		}
+
+	link, ok := d.messageLinks.FindByDiscord(m.ID)
+	if !ok || link.SlackChannel != sdt.SlackChannel {
+		return
 	}
 
-	var message = slack_webhook.Message{
-		Channel:     setting.SlackChannel,
-		Username:    "Discord Watcher",
-		IconEmoji:   "discord",
-		UnfurlLinks: false,
-		UnfurlMedia: false,
-		Blocks:      blocks,
-	}
-
-	switch event {
-	case VoiceEntered:
-		ts, ok := d.slackLastMessages[message.Channel]
-		if ok {
-			d.slackHook.Remove(message.Channel, ts)
-		}
+	var content = d.slackMentions(s, m.GuildID, m.Content)
 
-		ts, err = d.slackHook.Send(message)
-		if err != nil {
-			log.Println(err)
-			return
+	// a reply out of the thread quoted the replied message
+	if m.MessageReference != nil && sdt.Setting.ReplyAsThread && link.SlackThreadTS == "" {
+		reference, err := s.ChannelMessage(m.MessageReference.ChannelID, m.MessageReference.MessageID)
+		if err == nil {
+			content = fmt.Sprintf("%s\n%s", quote(reference.Content, d.settings.Locale(m.GuildID)), content)
 		}
+	}
 
-		d.slackLastMessages[message.Channel] = ts
-	case VoiceLeft:
-		ts, ok := d.slackLastMessages[message.Channel]
-		if !ok {
-			ts, ok := d.slackLastMessages[message.Channel]
-			if ok {
-				delete(d.slackLastMessages, message.Channel)
-				d.slackHook.Remove(message.Channel, ts)
-			}
-
-			ts, err = d.slackHook.Send(message)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			d.slackLastMessages[message.Channel] = ts
-		}
-		message.TS = ts
-		ts, err = d.slackHook.Update(message)
+	if sdt.Setting.ShowChannelName {
+		var err error
+		content, err = d.withChannelName(s, m.GuildID, m.ChannelID, content)
 		if err != nil {
 			log.Println(err)
 			return
 		}
+	}
 
-		d.slackLastMessages[message.Channel] = ts
-
-	case VoiceStateChanged:
-		ts, ok := d.slackLastMessages[message.Channel]
-		if !ok {
-			d.slackHook.Send(message)
+	err := d.updateSlackCopy(link, func(text string) (string, error) {
+		// the Discord message ID at the end is kept
+		if i := strings.Index(text, " <"+SlackMessageDummyURI); i >= 0 {
+			return content + text[i:], nil
 		}
+		return content, nil
+	})
+	if err != nil {
+		log.Printf("UpdateSlackCopy: %s\n", err.Error())
+	}
+}
 
-		message.TS = ts
-		ts, err = d.slackHook.Update(message)
+func (d *DiscordHandler) ReactionAdd(s *discordgo.Session, ev *discordgo.MessageReactionAdd) {
+	if ev.UserID == s.State.User.ID {
+		// mirrored from Slack
+		return
+	}
+	d.reactionHandle(ev.GuildID, ev.ChannelID, ev.MessageID)
+}
+func (d *DiscordHandler) ReactionRemove(s *discordgo.Session, ev *discordgo.MessageReactionRemove) {
+	if ev.UserID == s.State.User.ID {
+		return
+	}
+	d.reactionHandle(ev.GuildID, ev.ChannelID, ev.MessageID)
+}
+func (d *DiscordHandler) ReactionRemoveAll(_ *discordgo.Session, ev *discordgo.MessageReactionRemoveAll) {
+	d.reactionHandle(ev.GuildID, ev.ChannelID, ev.MessageID)
+}
+
+// reactionHandle mirrors the reactions of the message, rendering only the final state of quick reactions
+func (d *DiscordHandler) reactionHandle(guildID, channelID, messageID string) {
+	d.reactionDebouncer.Do(channelID+"/"+messageID, func() {
+		err := d.reactionHandler.GetReaction(guildID, channelID, messageID)
 		if err != nil {
 			log.Println(err)
-			return
 		}
-
-		d.slackLastMessages[message.Channel] = ts
-
-	case VoiceEmptied:
-		ts, ok := d.slackLastMessages[message.Channel]
-		if !ok {
-			return
-		}
-		delete(d.slackLastMessages, message.Channel)
-
-		d.slackHook.Remove(message.Channel, ts)
-	}
+	})
 }
 
 func (d *DiscordHandler) deleteMessage(channelID, messageID string) (err error) {
@@ -634,6 +518,262 @@ func (d *DiscordHandler) deleteMessage(channelID, messageID string) (err error)
 	return nil
 }
 
+// downloadAttachments opens the attachments to upload them again, and returns the function to close them
+func downloadAttachments(attachments []*discordgo.MessageAttachment) ([]discord_webhook.File, func()) {
+	var dFiles = []discord_webhook.File{}
+	var bodies = []io.Closer{}
+
+	for _, attach := range attachments {
+		if attach == nil {
+			continue
+		}
+
+		resp, err := http.Get(attach.URL)
+		if err != nil {
+			log.Printf("DownloadErr: %s\n", err.Error())
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			// the body is an error page, not the attachment
+			log.Printf("DownloadErr: %s %s\n", attach.Filename, resp.Status)
+			resp.Body.Close()
+			continue
+		}
+		bodies = append(bodies, resp.Body)
+
+		dFiles = append(dFiles, discord_webhook.File{
+			Reader:   resp.Body,
+			FileName: attach.Filename,
+		})
+	}
+
+	return dFiles, func() {
+		for _, body := range bodies {
+			body.Close()
+		}
+	}
+}
+
+// replaceMessage edits the replied message by the ss/pattern/replacement/ command in the reply.
+// It returns errNotReplace when the reply is not the command.
+func (d *DiscordHandler) replaceMessage(m *discordgo.MessageCreate, reference *discordgo.Message) error {
+	if !d.regExp.replace.MatchString(m.Content) {
+		return errNotReplace
+	}
+
+	if !d.isAuthor(reference, m.Author.ID) {
+		return fmt.Errorf("InvalidUpdateMessage")
+	}
+
+	if reference.WebhookID == "" {
+		// the original message is kept, so only its Slack copy can be edited
+		return d.editSlackCopy(m, reference)
+	}
+
+	err := d.deleteMessage(m.ChannelID, m.ID)
+	if err != nil {
+		log.Println(err)
+	}
+
+	var message discord_webhook.Message
+	message.Message = reference
+	message.Attachments = discord_webhook.KeepAttachments(message.Message.Attachments, func(*discordgo.MessageAttachment) bool {
+		return true
+	})
+
+	var newContent = reference.Content
+	var newContentSlice = strings.Split(newContent, "\n")
+
+	// a reply is reposted as the quote, the content and the reference URI
+	var refMatch = len(newContentSlice) > 1 && d.regExp.refURI.MatchString(newContentSlice[len(newContentSlice)-1])
+	if refMatch {
+		newContent = strings.Join(newContentSlice[1:len(newContentSlice)-1], "\n")
+	}
+
+	// replace and update message
+	newContent, err = replacePatterns(newContent, m.Content)
+	if err != nil {
+		return err
+	}
+
+	if refMatch {
+		newContent = strings.Join(
+			[]string{
+				newContentSlice[0],
+				newContent,
+				newContentSlice[len(newContentSlice)-1],
+			}, "\n",
+		)
+	}
+
+	message.Content = newContent
+	_, err = d.hook.Edit(message.ChannelID, message.ID, message, []discord_webhook.File{})
+	if err != nil {
+		log.Printf("EditError: %s\n", err)
+	}
+
+	return nil
+}
+
+// replyThread returns the Slack thread of the replied message.
+// When the replied message is not bridged to the Slack channel, the content quoting it is returned instead.
+func (d *DiscordHandler) replyThread(lc *locale.Catalog, slackChannel string, reference *discordgo.Message, content string) (string, string) {
+	link, ok := d.messageLinks.FindByDiscord(reference.ID)
+	if ok && link.SlackChannel == slackChannel {
+		return link.ThreadTS(), content
+	}
+	return "", fmt.Sprintf("%s\n%s", quote(reference.Content, lc), content)
+}
+
+// quote returns the first line of a message quoted
+func quote(content string, lc *locale.Catalog) string {
+	var lines = strings.Split(content, "\n")
+	if len(lines) > 1 {
+		return lc.T("message.quote", lc.T("message.truncated", lines[0]))
+	}
+	return lc.T("message.quote", lines[0])
+}
+
+// isAuthor reports whether the user wrote the bridged message.
+// The author is taken from the message links, or from the webhook user name "name(primaryID)" for older messages.
+func (d *DiscordHandler) isAuthor(message *discordgo.Message, userID string) bool {
+	var primaryID string
+
+	link, ok := d.messageLinks.FindByDiscord(message.ID)
+	if ok && link.DiscordAuthor != "" {
+		if link.DiscordAuthor == userID {
+			return true
+		}
+
+		id, err := dp.GetPrimaryID(link.DiscordAuthor)
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+		primaryID = id
+	} else {
+		id, err := d.parseUserName(message.Author)
+		if err != nil {
+			return false
+		}
+		primaryID = id
+	}
+
+	ids, err := dp.GetDiscordID(primaryID)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	for _, id := range ids {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// editSlackCopy applies the ss/ replacement of m to the Slack copy of the message kept on Discord
+func (d *DiscordHandler) editSlackCopy(m *discordgo.MessageCreate, reference *discordgo.Message) error {
+	link, ok := d.messageLinks.FindByDiscord(reference.ID)
+	if !ok {
+		return fmt.Errorf("NotBridgedMessage")
+	}
+
+	err := d.updateSlackCopy(link, func(text string) (string, error) {
+		return replacePatterns(text, m.Content)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = d.deleteMessage(m.ChannelID, m.ID)
+	if err != nil {
+		log.Println(err)
+	}
+	return nil
+}
+
+// updateSlackCopy updates the text of the Slack message of the link by edit
+func (d *DiscordHandler) updateSlackCopy(link MessageLink, edit func(text string) (string, error)) error {
+	message, err := d.slackHook.GetMessage(link.SlackChannel, link.SlackTS)
+	if err != nil {
+		return errors.Wrap(err, "GetSlackMessage")
+	}
+	if message.TS != link.SlackTS {
+		return fmt.Errorf("SlackMessageNotFound")
+	}
+
+	text, err := edit(message.Text)
+	if err != nil {
+		return err
+	}
+
+	var update = slack_webhook.Message{
+		Channel: link.SlackChannel,
+		TS:      link.SlackTS,
+		Text:    text,
+	}
+
+	// the text is also shown in the context block above images and files
+	var blocks = []slack_webhook.BlockBase{}
+	var editable = true
+	for _, block := range message.Blocks {
+		switch block.Type {
+		case "context":
+			for i := range block.Elements {
+				if edited, err := edit(block.Elements[i].Text); err == nil {
+					block.Elements[i].Text = edited
+				}
+			}
+		case "image", "file", "section", "divider":
+		default:
+			// blocks added by Slack cannot be sent back, so all blocks are left as they are
+			editable = false
+		}
+		blocks = append(blocks, block)
+	}
+	if editable && len(blocks) > 0 {
+		update.Blocks = blocks
+	}
+
+	_, err = d.slackHook.Update(update)
+	if err != nil {
+		return errors.Wrap(err, "UpdateSlackMessage")
+	}
+	return nil
+}
+
+// replacePatterns applies the ss/from/to lines of patterns to content.
+// "/" in from and to can be escaped with a backslash.
+func replacePatterns(content, patterns string) (string, error) {
+	for _, pattern := range strings.Split(patterns, "\n") {
+		var matches = strings.Split(pattern, "/")
+		var escapedMatch = []string{}
+		var tmp string
+		for i, match := range matches {
+			if i < 1 {
+				continue
+			}
+			if tmp != "" {
+				match = tmp + "/" + match
+				tmp = ""
+			}
+			if strings.HasSuffix(match, "\\") && !strings.HasSuffix(match, "\\\\") {
+				tmp = strings.TrimSuffix(match, "\\")
+				continue
+			}
+
+			escapedMatch = append(escapedMatch, match)
+		}
+		if len(escapedMatch) < 2 {
+			return "", fmt.Errorf("Mal-formedExpression")
+		}
+		content = strings.ReplaceAll(content, escapedMatch[0], escapedMatch[1])
+	}
+	return content, nil
+}
+
 func (d *DiscordHandler) parseUserName(m *discordgo.User) (string, error) {
 	var nameSlice = strings.Split(m.Username, "(")
 	if len(nameSlice) < 1 {
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
+	"github.com/pkg/errors"
+)
+
+const (
+	// BridgeCommandName is the name of the Discord application command
+	BridgeCommandName = "bridge"
+	// BridgeWhoMaxMembers is the number of Slack channel members whose presence is checked
+	BridgeWhoMaxMembers = 50
+	// BridgeWhoConcurrency is the number of Slack users checked at once
+	BridgeWhoConcurrency = 5
+	// BridgeWhoPresenceTTL is how long the presence of a Slack user is reused
+	BridgeWhoPresenceTTL = time.Minute
+	// BridgeWhoUserTTL is how long the name of a Slack user is reused
+	BridgeWhoUserTTL = time.Hour
+	// BridgeCallsPeriod is how far back /bridge calls looks for voice sessions
+	BridgeCallsPeriod = 7 * 24 * time.Hour
+	// BridgeCallsMax is the number of the latest voice sessions /bridge calls shows
+	BridgeCallsMax = 10
+)
+
+// Discord application command option types
+const (
+	commandOptionSubCommand = 1
+	commandOptionString     = 3
+	commandOptionBoolean    = 5
+	commandOptionUser       = 6
+)
+
+// Discord interaction types
+const (
+	interactionApplicationCommand = 2
+	interactionResponseDeferred   = 5
+	interactionResponseEphemeral  = 1 << 6
+)
+
+// ApplicationCommand is a Discord slash command.
+// discordgo v0.23 does not support application commands, so they are registered through REST.
+type ApplicationCommand struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Options     []ApplicationCommandOption `json:"options,omitempty"`
+}
+
+type ApplicationCommandOption struct {
+	Type        int                        `json:"type"`
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Required    bool                       `json:"required,omitempty"`
+	Options     []ApplicationCommandOption `json:"options,omitempty"`
+}
+
+// Interaction is the payload of INTERACTION_CREATE
+type Interaction struct {
+	ID        string `json:"id"`
+	Type      int    `json:"type"`
+	Token     string `json:"token"`
+	GuildID   string `json:"guild_id"`
+	ChannelID string `json:"channel_id"`
+	Member    *struct {
+		User        *discordgo.User `json:"user"`
+		Permissions string          `json:"permissions"`
+	} `json:"member"`
+	Data struct {
+		Name    string              `json:"name"`
+		Options []InteractionOption `json:"options"`
+	} `json:"data"`
+}
+
+type InteractionOption struct {
+	Name    string              `json:"name"`
+	Type    int                 `json:"type"`
+	Value   json.RawMessage     `json:"value"`
+	Options []InteractionOption `json:"options"`
+}
+
+// String returns the value of the option, or "" if not given
+func (o InteractionOption) String(name string) string {
+	for _, opt := range o.Options {
+		if opt.Name != name {
+			continue
+		}
+		var value string
+		if json.Unmarshal(opt.Value, &value) == nil {
+			return value
+		}
+	}
+	return ""
+}
+
+// Bool returns the value of the boolean option, or false if not given
+func (o InteractionOption) Bool(name string) bool {
+	for _, opt := range o.Options {
+		if opt.Name != name {
+			continue
+		}
+		var value bool
+		if json.Unmarshal(opt.Value, &value) == nil {
+			return value
+		}
+	}
+	return false
+}
+
+// CanManageChannels reports whether the member has Manage Channels in the channel
+func (i Interaction) CanManageChannels() bool {
+	if i.Member == nil {
+		return false
+	}
+	permissions, err := strconv.ParseInt(i.Member.Permissions, 10, 64)
+	if err != nil {
+		return false
+	}
+	return permissions&(discordgo.PermissionManageChannels|discordgo.PermissionAdministrator) != 0
+}
+
+func bridgeCommand(lc *locale.Catalog) ApplicationCommand {
+	return ApplicationCommand{
+		Name:        BridgeCommandName,
+		Description: lc.T("bridge.description"),
+		Options: []ApplicationCommandOption{
+			{Type: commandOptionSubCommand, Name: "status", Description: lc.T("bridge.status.description")},
+			{Type: commandOptionSubCommand, Name: "who", Description: lc.T("bridge.who.description")},
+			{Type: commandOptionSubCommand, Name: "calls", Description: lc.T("bridge.calls.description")},
+			{
+				Type: commandOptionSubCommand, Name: "link", Description: lc.T("bridge.link.description"),
+				Options: []ApplicationCommandOption{
+					{Type: commandOptionString, Name: "slack_user", Description: lc.T("bridge.link.slack_user")},
+					{Type: commandOptionString, Name: "code", Description: lc.T("bridge.link.code")},
+					{Type: commandOptionUser, Name: "discord_user", Description: lc.T("bridge.link.discord_user")},
+					{Type: commandOptionBoolean, Name: "confirm", Description: lc.T("bridge.link.confirm")},
+				},
+			},
+			{
+				Type: commandOptionSubCommand, Name: "pause", Description: lc.T("bridge.pause.description"),
+				Options: []ApplicationCommandOption{
+					{Type: commandOptionString, Name: "duration", Description: lc.T("bridge.pause.duration")},
+				},
+			},
+		},
+	}
+}
+
+// registerCommands overwrites the application commands of the guild.
+// GUILD_CREATE comes again on every reconnection, so each guild is registered once.
+func (d *DiscordHandler) registerCommands(s *discordgo.Session, guildID string) error {
+	d.registeredGuildsMutex.Lock()
+	defer d.registeredGuildsMutex.Unlock()
+	if d.registeredGuilds[guildID] {
+		return nil
+	}
+
+	d.applicationIDOnce.Do(func() {
+		app, err := s.Application("@me")
+		if err != nil {
+			log.Printf("GetApplication: %s\n", err.Error())
+			return
+		}
+		d.applicationID = app.ID
+	})
+	if d.applicationID == "" {
+		return errors.New("ApplicationIDUnknown")
+	}
+
+	var endpoint = discordgo.EndpointAPI + "applications/" + d.applicationID + "/guilds/" + guildID + "/commands"
+	_, err := s.RequestWithBucketID(
+		"PUT", endpoint,
+		[]ApplicationCommand{bridgeCommand(d.settings.Locale(guildID))},
+		discordgo.EndpointAPI+"applications/"+d.applicationID+"/guilds/"+guildID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "RegisterCommands")
+	}
+
+	if d.registeredGuilds == nil {
+		d.registeredGuilds = map[string]bool{}
+	}
+	d.registeredGuilds[guildID] = true
+	return nil
+}
+
+// deferResponse acknowledges the interaction with an ephemeral "thinking" message,
+// because the commands may call the Slack API longer than the response deadline
+func (d *DiscordHandler) deferResponse(s *discordgo.Session, i *Interaction) error {
+	var response = map[string]interface{}{
+		"type": interactionResponseDeferred,
+		"data": map[string]interface{}{
+			"flags": interactionResponseEphemeral,
+		},
+	}
+
+	var endpoint = discordgo.EndpointAPI + "interactions/" + i.ID + "/" + i.Token + "/callback"
+	_, err := s.RequestWithBucketID("POST", endpoint, response, discordgo.EndpointAPI+"interactions/")
+	if err != nil {
+		return errors.Wrap(err, "DeferInteraction")
+	}
+	return nil
+}
+
+// respond replaces the deferred response with the content
+func (d *DiscordHandler) respond(s *discordgo.Session, i *Interaction, content string) error {
+	var message = map[string]interface{}{
+		"content":          content,
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+
+	var endpoint = discordgo.EndpointWebhookToken(d.applicationID, i.Token) + "/messages/@original"
+	_, err := s.RequestWithBucketID("PATCH", endpoint, message, discordgo.EndpointWebhookToken("", ""))
+	if err != nil {
+		return errors.Wrap(err, "EditInteractionResponse")
+	}
+	return nil
+}
+
+// interactionCreate handles /bridge commands
+func (d *DiscordHandler) interactionCreate(s *discordgo.Session, i *Interaction) {
+	if i.Type != interactionApplicationCommand || i.Data.Name != BridgeCommandName || len(i.Data.Options) == 0 {
+		return
+	}
+	if i.Member == nil || i.Member.User == nil {
+		// commands in DMs are not supported
+		return
+	}
+
+	var lc = d.settings.Locale(i.GuildID)
+	var sub = i.Data.Options[0]
+
+	err := d.deferResponse(s, i)
+	if err != nil {
+		log.Printf("InteractionRespond: %s\n", err.Error())
+		return
+	}
+
+	var content string
+	switch sub.Name {
+	case "status":
+		content = d.statusCommand(i, lc)
+	case "who":
+		content = d.whoCommand(i, lc)
+	case "calls":
+		content = d.callsCommand(i, lc)
+	case "link":
+		content = d.linkCommand(i, sub, lc)
+	case "pause":
+		content = d.pauseCommand(i, sub, lc)
+	default:
+		content = lc.T("bridge.usage")
+	}
+
+	err = d.respond(s, i, content)
+	if err != nil {
+		log.Printf("InteractionRespond: %s\n", err.Error())
+	}
+}
+
+// statusCommand shows the mapping of the channel
+func (d *DiscordHandler) statusCommand(i *Interaction, lc *locale.Catalog) string {
+	cs := d.settings.FindSlackChannel(i.ChannelID, i.GuildID)
+	if cs.SlackChannel == "" {
+		return lc.T("bridge.not_bridged")
+	}
+
+	var lines = []string{
+		lc.T("bridge.status.mapping", d.slackChannelName(cs.SlackChannel),
+			onOff(cs.Setting.DiscordToSlack, lc), onOff(cs.Setting.SlackToDiscord, lc)),
+	}
+
+	if paused, until := d.pauses.Paused(cs.SlackChannel); paused {
+		if until.IsZero() {
+			lines = append(lines, lc.T("command.status.paused"))
+		} else {
+			lines = append(lines, lc.T("command.status.paused_until", discordDate(until)))
+		}
+	}
+
+	for _, link := range d.messageLinks.RecentChannels(time.Time{}, MessageLinksMax) {
+		if link.DiscordChannel == i.ChannelID {
+			lines = append(lines, lc.T("command.status.last_message", discordDate(link.Created)))
+			break
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// whoCommand shows the active members of the linked Slack channel
+func (d *DiscordHandler) whoCommand(i *Interaction, lc *locale.Catalog) string {
+	cs := d.settings.FindSlackChannel(i.ChannelID, i.GuildID)
+	if cs.SlackChannel == "" {
+		return lc.T("bridge.not_bridged")
+	}
+
+	members, err := d.slackHook.GetConversationMembers(cs.SlackChannel, BridgeWhoMaxMembers)
+	if err != nil {
+		log.Printf("GetConversationMembers: %s\n", err.Error())
+		return lc.T("bridge.error", err.Error())
+	}
+
+	// the members are checked a few at a time, keeping their order
+	var found = make([]string, len(members))
+	var wg sync.WaitGroup
+	var limit = make(chan struct{}, BridgeWhoConcurrency)
+	for i, member := range members {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(i int, member string) {
+			defer wg.Done()
+			defer func() { <-limit }()
+			found[i] = d.slackMembers.activeName(d.slackHook, member)
+		}(i, member)
+	}
+	wg.Wait()
+
+	var names = []string{}
+	for _, name := range found {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	var channelName = d.slackChannelName(cs.SlackChannel)
+	if len(names) == 0 {
+		return lc.T("bridge.who.nobody", channelName)
+	}
+	return lc.T("bridge.who.active", channelName, strings.Join(names, ", "))
+}
+
+// callsCommand shows the latest voice sessions of the guild
+func (d *DiscordHandler) callsCommand(i *Interaction, lc *locale.Catalog) string {
+	sessions, err := d.voiceSessions.Sessions(i.GuildID, "", now().Add(-BridgeCallsPeriod))
+	if err != nil {
+		log.Printf("VoiceSessions: %s\n", err.Error())
+		return lc.T("bridge.error", err.Error())
+	}
+	if len(sessions) == 0 {
+		return lc.T("bridge.calls.none")
+	}
+
+	// the sessions are stored in the order they ended
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Start.After(sessions[j].Start)
+	})
+	if len(sessions) > BridgeCallsMax {
+		sessions = sessions[:BridgeCallsMax]
+	}
+
+	var lines = []string{}
+	for _, session := range sessions {
+		lines = append(lines, lc.T("bridge.calls.session",
+			session.ChannelID, discordDate(session.Start),
+			formatDuration(session.Duration(), lc), len(session.Participants),
+		))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// linkCommand links the Discord user to a Slack user.
+// The user confirms it with a code sent to the Slack user, or an admin links another member directly.
+func (d *DiscordHandler) linkCommand(i *Interaction, sub InteractionOption, lc *locale.Catalog) string {
+	var discordUser = i.Member.User.ID
+	var slackUser = sub.String("slack_user")
+	var code = sub.String("code")
+
+	if target := sub.String("discord_user"); target != "" {
+		if !i.CanManageChannels() {
+			return lc.T("bridge.forbidden")
+		}
+		if slackUser == "" {
+			return lc.T("bridge.link.usage")
+		}
+
+		// the admin confirms the Slack user found by the ID before linking
+		var name = d.slackUserName(slackUser)
+		if name == "" {
+			return lc.T("bridge.link.user_not_found", slackUser)
+		}
+		if !sub.Bool("confirm") {
+			return lc.T("bridge.link.confirm_admin", name, slackUser, target, slackUser, target)
+		}
+
+		var link = UserLink{DiscordUser: target, SlackUser: slackUser}
+		if old, ok := d.userLinks.FindByDiscord(target); ok {
+			link.VoiceStatus = old.VoiceStatus
+			link.StatusEmoji = old.StatusEmoji
+		}
+		d.userLinks.Set(link)
+		return lc.T("bridge.link.linked", name)
+	}
+
+	switch {
+	case code != "":
+		link, ok := d.linkCodes.Confirm(code, func(link UserLink) bool {
+			return link.DiscordUser == discordUser
+		})
+		if !ok {
+			return lc.T("command.link.invalid_code")
+		}
+		if old, ok := d.userLinks.FindByDiscord(discordUser); ok {
+			link.VoiceStatus = old.VoiceStatus
+			link.SlackToken = old.SlackToken
+			link.StatusEmoji = old.StatusEmoji
+		}
+		d.userLinks.Set(link)
+		return lc.T("bridge.link.linked", d.slackUserName(link.SlackUser))
+
+	case slackUser != "":
+		var name = d.slackUserName(slackUser)
+		if name == "" {
+			return lc.T("bridge.link.user_not_found", slackUser)
+		}
+
+		code, err := d.linkCodes.Issue(UserLink{DiscordUser: discordUser, SlackUser: slackUser})
+		if err == ErrorLinkCodeTooSoon {
+			return lc.T("command.link.too_soon")
+		}
+		if err != nil {
+			log.Printf("IssueLinkCode: %s\n", err.Error())
+			return lc.T("command.link.dm_failed", err.Error())
+		}
+
+		_, err = d.slackHook.Send(slack_webhook.Message{
+			Channel: slackUser,
+			Text:    lc.T("bridge.link.dm", i.Member.User.String(), code),
+		})
+		if err != nil {
+			return lc.T("command.link.dm_failed", err.Error())
+		}
+		return lc.T("bridge.link.code_sent", name)
+
+	default:
+		link, ok := d.userLinks.FindByDiscord(discordUser)
+		if !ok {
+			return lc.T("bridge.link.usage")
+		}
+		return lc.T("bridge.link.current", d.slackUserName(link.SlackUser), onOff(link.VoiceStatus, lc))
+	}
+}
+
+// pauseCommand pauses relaying in the channel. It needs Manage Channels.
+func (d *DiscordHandler) pauseCommand(i *Interaction, sub InteractionOption, lc *locale.Catalog) string {
+	if !i.CanManageChannels() {
+		return lc.T("bridge.forbidden")
+	}
+
+	cs := d.settings.FindSlackChannel(i.ChannelID, i.GuildID)
+	if cs.SlackChannel == "" {
+		return lc.T("bridge.not_bridged")
+	}
+
+	var duration = sub.String("duration")
+	switch duration {
+	case "":
+		d.pauses.Pause(cs.SlackChannel, 0)
+		return lc.T("bridge.pause.paused")
+	case "off":
+		d.pauses.Resume(cs.SlackChannel)
+		return lc.T("command.mute.resumed")
+	}
+
+	dur, err := time.ParseDuration(duration)
+	if err != nil || dur <= 0 {
+		return lc.T("command.mute.invalid")
+	}
+	d.pauses.Pause(cs.SlackChannel, dur)
+	return lc.T("command.mute.paused_for", formatDuration(dur, lc))
+}
+
+// slackMemberCache keeps the presence and the names of Slack users for /bridge who
+type slackMemberCache struct {
+	members map[string]slackMember
+	mu      sync.Mutex
+}
+
+type slackMember struct {
+	presence        string
+	presenceFetched time.Time
+
+	// name is empty for bots
+	name        string
+	userFetched time.Time
+}
+
+// activeName returns the name of the Slack user if the user is active, or ""
+func (c *slackMemberCache) activeName(hook *slack_webhook.Handler, userID string) string {
+	c.mu.Lock()
+	if c.members == nil {
+		c.members = map[string]slackMember{}
+	}
+	var member = c.members[userID]
+	c.mu.Unlock()
+
+	if time.Since(member.presenceFetched) > BridgeWhoPresenceTTL {
+		presence, err := hook.GetUserPresence(userID)
+		if err != nil {
+			log.Printf("GetUserPresence: %s\n", err.Error())
+			return ""
+		}
+		member.presence, member.presenceFetched = presence, time.Now()
+	}
+
+	if member.presence == "active" && time.Since(member.userFetched) > BridgeWhoUserTTL {
+		user, err := hook.GetUserInfo(userID)
+		if err != nil {
+			log.Printf("GetUserInfo: %s\n", err.Error())
+			return ""
+		}
+		member.name, member.userFetched = "", time.Now()
+		if !user.IsBot {
+			member.name = user.Profile.DisplayName
+			if member.name == "" {
+				member.name = user.RealName
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.members[userID] = member
+	c.mu.Unlock()
+
+	if member.presence != "active" {
+		return ""
+	}
+	return member.name
+}
+
+func (d *DiscordHandler) slackChannelName(channelID string) string {
+	channel, err := d.slackHook.GetConversationInfo(channelID)
+	if err != nil {
+		return channelID
+	}
+	return "#" + channel.Name
+}
+
+func discordDate(t time.Time) string {
+	return fmt.Sprintf("<t:%d:f>", t.Unix())
+}
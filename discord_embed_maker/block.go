@@ -0,0 +1,91 @@
+package discord_embed_maker
+
+import "encoding/json"
+
+// Block is a Slack Block Kit block as received from the Events API
+type Block struct {
+	Type      string        `json:"type"`
+	Text      *TextObject   `json:"text,omitempty"`
+	Fields    []*TextObject `json:"fields,omitempty"`
+	Accessory *Element      `json:"accessory,omitempty"`
+	Elements  []Element     `json:"elements,omitempty"`
+	ImageURL  string        `json:"image_url,omitempty"`
+	AltText   string        `json:"alt_text,omitempty"`
+	Title     *TextObject   `json:"title,omitempty"`
+}
+
+// TextObject is a plain_text or mrkdwn composition object
+type TextObject struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Element is a block element, or a rich text element
+type Element struct {
+	Type      string          `json:"type"`
+	Text      json.RawMessage `json:"text,omitempty"`
+	URL       string          `json:"url,omitempty"`
+	ImageURL  string          `json:"image_url,omitempty"`
+	AltText   string          `json:"alt_text,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Unicode   string          `json:"unicode,omitempty"`
+	UserID    string          `json:"user_id,omitempty"`
+	ChannelID string          `json:"channel_id,omitempty"`
+	Range     string          `json:"range,omitempty"`
+	Style     json.RawMessage `json:"style,omitempty"`
+	Indent    int             `json:"indent,omitempty"`
+	Elements  []Element       `json:"elements,omitempty"`
+}
+
+type textStyle struct {
+	Bold   bool `json:"bold"`
+	Italic bool `json:"italic"`
+	Strike bool `json:"strike"`
+	Code   bool `json:"code"`
+}
+
+// ParseBlocks parses the blocks field of a raw Slack message
+func ParseBlocks(message json.RawMessage) []Block {
+	var attr struct {
+		Blocks []Block `json:"blocks"`
+	}
+
+	err := json.Unmarshal(message, &attr)
+	if err != nil {
+		return nil
+	}
+
+	return attr.Blocks
+}
+
+// text returns the text of the element, which is a string in rich text
+// and in context elements, and a text object in buttons
+func (e Element) text() string {
+	if len(e.Text) == 0 {
+		return ""
+	}
+
+	var text string
+	if json.Unmarshal(e.Text, &text) == nil {
+		return text
+	}
+
+	var object TextObject
+	if json.Unmarshal(e.Text, &object) == nil {
+		return object.Text
+	}
+
+	return ""
+}
+
+func (e Element) textStyle() textStyle {
+	var style textStyle
+	json.Unmarshal(e.Style, &style)
+	return style
+}
+
+func (e Element) listStyle() string {
+	var style string
+	json.Unmarshal(e.Style, &style)
+	return style
+}
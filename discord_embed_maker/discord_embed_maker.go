@@ -0,0 +1,471 @@
+package discord_embed_maker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/emoji"
+	"github.com/slack-go/slack"
+)
+
+// Discord rejects messages with embeds over these sizes
+const (
+	MaxEmbeds            = 10
+	MaxTitleLength       = 256
+	MaxDescriptionLength = 4096
+	MaxFields            = 25
+	MaxFieldNameLength   = 256
+	MaxFieldValueLength  = 1024
+	MaxFooterLength      = 2048
+	MaxAuthorLength      = 256
+	MaxTotalLength       = 6000
+)
+
+// emptyFieldName is used for fields which have no title, since Discord requires one
+const emptyFieldName = "\u200b"
+
+var attachmentColors = map[string]int{
+	"good":    0x2eb886,
+	"warning": 0xdaa038,
+	"danger":  0xa30200,
+}
+
+// FromAttachments converts Slack legacy attachments into Discord embeds
+func FromAttachments(attachments []slack.Attachment, resolveUser func(userID string) string) []*discordgo.MessageEmbed {
+	var embeds = []*discordgo.MessageEmbed{}
+
+	for _, attachment := range attachments {
+		var embed = &discordgo.MessageEmbed{
+			Type:  discordgo.EmbedTypeRich,
+			Title: attachment.Title,
+			URL:   attachment.TitleLink,
+			Color: parseColor(attachment.Color),
+		}
+
+		var description = []string{}
+		if attachment.Pretext != "" {
+			description = append(description, ToMarkdown(attachment.Pretext, resolveUser))
+		}
+		if attachment.Text != "" {
+			description = append(description, ToMarkdown(attachment.Text, resolveUser))
+		}
+		for _, action := range attachment.Actions {
+			if action.URL != "" {
+				description = append(description, fmt.Sprintf("[%s](%s)", action.Text, action.URL))
+			}
+		}
+		embed.Description = strings.Join(description, "\n")
+
+		if attachment.AuthorName != "" {
+			embed.Author = &discordgo.MessageEmbedAuthor{
+				Name:    attachment.AuthorName,
+				URL:     attachment.AuthorLink,
+				IconURL: attachment.AuthorIcon,
+			}
+		} else if attachment.ServiceName != "" {
+			embed.Author = &discordgo.MessageEmbedAuthor{
+				Name:    attachment.ServiceName,
+				URL:     attachment.FromURL,
+				IconURL: attachment.ServiceIcon,
+			}
+		}
+
+		for _, field := range attachment.Fields {
+			var name = field.Title
+			if name == "" {
+				name = emptyFieldName
+			}
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:   name,
+				Value:  ToMarkdown(field.Value, resolveUser),
+				Inline: field.Short,
+			})
+		}
+
+		if attachment.ImageURL != "" {
+			embed.Image = &discordgo.MessageEmbedImage{URL: attachment.ImageURL}
+		}
+		if attachment.ThumbURL != "" {
+			embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: attachment.ThumbURL}
+		}
+
+		if attachment.Footer != "" {
+			embed.Footer = &discordgo.MessageEmbedFooter{
+				Text:    slackUnescaper.Replace(attachment.Footer),
+				IconURL: attachment.FooterIcon,
+			}
+		}
+
+		if attachment.Ts != "" {
+			ts, err := attachment.Ts.Float64()
+			if err == nil {
+				embed.Timestamp = time.Unix(int64(ts), 0).Format(time.RFC3339)
+			}
+		}
+
+		if len(attachment.Blocks.BlockSet) > 0 {
+			var blockEmbeds = FromBlocks(attachmentBlocks(attachment), resolveUser)
+			if len(blockEmbeds) > 0 {
+				blockEmbeds[0].Color = embed.Color
+			}
+			if isEmpty(embed) {
+				embeds = append(embeds, blockEmbeds...)
+				continue
+			}
+			embeds = append(embeds, embed)
+			embeds = append(embeds, blockEmbeds...)
+			continue
+		}
+
+		if isEmpty(embed) {
+			if attachment.Fallback == "" {
+				continue
+			}
+			embed.Description = ToMarkdown(attachment.Fallback, resolveUser)
+		}
+
+		embeds = append(embeds, embed)
+	}
+
+	return embeds
+}
+
+// OnlyRichText reports whether the blocks are the ones Slack clients attach to
+// messages typed by users, whose content is the same as the message text.
+func OnlyRichText(blocks []Block) bool {
+	for _, block := range blocks {
+		if block.Type != "rich_text" {
+			return false
+		}
+	}
+	return true
+}
+
+// FromBlocks converts Slack Block Kit blocks into Discord embeds.
+// The first embed holds the text content, and the others hold additional images.
+// It returns nil when no block could be converted.
+func FromBlocks(blocks []Block, resolveUser func(userID string) string) []*discordgo.MessageEmbed {
+	var embed = &discordgo.MessageEmbed{Type: discordgo.EmbedTypeRich}
+	var imageEmbeds = []*discordgo.MessageEmbed{}
+	var description = []string{}
+
+	for i, block := range blocks {
+		switch block.Type {
+		case "header":
+			if block.Text == nil {
+				continue
+			}
+			if embed.Title == "" {
+				embed.Title = block.Text.Text
+			} else {
+				description = append(description, "**"+block.Text.Text+"**")
+			}
+		case "section":
+			if block.Text != nil {
+				description = append(description, textObject(block.Text, resolveUser))
+			}
+			for _, field := range block.Fields {
+				if field == nil {
+					continue
+				}
+				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+					Name:   emptyFieldName,
+					Value:  textObject(field, resolveUser),
+					Inline: true,
+				})
+			}
+			if block.Accessory != nil {
+				switch block.Accessory.Type {
+				case "image":
+					if embed.Thumbnail == nil {
+						embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: block.Accessory.ImageURL}
+					}
+				case "button":
+					if block.Accessory.URL != "" {
+						description = append(description, fmt.Sprintf("[%s](%s)", block.Accessory.text(), block.Accessory.URL))
+					}
+				}
+			}
+		case "context":
+			var texts = []string{}
+			var icon string
+			for _, element := range block.Elements {
+				switch element.Type {
+				case "mrkdwn":
+					texts = append(texts, ToMarkdown(element.text(), resolveUser))
+				case "plain_text":
+					texts = append(texts, element.text())
+				case "image":
+					if icon == "" {
+						icon = element.ImageURL
+					}
+				}
+			}
+			// the last context looks like a footer
+			if i == len(blocks)-1 && embed.Footer == nil {
+				embed.Footer = &discordgo.MessageEmbedFooter{
+					Text:    strings.ReplaceAll(strings.Join(texts, "  "), "**", ""),
+					IconURL: icon,
+				}
+				continue
+			}
+			if len(texts) > 0 {
+				description = append(description, "*"+strings.Join(texts, "  ")+"*")
+			}
+		case "divider":
+			if len(description) > 0 {
+				description = append(description, "")
+			}
+		case "image":
+			if block.Title != nil && block.Title.Text != "" {
+				description = append(description, "**"+block.Title.Text+"**")
+			}
+			if embed.Image == nil {
+				embed.Image = &discordgo.MessageEmbedImage{URL: block.ImageURL}
+				continue
+			}
+			imageEmbeds = append(imageEmbeds, &discordgo.MessageEmbed{
+				Type:  discordgo.EmbedTypeRich,
+				Image: &discordgo.MessageEmbedImage{URL: block.ImageURL},
+			})
+		case "rich_text":
+			description = append(description, richText(block.Elements, resolveUser))
+		case "actions":
+			var links = []string{}
+			for _, element := range block.Elements {
+				if element.Type == "button" && element.URL != "" {
+					links = append(links, fmt.Sprintf("[%s](%s)", element.text(), element.URL))
+				}
+			}
+			if len(links) > 0 {
+				description = append(description, strings.Join(links, " | "))
+			}
+		default:
+			// unsupported blocks are shown by their text if they have one
+			if block.Text != nil && block.Text.Text != "" {
+				description = append(description, textObject(block.Text, resolveUser))
+			}
+		}
+	}
+
+	embed.Description = strings.TrimSpace(strings.Join(description, "\n"))
+
+	if isEmpty(embed) && len(imageEmbeds) == 0 {
+		return nil
+	}
+
+	return append([]*discordgo.MessageEmbed{embed}, imageEmbeds...)
+}
+
+// Limit cuts embeds so that they fit in Discord limits
+func Limit(embeds []*discordgo.MessageEmbed) []*discordgo.MessageEmbed {
+	if len(embeds) > MaxEmbeds {
+		embeds = embeds[:MaxEmbeds]
+	}
+
+	var total int
+	for i, embed := range embeds {
+		embed.Title = truncate(embed.Title, MaxTitleLength)
+		embed.Description = truncate(embed.Description, MaxDescriptionLength)
+		if embed.Author != nil {
+			embed.Author.Name = truncate(embed.Author.Name, MaxAuthorLength)
+		}
+		if embed.Footer != nil {
+			embed.Footer.Text = truncate(embed.Footer.Text, MaxFooterLength)
+		}
+		if len(embed.Fields) > MaxFields {
+			embed.Fields = embed.Fields[:MaxFields]
+		}
+		for _, field := range embed.Fields {
+			field.Name = truncate(field.Name, MaxFieldNameLength)
+			field.Value = truncate(field.Value, MaxFieldValueLength)
+			if field.Value == "" {
+				field.Value = emptyFieldName
+			}
+		}
+
+		var size = length(embed)
+		if total+size <= MaxTotalLength {
+			total += size
+			continue
+		}
+
+		// shorten the description, or drop this and the following embeds
+		var over = total + size - MaxTotalLength
+		var descriptionLength = utf8.RuneCountInString(embed.Description)
+		if descriptionLength <= over {
+			return embeds[:i]
+		}
+		embed.Description = truncate(embed.Description, descriptionLength-over)
+		return embeds[:i+1]
+	}
+
+	return embeds
+}
+
+func richText(elements []Element, resolveUser func(userID string) string) string {
+	var paragraphs = []string{}
+
+	for _, element := range elements {
+		switch element.Type {
+		case "rich_text_section":
+			paragraphs = append(paragraphs, richTextInline(element.Elements, resolveUser))
+		case "rich_text_list":
+			for i, item := range element.Elements {
+				var marker = "-"
+				if element.listStyle() == "ordered" {
+					marker = strconv.Itoa(i+1) + "."
+				}
+				paragraphs = append(paragraphs,
+					strings.Repeat("  ", element.Indent)+marker+" "+richTextInline(item.Elements, resolveUser),
+				)
+			}
+		case "rich_text_quote":
+			var lines = strings.Split(richTextInline(element.Elements, resolveUser), "\n")
+			paragraphs = append(paragraphs, "> "+strings.Join(lines, "\n> "))
+		case "rich_text_preformatted":
+			var code strings.Builder
+			for _, inline := range element.Elements {
+				code.WriteString(inline.text())
+				if inline.Type == "link" && inline.text() == "" {
+					code.WriteString(inline.URL)
+				}
+			}
+			paragraphs = append(paragraphs, "```\n"+code.String()+"\n```")
+		}
+	}
+
+	return strings.Join(paragraphs, "\n")
+}
+
+func richTextInline(elements []Element, resolveUser func(userID string) string) string {
+	var result strings.Builder
+
+	for _, element := range elements {
+		switch element.Type {
+		case "text":
+			result.WriteString(styled(element.text(), element.textStyle()))
+		case "link":
+			if element.text() == "" {
+				result.WriteString(element.URL)
+			} else {
+				result.WriteString(fmt.Sprintf("[%s](%s)", element.text(), element.URL))
+			}
+		case "emoji":
+			result.WriteString(emojiText(element))
+		case "user":
+			var name = element.UserID
+			if resolveUser != nil {
+				if resolved := resolveUser(element.UserID); resolved != "" {
+					name = resolved
+				}
+			}
+			result.WriteString("@" + name)
+		case "usergroup":
+			result.WriteString("@usergroup")
+		case "channel":
+			result.WriteString("#" + element.ChannelID)
+		case "broadcast":
+			result.WriteString("@" + element.Range)
+		}
+	}
+
+	return result.String()
+}
+
+func styled(text string, style textStyle) string {
+	if strings.TrimSpace(text) == "" {
+		return text
+	}
+	if style.Code {
+		return "`" + text + "`"
+	}
+	if style.Bold {
+		text = "**" + text + "**"
+	}
+	if style.Italic {
+		text = "*" + text + "*"
+	}
+	if style.Strike {
+		text = "~~" + text + "~~"
+	}
+	return text
+}
+
+func emojiText(element Element) string {
+	if element.Unicode == "" {
+		if unicode, ok := emoji.Unicode(element.Name); ok {
+			return unicode
+		}
+		return ":" + element.Name + ":"
+	}
+
+	var result strings.Builder
+	for _, code := range strings.Split(element.Unicode, "-") {
+		r, err := strconv.ParseInt(code, 16, 32)
+		if err != nil {
+			return ":" + element.Name + ":"
+		}
+		result.WriteRune(rune(r))
+	}
+	return result.String()
+}
+
+func textObject(text *TextObject, resolveUser func(userID string) string) string {
+	if text.Type == "plain_text" {
+		return text.Text
+	}
+	return ToMarkdown(text.Text, resolveUser)
+}
+
+func attachmentBlocks(attachment slack.Attachment) []Block {
+	b, err := attachment.Blocks.MarshalJSON()
+	if err != nil {
+		return nil
+	}
+	return ParseBlocks([]byte(`{"blocks":` + string(b) + `}`))
+}
+
+func parseColor(color string) int {
+	if c, ok := attachmentColors[color]; ok {
+		return c
+	}
+
+	c, err := strconv.ParseInt(strings.TrimPrefix(color, "#"), 16, 32)
+	if err != nil {
+		return 0
+	}
+	return int(c)
+}
+
+func isEmpty(embed *discordgo.MessageEmbed) bool {
+	return embed.Title == "" && embed.Description == "" && len(embed.Fields) == 0 &&
+		embed.Image == nil && embed.Thumbnail == nil && embed.Author == nil && embed.Footer == nil
+}
+
+func length(embed *discordgo.MessageEmbed) int {
+	var size = utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	if embed.Author != nil {
+		size += utf8.RuneCountInString(embed.Author.Name)
+	}
+	if embed.Footer != nil {
+		size += utf8.RuneCountInString(embed.Footer.Text)
+	}
+	for _, field := range embed.Fields {
+		size += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	return size
+}
+
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	var runes = []rune(text)
+	return string(runes[:max-1]) + "…"
+}
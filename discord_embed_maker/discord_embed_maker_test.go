@@ -0,0 +1,156 @@
+package discord_embed_maker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/slack-go/slack"
+)
+
+func TestFromBlocks(t *testing.T) {
+	var resolveUser = func(userID string) string {
+		return "alice"
+	}
+
+	var cases = []struct {
+		name        string
+		message     string
+		title       string
+		description string
+		footer      string
+		fields      int
+		images      []string
+	}{
+		{
+			name:        "header and section",
+			message:     `{"blocks":[{"type":"header","text":{"type":"plain_text","text":"Title"}},{"type":"section","text":{"type":"mrkdwn","text":"*bold* <@U1>"},"fields":[{"type":"mrkdwn","text":"a"},{"type":"mrkdwn","text":"b"}]}]}`,
+			title:       "Title",
+			description: "**bold** @alice",
+			fields:      2,
+		},
+		{
+			name:        "context at the end is the footer",
+			message:     `{"blocks":[{"type":"section","text":{"type":"plain_text","text":"body"}},{"type":"context","elements":[{"type":"mrkdwn","text":"*note*"}]}]}`,
+			description: "body",
+			footer:      "note",
+		},
+		{
+			name:        "rich text",
+			message:     `{"blocks":[{"type":"rich_text","elements":[{"type":"rich_text_section","elements":[{"type":"text","text":"hi "},{"type":"text","text":"there","style":{"bold":true}},{"type":"emoji","name":"tada","unicode":"1f389"}]},{"type":"rich_text_list","style":"bullet","elements":[{"type":"rich_text_section","elements":[{"type":"text","text":"item"}]}]}]}]}`,
+			description: "hi **there**\U0001F389\n- item",
+		},
+		{
+			name:    "images",
+			message: `{"blocks":[{"type":"image","image_url":"https://example.com/1.png"},{"type":"image","image_url":"https://example.com/2.png"}]}`,
+			images:  []string{"https://example.com/1.png", "https://example.com/2.png"},
+		},
+		{
+			name:    "nothing",
+			message: `{"blocks":[{"type":"divider"}]}`,
+		},
+	}
+
+	for _, c := range cases {
+		var embeds = FromBlocks(ParseBlocks([]byte(c.message)), resolveUser)
+		if c.description == "" && c.title == "" && len(c.images) == 0 {
+			if embeds != nil {
+				t.Errorf("%s: expected no embed, but got %d", c.name, len(embeds))
+			}
+			continue
+		}
+		if len(embeds) == 0 {
+			t.Errorf("%s: expected embeds, but got none", c.name)
+			continue
+		}
+
+		var embed = embeds[0]
+		if embed.Title != c.title {
+			t.Errorf("%s: expected title %q, but got %q", c.name, c.title, embed.Title)
+		}
+		if embed.Description != c.description {
+			t.Errorf("%s: expected description %q, but got %q", c.name, c.description, embed.Description)
+		}
+		var footer string
+		if embed.Footer != nil {
+			footer = embed.Footer.Text
+		}
+		if footer != c.footer {
+			t.Errorf("%s: expected footer %q, but got %q", c.name, c.footer, footer)
+		}
+		if len(embed.Fields) != c.fields {
+			t.Errorf("%s: expected %d fields, but got %d", c.name, c.fields, len(embed.Fields))
+		}
+
+		var images = []string{}
+		for _, e := range embeds {
+			if e.Image != nil {
+				images = append(images, e.Image.URL)
+			}
+		}
+		if strings.Join(images, " ") != strings.Join(c.images, " ") {
+			t.Errorf("%s: expected images %v, but got %v", c.name, c.images, images)
+		}
+	}
+}
+
+func TestFromAttachments(t *testing.T) {
+	var attachments = []slack.Attachment{
+		{
+			Color:    "danger",
+			Title:    "Alert",
+			Pretext:  "pre",
+			Text:     "*down*",
+			Fields:   []slack.AttachmentField{{Title: "", Value: "v", Short: true}},
+			Footer:   "a &amp; b",
+			ImageURL: "https://example.com/i.png",
+		},
+		{Fallback: "only fallback"},
+		{},
+	}
+
+	var embeds = FromAttachments(attachments, nil)
+	if len(embeds) != 2 {
+		t.Fatalf("expected 2 embeds, but got %d", len(embeds))
+	}
+
+	var embed = embeds[0]
+	if embed.Color != 0xa30200 || embed.Title != "Alert" || embed.Description != "pre\n**down**" {
+		t.Errorf("unexpected embed: color %x, title %q, description %q", embed.Color, embed.Title, embed.Description)
+	}
+	if len(embed.Fields) != 1 || embed.Fields[0].Name != emptyFieldName || !embed.Fields[0].Inline {
+		t.Errorf("unexpected fields: %+v", embed.Fields)
+	}
+	if embed.Footer == nil || embed.Footer.Text != "a & b" {
+		t.Errorf("unexpected footer: %+v", embed.Footer)
+	}
+	if embeds[1].Description != "only fallback" {
+		t.Errorf("expected the fallback, but got %q", embeds[1].Description)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	var embeds = []*discordgo.MessageEmbed{}
+	for i := 0; i < MaxEmbeds+2; i++ {
+		embeds = append(embeds, &discordgo.MessageEmbed{
+			Title:       strings.Repeat("t", MaxTitleLength+1),
+			Description: strings.Repeat("d", 2000),
+		})
+	}
+
+	embeds = Limit(embeds)
+	if len(embeds) > MaxEmbeds {
+		t.Errorf("expected at most %d embeds, but got %d", MaxEmbeds, len(embeds))
+	}
+
+	var total int
+	for _, embed := range embeds {
+		if n := len([]rune(embed.Title)); n > MaxTitleLength {
+			t.Errorf("title of %d letters is over the limit", n)
+		}
+		total += length(embed)
+	}
+	if total > MaxTotalLength {
+		t.Errorf("total length %d is over the limit", total)
+	}
+}
@@ -0,0 +1,104 @@
+package discord_embed_maker
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/emoji"
+)
+
+var markdownRegExp = struct {
+	codeBlock   *regexp.Regexp
+	inlineCode  *regexp.Regexp
+	namedLink   *regexp.Regexp
+	bareLink    *regexp.Regexp
+	user        *regexp.Regexp
+	channel     *regexp.Regexp
+	broadcast   *regexp.Regexp
+	bold        *regexp.Regexp
+	strike      *regexp.Regexp
+	discordBold *regexp.Regexp
+}{
+	codeBlock:   regexp.MustCompile("(?s)```.*?```"),
+	inlineCode:  regexp.MustCompile("`[^`\n]+`"),
+	namedLink:   regexp.MustCompile(`<((?:https?|mailto):[^|>]+)\|([^>]+)>`),
+	bareLink:    regexp.MustCompile(`<((?:https?|mailto):[^|>]+)>`),
+	user:        regexp.MustCompile(`<@(\w+)(?:\|([^>]+))?>`),
+	channel:     regexp.MustCompile(`<#(\w+)(?:\|([^>]*))?>`),
+	broadcast:   regexp.MustCompile(`<!(here|channel|everyone)(?:\|[^>]*)?>`),
+	bold:        regexp.MustCompile(`(^|[^\w*])\*([^*\n]+)\*`),
+	strike:      regexp.MustCompile(`(^|[^\w~])~([^~\n]+)~`),
+	discordBold: regexp.MustCompile(`\x00`),
+}
+
+var slackUnescaper = strings.NewReplacer(
+	"&amp;", "&",
+	"&lt;", "<",
+	"&gt;", ">",
+)
+
+// ToMarkdown translates Slack mrkdwn into Discord markdown.
+// resolveUser returns display name of a Slack user, and may be nil.
+func ToMarkdown(text string, resolveUser func(userID string) string) string {
+	var result strings.Builder
+
+	var codes = markdownRegExp.codeBlock.FindAllStringIndex(text, -1)
+	var last int
+	for _, code := range codes {
+		result.WriteString(translateInline(text[last:code[0]], resolveUser))
+		result.WriteString(slackUnescaper.Replace(text[code[0]:code[1]]))
+		last = code[1]
+	}
+	result.WriteString(translateInline(text[last:], resolveUser))
+
+	return result.String()
+}
+
+func translateInline(text string, resolveUser func(userID string) string) string {
+	var result strings.Builder
+
+	var codes = markdownRegExp.inlineCode.FindAllStringIndex(text, -1)
+	var last int
+	for _, code := range codes {
+		result.WriteString(translate(text[last:code[0]], resolveUser))
+		result.WriteString(slackUnescaper.Replace(text[code[0]:code[1]]))
+		last = code[1]
+	}
+	result.WriteString(translate(text[last:], resolveUser))
+
+	return result.String()
+}
+
+func translate(text string, resolveUser func(userID string) string) string {
+	text = markdownRegExp.namedLink.ReplaceAllString(text, "[$2]($1)")
+	text = markdownRegExp.bareLink.ReplaceAllString(text, "$1")
+	text = markdownRegExp.broadcast.ReplaceAllString(text, "@$1")
+
+	text = markdownRegExp.user.ReplaceAllStringFunc(text, func(mention string) string {
+		var match = markdownRegExp.user.FindStringSubmatch(mention)
+		if match[2] != "" {
+			return "@" + match[2]
+		}
+		if resolveUser != nil {
+			if name := resolveUser(match[1]); name != "" {
+				return "@" + name
+			}
+		}
+		return "@" + match[1]
+	})
+
+	text = markdownRegExp.channel.ReplaceAllStringFunc(text, func(mention string) string {
+		var match = markdownRegExp.channel.FindStringSubmatch(mention)
+		if match[2] != "" {
+			return "#" + match[2]
+		}
+		return "#" + match[1]
+	})
+
+	text = markdownRegExp.bold.ReplaceAllString(text, "$1\x00$2\x00")
+	text = markdownRegExp.strike.ReplaceAllString(text, "$1~~$2~~")
+	text = markdownRegExp.discordBold.ReplaceAllString(text, "**")
+	text = emoji.Emojize(text)
+
+	return slackUnescaper.Replace(text)
+}
@@ -0,0 +1,32 @@
+package discord_embed_maker
+
+import "testing"
+
+func TestToMarkdown(t *testing.T) {
+	var users = map[string]string{"U123": "alice"}
+	var resolveUser = func(userID string) string {
+		return users[userID]
+	}
+
+	var cases = []struct {
+		input  string
+		expect string
+	}{
+		{"*bold* and _italic_ and ~strike~", "**bold** and _italic_ and ~~strike~~"},
+		{"<https://example.com|docs> <https://example.com>", "[docs](https://example.com) https://example.com"},
+		{"<@U123> <@U999> <@U1|bob>", "@alice @U999 @bob"},
+		{"<#C123|general> <#C456> <!here>", "#general #C456 @here"},
+		{"a &lt; b &amp;&amp; c &gt; d", "a < b && c > d"},
+		{"`*not bold*` *bold*", "`*not bold*` **bold**"},
+		{"```\n*keep* &lt;\n```", "```\n*keep* <\n```"},
+		{"2*3*4", "2*3*4"},
+		{":tada: :custom_emoji:", "\U0001F389 :custom_emoji:"},
+	}
+
+	for _, c := range cases {
+		var output = ToMarkdown(c.input, resolveUser)
+		if output != c.expect {
+			t.Errorf("ToMarkdown(%q): expected %q, but got %q", c.input, c.expect, output)
+		}
+	}
+}
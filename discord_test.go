@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
+)
+
+func TestPlainReplyGoesToThread(t *testing.T) {
+	var d = NewDiscordBot("", nil)
+	d.SetMessageLinks(NewMessageLinks(filepath.Join(t.TempDir(), "message_links.json")))
+	d.messageLinks.Add(MessageLink{DiscordChannel: "dc", DiscordMessage: "bridged", SlackChannel: "sc", SlackTS: "1.0"})
+
+	var reply = &discordgo.MessageCreate{Message: &discordgo.Message{ID: "reply", ChannelID: "dc", Content: "hello", Author: &discordgo.User{ID: "user"}}}
+	var reference = &discordgo.Message{ID: "bridged", ChannelID: "dc", Content: "original\nsecond line"}
+
+	// a plain reply is not an ss/ command, so it must be relayed
+	if err := d.replaceMessage(reply, reference); err != errNotReplace {
+		t.Fatalf("replaceMessage of a plain reply = %v, want errNotReplace", err)
+	}
+
+	threadTS, content := d.replyThread(locale.Default(), "sc", reference, reply.Content)
+	if threadTS != "1.0" || content != "hello" {
+		t.Errorf("replyThread of a bridged message = %q, %q, want %q, %q", threadTS, content, "1.0", "hello")
+	}
+
+	reference.ID = "unknown"
+	threadTS, content = d.replyThread(locale.Default(), "sc", reference, reply.Content)
+	if threadTS != "" || !strings.HasSuffix(content, "\nhello") || content == "\nhello" {
+		t.Errorf("replyThread of an unbridged message = %q, %q, want the reply quoting it", threadTS, content)
+	}
+}
@@ -11,18 +11,26 @@ import (
 	"net/http"
 	"net/textproto"
 	"net/url"
+	"strconv"
 	"sync"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/pkg/errors"
 )
 
-const DiscordAPIEndpoint = "https://discord.com/api"
+// DiscordAPIEndpoint is a variable to be replaced in tests
+var DiscordAPIEndpoint = "https://discord.com/api"
+
+// ErrorNotEditable is returned by Edit for the messages neither the webhook nor the bot sent
+var ErrorNotEditable = errors.New("NotEditable")
 
 type Handler struct {
 	webhookByChannelID map[string]*discordgo.Webhook
 	createWebhookLock  map[string]*sync.RWMutex
 	token              string
+
+	botID      string
+	botIDMutex sync.Mutex
 }
 
 type File struct {
@@ -181,7 +189,6 @@ func (h *Handler) createChannelWebhook(method, channelID, name string) (*discord
 }
 
 func (h *Handler) send(method, channelID, messageID string, message Message, wait bool, files []File) (newMessage *Message, err error) {
-	var hook = h.Get(channelID)
 	if files == nil {
 		files = []File{}
 	}
@@ -222,6 +229,22 @@ func (h *Handler) send(method, channelID, messageID string, message Message, wai
 	var req *http.Request
 	switch method {
 	case "EDIT":
+		if message.Message != nil && message.ID != "" && message.WebhookID == "" {
+			// replies are sent by the bot, and only the bot can edit them
+			req, err = http.NewRequest(
+				"PATCH",
+				fmt.Sprintf("%s/channels/%s/messages/%s",
+					DiscordAPIEndpoint, channelID, messageID,
+				),
+				body,
+			)
+			if err == nil {
+				req.Header.Set("Authorization", "Bot "+h.token)
+			}
+			break
+		}
+
+		var hook = h.Get(channelID)
 		req, err = http.NewRequest(
 			"PATCH",
 			fmt.Sprintf("%s/webhooks/%s/%s/messages/%s",
@@ -230,6 +253,7 @@ func (h *Handler) send(method, channelID, messageID string, message Message, wai
 			body,
 		)
 	case "SEND":
+		var hook = h.Get(channelID)
 		var reqURI = fmt.Sprintf("%s/webhooks/%s/%s",
 			DiscordAPIEndpoint, hook.ID, hook.Token,
 		)
@@ -241,6 +265,18 @@ func (h *Handler) send(method, channelID, messageID string, message Message, wai
 			reqURI,
 			body,
 		)
+	case "REPLY":
+		// webhooks cannot reply, so replies are sent by the bot
+		req, err = http.NewRequest(
+			"POST",
+			fmt.Sprintf("%s/channels/%s/messages",
+				DiscordAPIEndpoint, channelID,
+			),
+			body,
+		)
+		if err == nil {
+			req.Header.Set("Authorization", "Bot "+h.token)
+		}
 	}
 
 	if err != nil {
@@ -255,6 +291,11 @@ func (h *Handler) send(method, channelID, messageID string, message Message, wai
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		buf, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s body: %s", method, resp.Status, buf)
+	}
+
 	var responseAttr Message
 
 	var buf []byte
@@ -295,14 +336,113 @@ func (h *Handler) Get(channelID string) *discordgo.Webhook {
 	return webhook
 }
 
+// Edit edits the message. The attachments in message.Attachments are kept by their IDs, and files are added to them.
+// Messages sent by Reply are edited by the bot instead of the webhook, and the other messages return ErrorNotEditable.
 func (h *Handler) Edit(channelID, messageID string, message Message, files []File) (*Message, error) {
+	if message.Message != nil && message.ID != "" && !h.Editable(message.Message) {
+		return nil, ErrorNotEditable
+	}
+
+	if message.Attachments != nil {
+		// new files are referred by their indexes next to the kept attachments
+		var attachments = append([]Attachment{}, message.Attachments...)
+		for i, file := range files {
+			attachments = append(attachments, Attachment{ID: strconv.Itoa(i), Filename: file.FileName})
+		}
+		message.Attachments = attachments
+	}
+
 	return h.send("EDIT", channelID, messageID, message, false, files)
 }
 
+// Editable reports whether the message was sent by the webhook or by the bot, which Edit can edit
+func (h *Handler) Editable(message *discordgo.Message) bool {
+	if message.WebhookID != "" {
+		return true
+	}
+	if message.Author == nil {
+		return false
+	}
+
+	botID, err := h.BotID()
+	if err != nil {
+		log.Printf("GetBotID: %s\n", err.Error())
+		return false
+	}
+	return message.Author.ID == botID
+}
+
+// BotID returns the user ID of the bot, which is requested only once
+func (h *Handler) BotID() (string, error) {
+	h.botIDMutex.Lock()
+	defer h.botIDMutex.Unlock()
+
+	if h.botID != "" {
+		return h.botID, nil
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/users/@me", DiscordAPIEndpoint), nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bot "+h.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "ReadAll")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GetCurrentUser: %s body: %s", resp.Status, body)
+	}
+
+	var user discordgo.User
+	err = json.Unmarshal(body, &user)
+	if err != nil {
+		return "", fmt.Errorf("UnmarshalJSON: %s body: %s", err.Error(), body)
+	}
+
+	h.botID = user.ID
+	return h.botID, nil
+}
+
+// KeepAttachments makes the attachments to be kept on Edit, of those keep reports true
+func KeepAttachments(attachments []*discordgo.MessageAttachment, keep func(attachment *discordgo.MessageAttachment) bool) []Attachment {
+	var kept = []Attachment{}
+	for _, attach := range attachments {
+		if attach == nil || !keep(attach) {
+			continue
+		}
+
+		kept = append(kept, Attachment{
+			URL:      attach.URL,
+			ID:       attach.ID,
+			ProxyURL: attach.ProxyURL,
+			Filename: attach.Filename,
+			Width:    attach.Width,
+			Height:   attach.Height,
+			Size:     attach.Size,
+		})
+	}
+	return kept
+}
+
 func (h *Handler) Send(channelID string, message Message, wait bool, files []File) (*Message, error) {
 	return h.send("SEND", channelID, "", message, wait, files)
 }
 
+// Reply sends the message as a reply to message.MessageReference by the bot
+func (h *Handler) Reply(channelID string, message Message, files []File) (*Message, error) {
+	return h.send("REPLY", channelID, "", message, false, files)
+}
+
 func (h *Handler) GetGuildChannels(guildID string) (channels []discordgo.Channel, err error) {
 	var client = http.DefaultClient
 	req, err := http.NewRequest(
@@ -418,3 +558,39 @@ func (h *Handler) GetMessages(channelID string, around string) (messages []disco
 
 	return responseAttr, nil
 }
+
+func (h *Handler) GetChannel(channelID string) (channel discordgo.Channel, err error) {
+	var client = http.DefaultClient
+	req, err := http.NewRequest(
+		"GET",
+		fmt.Sprintf("%s/channels/%s", DiscordAPIEndpoint, channelID),
+		nil,
+	)
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Authorization", "Bot "+h.token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return channel, errors.Wrap(err, "ReadAll")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return channel, fmt.Errorf("GetChannel: %s body: %s", resp.Status, body)
+	}
+
+	err = json.Unmarshal(body, &channel)
+	if err != nil {
+		return channel, fmt.Errorf("UnmarshalJSON: %s body: %s", err.Error(), body)
+	}
+
+	return
+}
@@ -0,0 +1,132 @@
+package discord_webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestEditAttachments(t *testing.T) {
+	type request struct {
+		path    string
+		auth    string
+		payload Message
+		files   []string
+	}
+	var requests = []request{}
+
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req = request{path: r.Method + " " + r.URL.Path, auth: r.Header.Get("Authorization")}
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			b, _ := ioutil.ReadAll(part)
+			if part.FormName() == "payload_json" {
+				if err := json.Unmarshal(b, &req.payload); err != nil {
+					t.Error(err)
+				}
+				continue
+			}
+			req.files = append(req.files, part.FormName()+"="+part.FileName())
+		}
+
+		requests = append(requests, req)
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer server.Close()
+
+	var endpoint = DiscordAPIEndpoint
+	DiscordAPIEndpoint = server.URL
+	defer func() { DiscordAPIEndpoint = endpoint }()
+
+	var h = New("token")
+	h.webhookByChannelID["channel"] = &discordgo.Webhook{ID: "hook", Token: "secret"}
+	h.botID = "bot"
+
+	var files = []File{
+		{FileName: "a.png", Reader: strings.NewReader("a"), ContentType: "image/png"},
+		{FileName: "b.gif", Reader: strings.NewReader("b"), ContentType: "image/gif"},
+	}
+	var kept = []Attachment{{ID: "100", Filename: "kept.txt"}}
+
+	var message = Message{Message: &discordgo.Message{ID: "1", WebhookID: "hook"}, Attachments: kept}
+	_, err := h.Edit("channel", "1", message, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a reply sent by the bot is edited by the bot
+	message = Message{Message: &discordgo.Message{ID: "2", Author: &discordgo.User{ID: "bot"}}, Attachments: []Attachment{}}
+	_, err = h.Edit("channel", "2", message, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the originals kept on Discord cannot be edited
+	message = Message{Message: &discordgo.Message{ID: "3", Author: &discordgo.User{ID: "user"}}}
+	_, err = h.Edit("channel", "3", message, nil)
+	if err != ErrorNotEditable {
+		t.Fatalf("err = %v, want ErrorNotEditable", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+
+	var webhookEdit = requests[0]
+	if webhookEdit.path != "PATCH /webhooks/hook/secret/messages/1" || webhookEdit.auth != "" {
+		t.Errorf("request = %s with %q, want the webhook edit", webhookEdit.path, webhookEdit.auth)
+	}
+	var ids = []string{}
+	for _, attach := range webhookEdit.payload.Attachments {
+		ids = append(ids, attach.ID+":"+attach.Filename)
+	}
+	if got, want := strings.Join(ids, " "), "100:kept.txt 0:a.png 1:b.gif"; got != want {
+		t.Errorf("attachments = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(webhookEdit.files, " "), "files[0]=a.png files[1]=b.gif"; got != want {
+		t.Errorf("files = %q, want %q", got, want)
+	}
+
+	var botEdit = requests[1]
+	if botEdit.path != "PATCH /channels/channel/messages/2" || botEdit.auth != "Bot token" {
+		t.Errorf("request = %s with %q, want the bot edit", botEdit.path, botEdit.auth)
+	}
+	if botEdit.payload.Attachments == nil || len(botEdit.payload.Attachments) != 0 {
+		t.Errorf("attachments = %+v, want an empty list removing all", botEdit.payload.Attachments)
+	}
+}
+
+func TestSendStatus(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"Missing Permissions","code":50013}`))
+	}))
+	defer server.Close()
+
+	var endpoint = DiscordAPIEndpoint
+	DiscordAPIEndpoint = server.URL
+	defer func() { DiscordAPIEndpoint = endpoint }()
+
+	var h = New("token")
+	h.webhookByChannelID["channel"] = &discordgo.Webhook{ID: "hook", Token: "secret"}
+
+	var message = Message{Message: &discordgo.Message{ID: "1", WebhookID: "hook"}}
+	newMessage, err := h.Edit("channel", "1", message, nil)
+	if err == nil || newMessage != nil {
+		t.Errorf("Edit = %+v, %v, want an error", newMessage, err)
+	}
+}
@@ -0,0 +1,194 @@
+// Package emoji translates between Slack emoji shortcodes and Unicode emoji,
+// which Discord uses as the names of standard emoji.
+package emoji
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	codemap "github.com/kyokomi/emoji"
+)
+
+// SkinToneModifiers are the Unicode modifiers of the Slack skin tones "skin-tone-2" to "skin-tone-6"
+var SkinToneModifiers = []string{"\U0001F3FB", "\U0001F3FC", "\U0001F3FD", "\U0001F3FE", "\U0001F3FF"}
+
+const (
+	variationSelector16 = "\ufe0f"
+	zeroWidthJoiner     = "\u200d"
+	skinTonePrefix      = "::skin-tone-"
+)
+
+// slackNames are the names Slack uses where they differ from the preferred alias of the code map
+var slackNames = map[string]string{
+	"\U0001F647":                   "bow",
+	"\U0001F642":                   "slightly_smiling_face",
+	"\U0001F44C":                   "ok_hand",
+	"\u2764\ufe0f":                 "heart",
+	"\U0001F610":                   "neutral_face",
+	"\U0001F937":                   "shrug",
+	"\U0001F926":                   "face_palm",
+	"\U0001F64B":                   "raising_hand",
+	"\U0001F646":                   "ok_woman",
+	"\U0001F645":                   "no_good",
+	"\U0001F481":                   "information_desk_person",
+	"\U0001F647\u200d\u2642\ufe0f": "man-bowing",
+}
+
+var table = struct {
+	unicode   map[string]string
+	shortcode map[string]string
+	aliases   map[string][]string
+}{
+	unicode:   map[string]string{},
+	shortcode: map[string]string{},
+	aliases:   map[string][]string{},
+}
+
+var shortcodeRegExp = regexp.MustCompile(`:([a-zA-Z0-9_+'\-]+)(::skin-tone-[2-6])?:`)
+
+func init() {
+	for code, unicode := range codemap.CodeMap() {
+		var name = strings.Trim(code, ":")
+		table.unicode[name] = unicode
+
+		// Slack writes flags as "flag-jp"
+		if strings.HasPrefix(name, "flag_") && len(name) == len("flag_jp") && strings.ToLower(name) == name {
+			table.unicode["flag-"+name[len("flag_"):]] = unicode
+		}
+	}
+	for unicode, name := range slackNames {
+		table.unicode[name] = unicode
+	}
+
+	for name, unicode := range table.unicode {
+		var key = normalize(unicode)
+		table.aliases[key] = append(table.aliases[key], name)
+	}
+
+	for key, names := range table.aliases {
+		var zwj = strings.Contains(key, zeroWidthJoiner)
+		sort.Slice(names, func(i, j int) bool {
+			return less(names[i], names[j], zwj)
+		})
+		table.shortcode[key] = names[0]
+	}
+	for unicode, name := range slackNames {
+		table.shortcode[normalize(unicode)] = name
+	}
+}
+
+// less orders the aliases by how likely Slack uses them: lower case, no kyokomi style tone suffix, short.
+// Slack names ZWJ sequences with hyphens such as "male-technologist".
+func less(a, b string, zwj bool) bool {
+	var rank = func(name string) int {
+		var r int
+		if strings.ToLower(name) != name {
+			r += 4
+		}
+		if strings.Contains(name, "_tone") {
+			r += 2
+		}
+		if zwj && !strings.Contains(name, "-") {
+			r++
+		}
+		return r
+	}
+
+	if rank(a) != rank(b) {
+		return rank(a) < rank(b)
+	}
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// normalize drops the variation selectors, which Slack and Discord do not agree on
+func normalize(unicode string) string {
+	return strings.ReplaceAll(unicode, variationSelector16, "")
+}
+
+// splitSkinTone splits a Slack shortcode such as "+1::skin-tone-3" into the name and the modifier
+func splitSkinTone(name string) (string, string) {
+	var i = strings.Index(name, skinTonePrefix)
+	if i < 0 {
+		return name, ""
+	}
+
+	var n = int(name[len(name)-1] - '2')
+	if len(name) != i+len(skinTonePrefix)+1 || n < 0 || n >= len(SkinToneModifiers) {
+		return name[:i], ""
+	}
+	return name[:i], SkinToneModifiers[n]
+}
+
+// Unicode returns the Unicode emoji of a Slack shortcode such as "+1", ":thumbsup:" or "+1::skin-tone-3".
+// It reports false for custom emoji.
+func Unicode(shortcode string) (string, bool) {
+	var name, tone = splitSkinTone(strings.Trim(shortcode, ":"))
+
+	unicode, ok := table.unicode[name]
+	if !ok {
+		return "", false
+	}
+	if tone == "" {
+		return unicode, true
+	}
+
+	// the modifier follows the first code point, e.g. man technologist + tone + ZWJ + laptop
+	var runes = []rune(unicode)
+	var rest = strings.TrimPrefix(string(runes[1:]), variationSelector16)
+	return string(runes[0]) + tone + rest, true
+}
+
+// Shortcode returns the Slack shortcode, without colons, of a Unicode emoji.
+// A skin tone is given as Slack does, e.g. "+1::skin-tone-3".
+func Shortcode(unicode string) (string, bool) {
+	for i, modifier := range SkinToneModifiers {
+		if !strings.Contains(unicode, modifier) {
+			continue
+		}
+
+		name, ok := table.shortcode[normalize(strings.Replace(unicode, modifier, "", 1))]
+		if !ok {
+			break
+		}
+		return fmt.Sprintf("%s%s%d", name, skinTonePrefix, i+2), true
+	}
+
+	name, ok := table.shortcode[normalize(unicode)]
+	return name, ok
+}
+
+// Aliases returns all the shortcodes of a Unicode emoji, preferred one first
+func Aliases(unicode string) []string {
+	var aliases = table.aliases[normalize(unicode)]
+	return append([]string{}, aliases...)
+}
+
+// Same reports whether the emoji are the same regardless of the variation selectors
+func Same(a, b string) bool {
+	return normalize(a) == normalize(b)
+}
+
+// Emojize replaces the standard emoji shortcodes in Slack text with Unicode emoji.
+// Custom emoji are left as they are.
+func Emojize(text string) string {
+	return shortcodeRegExp.ReplaceAllStringFunc(text, func(code string) string {
+		if unicode, ok := Unicode(code); ok {
+			return unicode
+		}
+		return code
+	})
+}
+
+// FileName returns the Noto Color Emoji file name of a Unicode emoji such as "emoji_u1f44d_1f3fd.png"
+func FileName(unicode string) string {
+	var codes = []string{}
+	for _, r := range normalize(unicode) {
+		codes = append(codes, fmt.Sprintf("%04x", r))
+	}
+	return "emoji_u" + strings.Join(codes, "_") + ".png"
+}
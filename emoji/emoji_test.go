@@ -0,0 +1,66 @@
+package emoji
+
+import "testing"
+
+func TestUnicode(t *testing.T) {
+	var cases = []struct {
+		shortcode string
+		unicode   string
+		ok        bool
+	}{
+		{"+1", "\U0001F44D", true},
+		{":thumbsup:", "\U0001F44D", true},
+		{"+1::skin-tone-4", "\U0001F44D\U0001F3FD", true},
+		{"male-technologist::skin-tone-2", "\U0001F468\U0001F3FB\u200d\U0001F4BB", true},
+		{"flag-jp", "\U0001F1EF\U0001F1F5", true},
+		{"bow", "\U0001F647", true},
+		{"party_parrot", "", false},
+	}
+
+	for _, c := range cases {
+		unicode, ok := Unicode(c.shortcode)
+		if unicode != c.unicode || ok != c.ok {
+			t.Errorf("Unicode(%q) = %q, %v; want %q, %v", c.shortcode, unicode, ok, c.unicode, c.ok)
+		}
+	}
+}
+
+func TestShortcode(t *testing.T) {
+	var cases = []struct {
+		unicode   string
+		shortcode string
+	}{
+		{"\U0001F44D", "+1"},
+		{"\U0001F44D\U0001F3FD", "+1::skin-tone-4"},
+		{"\u2764", "heart"},
+		{"\u2764\ufe0f", "heart"},
+		{"\U0001F44C", "ok_hand"},
+		{"\U0001F468\U0001F3FB\u200d\U0001F4BB", "male-technologist::skin-tone-2"},
+	}
+
+	for _, c := range cases {
+		shortcode, ok := Shortcode(c.unicode)
+		if !ok || shortcode != c.shortcode {
+			t.Errorf("Shortcode(%q) = %q, %v; want %q", c.unicode, shortcode, ok, c.shortcode)
+		}
+
+		unicode, _ := Unicode(shortcode)
+		if !Same(unicode, c.unicode) {
+			t.Errorf("Unicode(Shortcode(%q)) = %q", c.unicode, unicode)
+		}
+	}
+}
+
+func TestEmojize(t *testing.T) {
+	var got = Emojize("ok :+1::skin-tone-2: :party_parrot: 10:30:00")
+	var want = "ok \U0001F44D\U0001F3FB :party_parrot: 10:30:00"
+	if got != want {
+		t.Errorf("Emojize() = %q; want %q", got, want)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	if got := FileName("#\ufe0f\u20e3"); got != "emoji_u0023_20e3.png" {
+		t.Errorf("FileName() = %q", got)
+	}
+}
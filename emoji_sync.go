@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_emoji_imager"
+	"github.com/pkg/errors"
+)
+
+// guildEmojiSlots are the numbers of static, and separately animated, emoji a guild can have by its boost level
+var guildEmojiSlots = map[discordgo.PremiumTier]int{
+	discordgo.PremiumTierNone: 50,
+	discordgo.PremiumTier1:    100,
+	discordgo.PremiumTier2:    150,
+	discordgo.PremiumTier3:    250,
+}
+
+var slackEmojiRegExp = regexp.MustCompile(`:([a-zA-Z0-9_+'\-]+):`)
+
+// SyncedEmoji is a Slack custom emoji mirrored as a Discord guild emoji
+type SyncedEmoji struct {
+	ID string `json:"id"`
+	// Name is the name on Discord, which allows fewer characters than Slack
+	Name     string `json:"name"`
+	Animated bool   `json:"animated"`
+	// URI is the Slack image the guild emoji was made from
+	URI string `json:"uri"`
+}
+
+// APIName is the emoji as reactions are added on Discord
+func (e SyncedEmoji) APIName() string {
+	return e.Name + ":" + e.ID
+}
+
+// MessageFormat is the emoji as it is written in a Discord message
+func (e SyncedEmoji) MessageFormat() string {
+	if e.Animated {
+		return "<a:" + e.APIName() + ">"
+	}
+	return "<:" + e.APIName() + ">"
+}
+
+// GuildEmojiImager prepares the images of Slack custom emoji
+type GuildEmojiImager interface {
+	GetEmojiURI(name string) string
+	GuildEmoji(name string) (slack_emoji_imager.GuildEmoji, error)
+}
+
+// EmojiSync mirrors the Slack custom emoji selected in settings as Discord guild emoji,
+// and keeps them by guild and Slack name
+type EmojiSync struct {
+	path   string
+	emojis map[string]map[string]SyncedEmoji
+	mu     sync.RWMutex
+
+	// syncMu serializes the changes of guild emoji
+	syncMu sync.Mutex
+
+	discord  *discordgo.Session
+	imager   GuildEmojiImager
+	settings *SettingsHandler
+}
+
+func NewEmojiSync(path string, settings *SettingsHandler) *EmojiSync {
+	var e = &EmojiSync{path: path, emojis: map[string]map[string]SyncedEmoji{}, settings: settings}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("ReadEmojiSync: %s\n", err.Error())
+		}
+		return e
+	}
+
+	err = json.Unmarshal(b, &e.emojis)
+	if err != nil {
+		log.Printf("ParseEmojiSync: %s\n", err.Error())
+		e.emojis = map[string]map[string]SyncedEmoji{}
+	}
+
+	return e
+}
+
+func (e *EmojiSync) SetDiscordSession(session *discordgo.Session) {
+	e.discord = session
+}
+
+func (e *EmojiSync) SetImager(imager GuildEmojiImager) {
+	e.imager = imager
+}
+
+// Find returns the guild emoji mirrored from the Slack emoji
+func (e *EmojiSync) Find(guildID, slackName string) (SyncedEmoji, bool) {
+	if e == nil {
+		return SyncedEmoji{}, false
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	synced, ok := e.emojis[guildID][slackName]
+	return synced, ok
+}
+
+// FindByDiscord returns the Slack name of a mirrored guild emoji
+func (e *EmojiSync) FindByDiscord(guildID, emojiID string) (string, bool) {
+	if e == nil {
+		return "", false
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for name, synced := range e.emojis[guildID] {
+		if synced.ID == emojiID {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Emojize replaces the mirrored Slack emoji in text with the guild emoji
+func (e *EmojiSync) Emojize(guildID, text string) string {
+	if e == nil {
+		return text
+	}
+
+	return slackEmojiRegExp.ReplaceAllStringFunc(text, func(code string) string {
+		if synced, ok := e.Find(guildID, strings.Trim(code, ":")); ok {
+			return synced.MessageFormat()
+		}
+		return code
+	})
+}
+
+// SyncAll brings the guild emoji of all guilds up to date
+func (e *EmojiSync) SyncAll() {
+	if e == nil {
+		return
+	}
+
+	for _, guildID := range e.settings.Guilds() {
+		err := e.Sync(guildID)
+		if err != nil {
+			log.Printf("SyncEmoji: %s\n", err.Error())
+		}
+	}
+}
+
+// Rename follows the rename of a Slack emoji, keeping the guild emoji when the new name is also selected
+func (e *EmojiSync) Rename(oldName, newName string) {
+	if e == nil {
+		return
+	}
+
+	e.syncMu.Lock()
+	for _, guildID := range e.settings.Guilds() {
+		synced, ok := e.Find(guildID, oldName)
+		if !ok || !e.settings.EmojiSync(guildID).Includes(newName) {
+			continue
+		}
+
+		var name = discordEmojiName(newName)
+		_, err := e.discord.GuildEmojiEdit(guildID, synced.ID, name, nil)
+		if err != nil {
+			log.Printf("GuildEmojiEdit: %s\n", err.Error())
+			continue
+		}
+
+		synced.Name = name
+		e.mu.Lock()
+		delete(e.emojis[guildID], oldName)
+		e.emojis[guildID][newName] = synced
+		e.save()
+		e.mu.Unlock()
+	}
+	e.syncMu.Unlock()
+
+	e.SyncAll()
+}
+
+// Sync creates the guild emoji of the selected Slack emoji, within the free slots of the guild,
+// and deletes the ones no longer selected. Emoji whose images changed on Slack are made again.
+func (e *EmojiSync) Sync(guildID string) error {
+	if e == nil || e.discord == nil || e.imager == nil {
+		return nil
+	}
+
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+
+	var setting = e.settings.EmojiSync(guildID)
+
+	guild, err := e.discord.State.Guild(guildID)
+	if err != nil {
+		guild, err = e.discord.Guild(guildID)
+		if err != nil {
+			return errors.Wrap(err, "GetGuild")
+		}
+	}
+
+	// the state may not have the emoji just created yet
+	emojis, err := e.discord.GuildEmojis(guildID)
+	if err != nil {
+		return errors.Wrap(err, "GuildEmojis")
+	}
+
+	var existing = map[string]bool{}
+	var used = map[bool]int{}
+	for _, emoji := range emojis {
+		existing[emoji.ID] = true
+		used[emoji.Animated]++
+	}
+
+	// the selected names come first when the slots run out
+	var names = setting.Names
+
+	var wanted = map[string]bool{}
+	for _, name := range names {
+		if setting.Includes(name) && e.imager.GetEmojiURI(name) != "" {
+			wanted[name] = true
+		}
+	}
+
+	e.mu.RLock()
+	var synced = map[string]SyncedEmoji{}
+	for name, emoji := range e.emojis[guildID] {
+		synced[name] = emoji
+	}
+	e.mu.RUnlock()
+
+	for name, emoji := range synced {
+		if !existing[emoji.ID] {
+			// deleted on Discord
+			e.forget(guildID, name)
+			continue
+		}
+		if wanted[name] {
+			continue
+		}
+
+		err := e.discord.GuildEmojiDelete(guildID, emoji.ID)
+		if err != nil {
+			log.Printf("GuildEmojiDelete: %s\n", err.Error())
+			continue
+		}
+		used[emoji.Animated]--
+		e.forget(guildID, name)
+	}
+
+	var slots = guildEmojiSlots[guild.PremiumTier]
+	var skipped int
+	for _, name := range names {
+		if !wanted[name] {
+			continue
+		}
+
+		var uri = e.imager.GetEmojiURI(name)
+		old, ok := e.Find(guildID, name)
+		if ok && old.URI == uri {
+			continue
+		}
+		if ok {
+			// the image was changed on Slack
+			err := e.discord.GuildEmojiDelete(guildID, old.ID)
+			if err != nil {
+				log.Printf("GuildEmojiDelete: %s\n", err.Error())
+				continue
+			}
+			used[old.Animated]--
+			e.forget(guildID, name)
+		}
+
+		// Slack serves animated emoji as GIF
+		if used[strings.HasSuffix(uri, ".gif")] >= slots {
+			skipped++
+			continue
+		}
+
+		image, err := e.imager.GuildEmoji(name)
+		if err != nil {
+			log.Printf("GuildEmoji %s: %s\n", name, err.Error())
+			continue
+		}
+
+		created, err := e.discord.GuildEmojiCreate(guildID, discordEmojiName(name), image.Image, nil)
+		if err != nil {
+			log.Printf("GuildEmojiCreate %s: %s\n", name, err.Error())
+			continue
+		}
+		used[image.Animated]++
+
+		e.mu.Lock()
+		if e.emojis[guildID] == nil {
+			e.emojis[guildID] = map[string]SyncedEmoji{}
+		}
+		e.emojis[guildID][name] = SyncedEmoji{ID: created.ID, Name: created.Name, Animated: created.Animated, URI: image.URI}
+		e.save()
+		e.mu.Unlock()
+	}
+
+	if skipped > 0 {
+		log.Printf("SyncEmoji: %d emoji skipped for no free slots in guild %s\n", skipped, guildID)
+	}
+
+	return nil
+}
+
+func (e *EmojiSync) forget(guildID, slackName string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.emojis[guildID], slackName)
+	if len(e.emojis[guildID]) == 0 {
+		delete(e.emojis, guildID)
+	}
+	e.save()
+}
+
+func (e *EmojiSync) save() {
+	b, err := json.Marshal(e.emojis)
+	if err != nil {
+		log.Printf("EncodeEmojiSync: %s\n", err.Error())
+		return
+	}
+
+	err = ioutil.WriteFile(e.path, b, 0644)
+	if err != nil {
+		log.Printf("SaveEmojiSync: %s\n", err.Error())
+	}
+}
+
+// discordEmojiName makes a Slack emoji name valid on Discord, which allows 2 to 32 letters, digits and underscores
+func discordEmojiName(slackName string) string {
+	var name = []rune{}
+	for _, r := range slackName {
+		if r < 0x80 && (r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')) {
+			name = append(name, r)
+		} else {
+			name = append(name, '_')
+		}
+	}
+	for len(name) < 2 {
+		name = append(name, '_')
+	}
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return string(name)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscordEmojiName(t *testing.T) {
+	var cases = map[string]string{
+		"party_parrot":                          "party_parrot",
+		"party-parrot":                          "party_parrot",
+		"+1-kmc":                                "_1_kmc",
+		"x":                                     "x_",
+		"ねこ":                                    "__",
+		"a_very_long_custom_emoji_name_over_32": "a_very_long_custom_emoji_name_ov",
+	}
+	for slackName, want := range cases {
+		if got := discordEmojiName(slackName); got != want {
+			t.Errorf("discordEmojiName(%q) = %q, want %q", slackName, got, want)
+		}
+	}
+}
+
+func TestEmojiSyncEmojize(t *testing.T) {
+	var e = NewEmojiSync(filepath.Join(t.TempDir(), "emoji_sync.json"), nil)
+	e.emojis["guild"] = map[string]SyncedEmoji{
+		"party-parrot": {ID: "1", Name: "party_parrot", Animated: true},
+		"kmc":          {ID: "2", Name: "kmc"},
+	}
+
+	var got = e.Emojize("guild", "hi :party-parrot: :kmc: :unknown: :+1:")
+	var want = "hi <a:party_parrot:1> <:kmc:2> :unknown: :+1:"
+	if got != want {
+		t.Errorf("Emojize = %q, want %q", got, want)
+	}
+
+	if got := e.Emojize("other", ":kmc:"); got != ":kmc:" {
+		t.Errorf("Emojize of another guild = %q, want %q", got, ":kmc:")
+	}
+
+	if name, ok := e.FindByDiscord("guild", "1"); !ok || name != "party-parrot" {
+		t.Errorf("FindByDiscord = %q, %v, want %q", name, ok, "party-parrot")
+	}
+}
@@ -2,18 +2,26 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
+	"github.com/bwmarrin/discordgo"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_webhook"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/emoji"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_emoji_block_maker"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
 	"github.com/pkg/errors"
 )
 
 type DiscordReactionHandler struct {
-	discordHook *discord_webhook.Handler
-	slackHook   *slack_webhook.Handler
+	discordHook  *discord_webhook.Handler
+	slackHook    *slack_webhook.Handler
+	messageLinks *MessageLinks
+	emojiSync    *EmojiSync
+
+	// slackBotUser is the Slack user of this bot, whose reactions are mirrored ones
+	slackBotUser string
 
 	settings *SettingsHandler
 }
@@ -26,6 +34,18 @@ func NewDiscordReactionHandler(slackHook *slack_webhook.Handler, discordHook *di
 	}
 }
 
+func (d *DiscordReactionHandler) SetMessageLinks(links *MessageLinks) {
+	d.messageLinks = links
+}
+
+func (d *DiscordReactionHandler) SetEmojiSync(emojiSync *EmojiSync) {
+	d.emojiSync = emojiSync
+}
+
+func (d *DiscordReactionHandler) SetSlackBotUser(userID string) {
+	d.slackBotUser = userID
+}
+
 func (d DiscordReactionHandler) GetReaction(guildID, channelID, messageID string) error {
 	var sdt = d.settings.FindSlackChannel(channelID, guildID)
 	if sdt.SlackChannel == "" {
@@ -37,46 +57,84 @@ func (d DiscordReactionHandler) GetReaction(guildID, channelID, messageID string
 		return nil
 	}
 
+	var mode = sdt.Setting.DiscordToSlackReactionMode()
+
 	message, err := d.discordHook.GetMessage(channelID, messageID)
 	if err != nil {
 		return errors.Wrap(err, "GetDiscordMessage")
 	}
 
-	srcMessages, err := d.slackHook.GetMessages(sdt.SlackChannel, "", 100)
-	if err != nil {
-		return errors.Wrap(err, "GetSlackMessages")
-	}
-
 	var srcMessage slack_webhook.Message
 	var check bool
 
-	dTime, err := message.Timestamp.Parse()
-	if err != nil {
-		return errors.Wrap(err, "ParseDiscordTS")
+	if link, ok := d.messageLinks.FindByDiscord(messageID); ok && link.SlackChannel == sdt.SlackChannel {
+		found, err := d.slackHook.GetMessage(link.SlackChannel, link.SlackTS)
+		if err == nil && found.TS == link.SlackTS {
+			srcMessage = *found
+			check = true
+		}
 	}
 
-	for i, msg := range srcMessages {
-		if strings.Contains(msg.Text, "<"+SlackMessageDummyURI) {
-			var sepMessage = strings.Split(msg.Text, "<"+SlackMessageDummyURI)
-			var messageTS = strings.Split(sepMessage[len(sepMessage)-1], "|")[0]
+	// the history is searched only for the messages bridged before the links were kept,
+	// and the reactions are cleaned only on the linked messages in the off mode
+	if !check && mode != ReactionModeOff {
+		srcMessages, err := d.slackHook.GetMessages(sdt.SlackChannel, "", 100)
+		if err != nil {
+			return errors.Wrap(err, "GetSlackMessages")
+		}
 
-			srcT, err := time.Parse(time.RFC3339, messageTS)
-			if err != nil {
-				continue
-			}
+		dTime, err := message.Timestamp.Parse()
+		if err != nil {
+			return errors.Wrap(err, "ParseDiscordTS")
+		}
 
-			if dTime.UnixMilli() >= srcT.UnixMilli() {
-				srcMessage = srcMessages[i]
-				check = true
-				break
+		for i, msg := range srcMessages {
+			if strings.Contains(msg.Text, "<"+SlackMessageDummyURI) {
+				var sepMessage = strings.Split(msg.Text, "<"+SlackMessageDummyURI)
+				var messageTS = strings.Split(sepMessage[len(sepMessage)-1], "|")[0]
+
+				srcT, err := time.Parse(time.RFC3339, messageTS)
+				if err != nil {
+					continue
+				}
+
+				if dTime.UnixMilli() >= srcT.UnixMilli() {
+					srcMessage = srcMessages[i]
+					check = true
+					break
+				}
 			}
 		}
 	}
 	if !check {
+		if mode == ReactionModeOff {
+			return nil
+		}
 		return fmt.Errorf("MessageNotFound")
 	}
 
-	var blocks = slack_emoji_block_maker.Build(message.Reactions)
+	var reactions = withoutMirrored(message.Reactions)
+	if mode == ReactionModeNative {
+		// only the reactions which cannot be mirrored are shown in blocks
+		reactions, err = d.syncNativeReactions(guildID, sdt.SlackChannel, srcMessage.TS, message.Reactions)
+		if err != nil {
+			return errors.Wrap(err, "SyncNativeReactions")
+		}
+	} else {
+		// the reactions mirrored in the native mode are removed
+		_, err = d.syncNativeReactions(guildID, sdt.SlackChannel, srcMessage.TS, nil)
+		if err != nil {
+			return errors.Wrap(err, "SyncNativeReactions")
+		}
+	}
+
+	var blocks []slack_webhook.BlockBase
+	switch mode {
+	case ReactionModeText:
+		blocks = slack_emoji_block_maker.BuildText(reactions)
+	case ReactionModeImage, ReactionModeNative:
+		blocks = slack_emoji_block_maker.Build(reactions)
+	}
 
 	for _, block := range srcMessage.Blocks {
 		switch block.Type {
@@ -103,3 +161,90 @@ func (d DiscordReactionHandler) GetReaction(guildID, channelID, messageID string
 
 	return nil
 }
+
+// withoutMirrored excludes the reactions by this bot, which are mirrored from Slack
+func withoutMirrored(reactions []*discordgo.MessageReactions) []*discordgo.MessageReactions {
+	var result = []*discordgo.MessageReactions{}
+	for _, reaction := range reactions {
+		var copied = *reaction
+		if copied.Me {
+			copied.Count--
+			copied.Me = false
+		}
+		if copied.Count > 0 {
+			result = append(result, &copied)
+		}
+	}
+	return result
+}
+
+// syncNativeReactions mirrors the Discord reactions of Unicode emoji and guild emoji synced from Slack
+// as the bot's own reactions on the Slack message, and returns the other reactions
+func (d DiscordReactionHandler) syncNativeReactions(guildID, channel, timestamp string, reactions []*discordgo.MessageReactions) ([]*discordgo.MessageReactions, error) {
+	var want = map[string]string{}
+	var rest = []*discordgo.MessageReactions{}
+
+	for _, reaction := range reactions {
+		var count = reaction.Count
+		if reaction.Me {
+			// mirrored from Slack
+			count--
+		}
+		if count <= 0 {
+			continue
+		}
+
+		if reaction.Emoji.ID == "" {
+			if name, ok := emoji.Shortcode(reaction.Emoji.Name); ok {
+				want[reaction.Emoji.Name] = name
+				continue
+			}
+		} else if name, ok := d.emojiSync.FindByDiscord(guildID, reaction.Emoji.ID); ok {
+			want[reaction.Emoji.APIName()] = name
+			continue
+		}
+
+		var copied = *reaction
+		copied.Count = count
+		rest = append(rest, &copied)
+	}
+
+	slackReactions, err := d.slackHook.GetReactions(channel, timestamp)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetReactions")
+	}
+
+	for _, reaction := range slackReactions {
+		if !reaction.HasUser(d.slackBotUser) {
+			continue
+		}
+
+		unicode, ok := emoji.Unicode(reaction.Name)
+		var found bool
+		for key, name := range want {
+			if name == reaction.Name || (ok && emoji.Same(key, unicode)) {
+				delete(want, key)
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		// removed on Discord
+		err := d.slackHook.RemoveReaction(channel, timestamp, reaction.Name)
+		if err != nil {
+			log.Printf("RemoveReaction: %s\n", err.Error())
+		}
+	}
+
+	for _, name := range want {
+		err := d.slackHook.AddReaction(channel, timestamp, name)
+		if err != nil {
+			log.Printf("AddReaction: %s\n", err.Error())
+		}
+	}
+
+	return rest, nil
+}
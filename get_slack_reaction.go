@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net/http"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_embed_maker"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_webhook"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/emoji"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_emoji_imager"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
 	"github.com/pkg/errors"
@@ -18,8 +21,14 @@ import (
 type SlackReactionHandler struct {
 	reactionImager ReactionImagerType
 
-	discordHook *discord_webhook.Handler
-	slackHook   *slack_webhook.Handler
+	discordHook  *discord_webhook.Handler
+	slackHook    *slack_webhook.Handler
+	messageLinks *MessageLinks
+	discord      *discordgo.Session
+	emojiSync    *EmojiSync
+
+	// slackBotUser is the Slack user of this bot, whose reactions are mirrored ones
+	slackBotUser string
 
 	settings *SettingsHandler
 
@@ -29,7 +38,7 @@ type SlackReactionHandler struct {
 type ReactionImagerType interface {
 	AddEmoji(name string, uri string)
 	RemoveEmoji(string)
-	MakeReactionsImage(channel string, timestamp string) (r io.Reader, err error)
+	MakeImage(reactions []slack_emoji_imager.MessageReaction, options slack_emoji_imager.Options) (r io.Reader, contentType string, err error)
 	GetEmojiURI(name string) string
 }
 
@@ -45,18 +54,54 @@ func (d *SlackReactionHandler) SetReactionImager(imager ReactionImagerType) {
 	d.reactionImager = imager
 }
 
+func (d *SlackReactionHandler) SetMessageLinks(links *MessageLinks) {
+	d.messageLinks = links
+}
+
+func (d *SlackReactionHandler) SetDiscordSession(session *discordgo.Session) {
+	d.discord = session
+}
+
+func (d *SlackReactionHandler) SetEmojiSync(emojiSync *EmojiSync) {
+	d.emojiSync = emojiSync
+}
+
+func (d *SlackReactionHandler) SetSlackBotUser(userID string) {
+	d.slackBotUser = userID
+}
+
 func (d *SlackReactionHandler) SetMessageEscaper(escaper MessageEscaper) {
 	d.escaper = escaper
 }
 
 func (d *SlackReactionHandler) GetReaction(channel string, timestamp string) error {
-	const ReactionGifName = "reactions.gif"
-
-	var cs, _ = d.settings.FindDiscordChannel(channel)
+	var cs, guildID = d.settings.FindDiscordChannel(channel)
 	if !cs.Setting.SlackToDiscord {
 		return nil
 	}
 
+	var mode = cs.Setting.SlackToDiscordReactionMode()
+	if mode == ReactionModeOff {
+		// only the linked messages are cleaned, without searching the history
+		link, ok := d.messageLinks.FindBySlack(channel, timestamp)
+		if !ok {
+			return nil
+		}
+		found, err := d.discordHook.GetMessage(link.DiscordChannel, link.DiscordMessage)
+		if err != nil || found.ID == "" {
+			return nil
+		}
+		d.syncNativeReactions(guildID, &found, nil)
+
+		target, err := d.reactionTarget(&found)
+		if err != nil {
+			return errors.Wrap(err, "FindReactionReply")
+		}
+		return d.clearReactions(discord_webhook.Message{Message: target})
+	}
+
+	var reactionGifName = d.settings.Locale(guildID).T("reaction.gif_name")
+
 	srcContent, err := d.slackHook.GetMessage(channel, timestamp)
 	if err != nil {
 		return errors.Wrap(err, "SlackGetMessage")
@@ -65,7 +110,17 @@ func (d *SlackReactionHandler) GetReaction(channel string, timestamp string) err
 
 	var oldAttachments []*discordgo.MessageAttachment
 	var message discord_webhook.Message
-	if strings.Contains(srcContent.Text, "<"+SlackMessageDummyURI) {
+
+	// the Slack message is kept as it is, or reposted with the timestamp of the Discord message
+	if link, ok := d.messageLinks.FindBySlack(channel, timestamp); ok {
+		found, err := d.discordHook.GetMessage(link.DiscordChannel, link.DiscordMessage)
+		if err == nil {
+			message.Message = &found
+			oldAttachments = found.Attachments
+		}
+	}
+
+	if strings.Contains(srcContent.Text, "<"+SlackMessageDummyURI) && message.Message == nil {
 		var sepMessage = strings.Split(srcContent.Text, "<"+SlackMessageDummyURI)
 		var messageTS = strings.Split(sepMessage[len(sepMessage)-1], "|")[0]
 
@@ -108,6 +163,7 @@ next:
 		if err != nil {
 			return err
 		}
+		content = d.emojiSync.Emojize(guildID, content)
 
 		for i, msg := range messages {
 			if content == msg.Content {
@@ -123,60 +179,195 @@ next:
 		return fmt.Errorf("MessageNotFound")
 	}
 
-	var dFiles = []discord_webhook.File{}
+	// the messages which cannot be edited show the reactions in a reply of the bot
+	var original = message.Message
+	message.Message, err = d.reactionTarget(original)
+	if err != nil {
+		return errors.Wrap(err, "FindReactionReply")
+	}
+	if message.Message != original {
+		oldAttachments = nil
+	}
 
-	message.Attachments = make([]discord_webhook.Attachment, 0)
+	reactions, err := d.slackHook.GetReactions(channel, timestamp)
+	if err != nil {
+		return errors.Wrap(err, "GetReactions")
+	}
 
-	for i := range message.Message.Attachments {
-		if message.Message.Attachments[i] == nil {
-			continue
-		}
+	if mode == ReactionModeText {
+		// the reactions mirrored in the native mode are removed
+		d.syncNativeReactions(guildID, original, nil)
+		return d.setReactionSummary(guildID, message, d.withoutMirrored(reactions))
+	}
 
-		var attach = message.Message.Attachments[i]
-		if attach.Filename == ReactionGifName {
-			// Reaction Gif should be renewed
-			continue
+	var drawn = []slack_emoji_imager.MessageReaction{}
+	if mode == ReactionModeNative {
+		// only the reactions which cannot be mirrored are drawn, and the native ones are on the original message
+		drawn = d.syncNativeReactions(guildID, original, reactions)
+		if len(drawn) == 0 && !hasReactionImage(message.Message.Attachments) && !hasReactionSummary(message.Embeds) {
+			return nil
 		}
-
-		resp, err := http.Get(attach.URL)
-		if err != nil {
-			log.Printf("GetFileError: %s\n", err.Error())
-			continue
+	} else {
+		d.syncNativeReactions(guildID, original, nil)
+		for _, reaction := range d.withoutMirrored(reactions) {
+			drawn = append(drawn, slack_emoji_imager.MessageReaction{Emoji: reaction.Name, Num: reaction.Count})
 		}
-		defer resp.Body.Close()
+	}
 
-		var dFile = discord_webhook.File{
-			Reader:      resp.Body,
-			FileName:    attach.Filename,
-			ContentType: discord_webhook.FindContentType(attach.Filename),
-		}
+	var options = cs.Setting.ReactionImage
+	if options.Reactors != slack_emoji_imager.ReactorNone {
+		d.setReactors(drawn, reactions)
+	}
 
-		dFiles = append(dFiles, dFile)
+	r, contentType, err := d.reactionImager.MakeImage(drawn, options)
+	if err != nil && err != slack_emoji_imager.ErrorNoReactions {
+		return errors.Wrap(err, "MakeReactionImage")
 	}
 
-	r, err := d.reactionImager.MakeReactionsImage(channel, timestamp)
-	switch err {
-	case nil:
+	message.Embeds = withoutReactionSummary(message.Embeds)
+
+	// the other attachments are kept by their IDs, and only the reaction image is uploaded
+	message.Attachments = discord_webhook.KeepAttachments(message.Message.Attachments, func(attach *discordgo.MessageAttachment) bool {
+		return !isReactionImageName(attach.Filename)
+	})
+
+	var dFiles = []discord_webhook.File{}
+	if r != nil {
 		dFiles = append(
 			dFiles,
 			discord_webhook.File{
-				FileName:    ReactionGifName,
+				FileName:    reactionImageName(reactionGifName, contentType),
 				Reader:      r,
-				ContentType: "image/gif",
+				ContentType: contentType,
 			},
 		)
-	case slack_emoji_imager.ErrorNoReactions:
-
-	default:
-		return errors.Wrap(err, "MakeReactionImage")
 	}
 
-	newMessage, err := d.discordHook.Edit(message.ChannelID, message.ID, message, dFiles)
+	newMessage, err := d.editReactions(message, dFiles)
 	if err != nil {
 		return errors.Wrap(err, "DiscordMessageEdit")
 	}
+	if newMessage == nil {
+		return nil
+	}
+
+	if keptAttachments(message.Attachments, newMessage.Attachments) {
+		return nil
+	}
+
+	// the attachments were uploaded again, so the Slack blocks have to follow their new URLs
+	return d.relinkSlackBlocks(srcContent, oldAttachments, newMessage)
+}
+
+// setReactionSummary shows the reactions as an embed of emoji and counts on the Discord message, instead of an image
+func (d *SlackReactionHandler) setReactionSummary(guildID string, message discord_webhook.Message, reactions []slack_webhook.Reaction) error {
+	var summary = []string{}
+	for _, reaction := range reactions {
+		var name = ":" + reaction.Name + ":"
+		if unicode, ok := emoji.Unicode(reaction.Name); ok {
+			name = unicode
+		} else if synced, ok := d.emojiSync.Find(guildID, reaction.Name); ok {
+			name = synced.MessageFormat()
+		}
+		summary = append(summary, fmt.Sprintf("%s %d", name, reaction.Count))
+	}
+
+	var embeds = withoutReactionSummary(message.Embeds)
+	if len(summary) > 0 && len(embeds) < discord_embed_maker.MaxEmbeds {
+		embeds = append(embeds, &discordgo.MessageEmbed{
+			Title:       d.settings.Locale(guildID).T("reaction.summary_title"),
+			Description: strings.Join(summary, "   "),
+		})
+	}
+	message.Embeds = embeds
+
+	// the image made in the other modes is removed
+	message.Attachments = discord_webhook.KeepAttachments(message.Message.Attachments, func(attach *discordgo.MessageAttachment) bool {
+		return !isReactionImageName(attach.Filename)
+	})
+
+	_, err := d.editReactions(message, nil)
+	return errors.Wrap(err, "DiscordMessageEdit")
+}
+
+// clearReactions removes the reaction image and the summary from the Discord message
+func (d *SlackReactionHandler) clearReactions(message discord_webhook.Message) error {
+	if !hasReactionImage(message.Message.Attachments) && !hasReactionSummary(message.Embeds) {
+		return nil
+	}
+	message.Embeds = withoutReactionSummary(message.Embeds)
+	message.Attachments = discord_webhook.KeepAttachments(message.Message.Attachments, func(attach *discordgo.MessageAttachment) bool {
+		return !isReactionImageName(attach.Filename)
+	})
+
+	_, err := d.editReactions(message, nil)
+	return errors.Wrap(err, "DiscordMessageEdit")
+}
+
+// withoutReactionSummary excludes the reaction summaries from the embeds
+func withoutReactionSummary(embeds []*discordgo.MessageEmbed) []*discordgo.MessageEmbed {
+	var result = []*discordgo.MessageEmbed{}
+	for _, embed := range embeds {
+		if !isReactionSummary(embed) {
+			result = append(result, embed)
+		}
+	}
+	return result
+}
+
+// hasReactionSummary reports whether the embeds have a reaction summary
+func hasReactionSummary(embeds []*discordgo.MessageEmbed) bool {
+	for _, embed := range embeds {
+		if isReactionSummary(embed) {
+			return true
+		}
+	}
+	return false
+}
+
+// isReactionSummary reports whether the embed is a reaction summary made in any language
+func isReactionSummary(embed *discordgo.MessageEmbed) bool {
+	for _, title := range locale.Values("reaction.summary_title") {
+		if embed != nil && embed.Title == title && embed.URL == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutMirrored excludes the reactions by this bot, which are mirrored from Discord
+func (d *SlackReactionHandler) withoutMirrored(reactions []slack_webhook.Reaction) []slack_webhook.Reaction {
+	var result = []slack_webhook.Reaction{}
+	for _, reaction := range reactions {
+		if reaction.HasUser(d.slackBotUser) {
+			reaction.Count--
+		}
+		if reaction.Count > 0 {
+			result = append(result, reaction)
+		}
+	}
+	return result
+}
 
-	// reset file and image urls of Slack blocks
+// keptAttachments reports whether all the attachments to keep remain in the edited message
+func keptAttachments(kept []discord_webhook.Attachment, attachments []discord_webhook.Attachment) bool {
+	for _, keep := range kept {
+		var found bool
+		for _, attach := range attachments {
+			if attach.ID == keep.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// relinkSlackBlocks resets the file and image URLs of the Slack message to the attachments of the edited Discord message
+func (d *SlackReactionHandler) relinkSlackBlocks(srcContent *slack_webhook.Message, oldAttachments []*discordgo.MessageAttachment, newMessage *discord_webhook.Message) error {
 	for i, block := range srcContent.Blocks {
 		switch block.Type {
 		case "image":
@@ -252,7 +443,7 @@ next:
 		}
 	}
 
-	_, err = d.slackHook.Update(*srcContent)
+	_, err := d.slackHook.Update(*srcContent)
 
 	return errors.Wrap(err, "UpdateSlackMessage")
 }
@@ -268,3 +459,182 @@ func (d *SlackReactionHandler) RemoveEmoji(name string) {
 func (d *SlackReactionHandler) GetEmojiURI(name string) string {
 	return d.reactionImager.GetEmojiURI(name)
 }
+
+// reactionTarget returns the message to show the reactions of the Discord message.
+// The messages which cannot be edited, such as the originals kept on Discord, show them in a reply of the bot,
+// and a new reply without ID is returned if the bot has not replied yet.
+func (d *SlackReactionHandler) reactionTarget(message *discordgo.Message) (*discordgo.Message, error) {
+	if d.discordHook.Editable(message) {
+		return message, nil
+	}
+
+	messages, err := d.discordHook.GetMessages(message.ChannelID, message.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetMessages")
+	}
+
+	for i, msg := range messages {
+		if isReactionReply(&msg) && msg.MessageReference.MessageID == message.ID && d.discordHook.Editable(&msg) {
+			return &messages[i], nil
+		}
+	}
+
+	return &discordgo.Message{
+		ChannelID: message.ChannelID,
+		MessageReference: &discordgo.MessageReference{
+			ChannelID: message.ChannelID,
+			MessageID: message.ID,
+		},
+	}, nil
+}
+
+// editReactions edits the message to show the reactions. The reply showing them is sent at first,
+// and deleted when nothing is left to show.
+func (d *SlackReactionHandler) editReactions(message discord_webhook.Message, files []discord_webhook.File) (*discord_webhook.Message, error) {
+	if isReactionReply(message.Message) {
+		var empty = len(message.Embeds) == 0 && len(message.Attachments) == 0 && len(files) == 0
+
+		switch {
+		case message.ID == "" && empty:
+			return nil, nil
+		case message.ID == "":
+			message.Attachments = nil
+			return d.discordHook.Reply(message.ChannelID, message, files)
+		case empty:
+			return nil, d.discord.ChannelMessageDelete(message.ChannelID, message.ID)
+		}
+	}
+
+	return d.discordHook.Edit(message.ChannelID, message.ID, message, files)
+}
+
+// isReactionReply reports whether the message is a reply of the bot only to show reactions
+func isReactionReply(message *discordgo.Message) bool {
+	return message.WebhookID == "" && message.MessageReference != nil && message.Content == ""
+}
+
+// syncNativeReactions mirrors the Slack reactions of Unicode emoji and synced custom emoji as the bot's own reactions
+// on the Discord message, and returns the other reactions
+func (d *SlackReactionHandler) syncNativeReactions(guildID string, message *discordgo.Message, reactions []slack_webhook.Reaction) []slack_emoji_imager.MessageReaction {
+	var want = []string{}
+	var rest = []slack_emoji_imager.MessageReaction{}
+
+	for _, reaction := range reactions {
+		var count = reaction.Count
+		if reaction.HasUser(d.slackBotUser) {
+			// mirrored from Discord
+			count--
+		}
+		if count <= 0 {
+			continue
+		}
+
+		if unicode, ok := emoji.Unicode(reaction.Name); ok {
+			want = append(want, unicode)
+			continue
+		}
+		if synced, ok := d.emojiSync.Find(guildID, reaction.Name); ok {
+			want = append(want, synced.APIName())
+			continue
+		}
+		rest = append(rest, slack_emoji_imager.MessageReaction{Emoji: reaction.Name, Num: count})
+	}
+
+	for _, reaction := range message.Reactions {
+		if !reaction.Me {
+			continue
+		}
+
+		var found bool
+		for i, name := range want {
+			if emoji.Same(name, reaction.Emoji.APIName()) {
+				want = append(want[:i], want[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		// removed on Slack
+		err := d.discord.MessageReactionRemove(message.ChannelID, message.ID, reaction.Emoji.APIName(), "@me")
+		if err != nil {
+			log.Printf("MessageReactionRemove: %s\n", err.Error())
+		}
+	}
+
+	for _, name := range want {
+		err := d.discord.MessageReactionAdd(message.ChannelID, message.ID, name)
+		if err != nil {
+			log.Printf("MessageReactionAdd: %s\n", err.Error())
+		}
+	}
+
+	return rest
+}
+
+// setReactors sets the Slack users who reacted, except this bot, to the reactions to be drawn
+func (d *SlackReactionHandler) setReactors(drawn []slack_emoji_imager.MessageReaction, reactions []slack_webhook.Reaction) {
+	var users = map[string]slack_emoji_imager.Reactor{}
+
+	for i := range drawn {
+		for _, reaction := range reactions {
+			if reaction.Name != drawn[i].Emoji {
+				continue
+			}
+
+			for _, userID := range reaction.Users {
+				if userID == d.slackBotUser {
+					continue
+				}
+
+				user, ok := users[userID]
+				if !ok {
+					info, err := d.slackHook.GetUserInfo(userID)
+					if err != nil {
+						log.Printf("GetUserInfo: %s\n", err.Error())
+						continue
+					}
+
+					user.Name = info.Profile.DisplayName
+					if user.Name == "" {
+						user.Name = info.RealName
+					}
+					user.AvatarURL = info.Profile.Image48
+					users[userID] = user
+				}
+
+				drawn[i].Reactors = append(drawn[i].Reactors, user)
+			}
+		}
+	}
+}
+
+// hasReactionImage reports whether the attachments have a reaction image
+func hasReactionImage(attachments []*discordgo.MessageAttachment) bool {
+	for _, attach := range attachments {
+		if attach != nil && isReactionImageName(attach.Filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// isReactionImageName reports whether the file is a reaction image made in any language and format
+func isReactionImageName(filename string) bool {
+	for _, name := range locale.Values("reaction.gif_name") {
+		if strings.TrimSuffix(filename, path.Ext(filename)) == strings.TrimSuffix(name, path.Ext(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// reactionImageName gives the extension of the content type to the localized name of reaction GIFs
+func reactionImageName(gifName, contentType string) string {
+	if contentType == "image/png" {
+		return strings.TrimSuffix(gifName, path.Ext(gifName)) + ".png"
+	}
+	return gifName
+}
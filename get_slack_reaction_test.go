@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_webhook"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
+)
+
+func TestWithoutReactionSummary(t *testing.T) {
+	var embeds = []*discordgo.MessageEmbed{{Title: "quoted"}}
+	for _, title := range locale.Values("reaction.summary_title") {
+		embeds = append(embeds, &discordgo.MessageEmbed{Title: title, Description: "\U0001F44D 1"})
+	}
+	// a link embed with the same title is not a summary
+	embeds = append(embeds, &discordgo.MessageEmbed{Title: locale.Values("reaction.summary_title")[0], URL: "https://example.com"})
+
+	if !hasReactionSummary(embeds) {
+		t.Fatal("hasReactionSummary() = false; want true")
+	}
+
+	var kept = withoutReactionSummary(embeds)
+	if len(kept) != 2 || kept[0].Title != "quoted" || kept[1].URL == "" {
+		t.Errorf("withoutReactionSummary() kept %d embeds; want the quoted and the link embeds", len(kept))
+	}
+	if hasReactionSummary(kept) {
+		t.Error("hasReactionSummary() = true after withoutReactionSummary()")
+	}
+}
+
+func TestReactionTarget(t *testing.T) {
+	var messages = `[
+		{"id": "12", "channel_id": "c", "content": "**name**\nthread reply", "author": {"id": "bot"}, "message_reference": {"message_id": "10"}},
+		{"id": "11", "channel_id": "c", "content": "", "author": {"id": "bot"}, "message_reference": {"message_id": "10"}},
+		{"id": "10", "channel_id": "c", "content": "kept", "author": {"id": "user"}}
+	]`
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/@me":
+			w.Write([]byte(`{"id": "bot"}`))
+		case "/channels/c/messages":
+			w.Write([]byte(messages))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var endpoint = discord_webhook.DiscordAPIEndpoint
+	discord_webhook.DiscordAPIEndpoint = server.URL
+	defer func() { discord_webhook.DiscordAPIEndpoint = endpoint }()
+
+	var d = NewSlackReactionHandler(nil, discord_webhook.New("token"), nil)
+
+	var reposted = &discordgo.Message{ID: "1", ChannelID: "c", WebhookID: "hook"}
+	if target, err := d.reactionTarget(reposted); err != nil || target != reposted {
+		t.Errorf("reactionTarget(reposted) = %+v, %v; want the message itself", target, err)
+	}
+
+	var kept = &discordgo.Message{ID: "10", ChannelID: "c", Author: &discordgo.User{ID: "user"}}
+	if target, err := d.reactionTarget(kept); err != nil || target.ID != "11" {
+		t.Errorf("reactionTarget(kept) = %+v, %v; want the reaction reply", target, err)
+	}
+
+	messages = `[{"id": "10", "channel_id": "c", "content": "kept", "author": {"id": "user"}}]`
+	target, err := d.reactionTarget(kept)
+	if err != nil || target.ID != "" || target.MessageReference == nil || target.MessageReference.MessageID != "10" {
+		t.Errorf("reactionTarget(kept) = %+v, %v; want a new reply", target, err)
+	}
+}
@@ -0,0 +1,186 @@
+// Package locale provides the message catalogs of bot-generated strings.
+// Catalogs are JSON files named by the language, such as locales/ja.json.
+package locale
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const DefaultLanguage = "ja"
+
+var (
+	catalogs        = map[string]*Catalog{}
+	defaultLanguage = DefaultLanguage
+	mu              sync.RWMutex
+)
+
+// Catalog is a set of messages in a language
+type Catalog struct {
+	Language string
+	messages map[string]string
+}
+
+// Load reads all locale files in the directory.
+// It fails when the directory has no locale files.
+func Load(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var messages = map[string]string{}
+		err = json.Unmarshal(b, &messages)
+		if err != nil {
+			return fmt.Errorf("ParseLocale: %s: %s", path, err.Error())
+		}
+
+		var lang = strings.TrimSuffix(filepath.Base(path), ".json")
+		catalogs[lang] = &Catalog{Language: lang, messages: messages}
+	}
+
+	// without any catalog, the keys would be shown and the patterns of messages would be broken
+	if len(paths) == 0 {
+		return fmt.Errorf("NoLocaleFiles: %s", dir)
+	}
+
+	return nil
+}
+
+// SetDefault sets the language used when no language is specified
+func SetDefault(lang string) {
+	if lang == "" {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	defaultLanguage = lang
+}
+
+// Default returns the catalog of the default language
+func Default() *Catalog {
+	return Get("")
+}
+
+// Get returns the catalog of the language.
+// If the language is empty or not found, the default one is returned.
+func Get(lang string) *Catalog {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if c, ok := catalogs[lang]; ok {
+		return c
+	}
+	if c, ok := catalogs[defaultLanguage]; ok {
+		return c
+	}
+	if c, ok := catalogs[DefaultLanguage]; ok {
+		return c
+	}
+	return &Catalog{Language: lang, messages: map[string]string{}}
+}
+
+// T returns the message of the key formatted with args.
+// Missing messages fall back to the default language, and then to the key itself.
+func (c *Catalog) T(key string, args ...interface{}) string {
+	var format, ok = c.message(key)
+	if !ok {
+		format = key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+func (c *Catalog) message(key string) (string, bool) {
+	if c != nil {
+		if message, ok := c.messages[key]; ok {
+			return message, true
+		}
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, lang := range []string{defaultLanguage, DefaultLanguage} {
+		if fallback, ok := catalogs[lang]; ok {
+			if message, ok := fallback.messages[key]; ok {
+				return message, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Values returns the messages of the key in all languages,
+// used to recognize the strings generated with any of them
+func Values(key string) []string {
+	var values = messages(key)
+	if len(values) == 0 {
+		values = append(values, key)
+	}
+	return values
+}
+
+// messages returns the non-empty messages of the key in all languages
+func messages(key string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var found = map[string]bool{}
+	for _, c := range catalogs {
+		if message, ok := c.messages[key]; ok && message != "" {
+			found[message] = true
+		}
+	}
+
+	var values = []string{}
+	for message := range found {
+		values = append(values, message)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// neverMatch is a regular expression which matches nothing
+var neverMatch = regexp.MustCompile(`[^\s\S]`)
+
+// Pattern makes a regular expression which matches the message of the key in any language.
+// Each verb in the messages is replaced with argPattern.
+// It matches nothing when no language has the message.
+func Pattern(key string, argPattern string) *regexp.Regexp {
+	var verb = regexp.MustCompile(`%[a-z]`)
+
+	var values = messages(key)
+	if len(values) == 0 {
+		return neverMatch
+	}
+
+	var patterns = []string{}
+	for _, message := range values {
+		var parts = verb.Split(message, -1)
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		patterns = append(patterns, strings.Join(parts, argPattern))
+	}
+
+	return regexp.MustCompile(strings.Join(patterns, "|"))
+}
@@ -0,0 +1,46 @@
+package locale
+
+import "testing"
+
+func TestCatalog(t *testing.T) {
+	err := Load("../locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Get("en").T("duration.minutes", 3); got != "3 min" {
+		t.Fatalf("Expected \"3 min\", but got %q", got)
+	}
+	if got := Get("unknown").T("voice.nobody"); got != Get(DefaultLanguage).T("voice.nobody") {
+		t.Fatalf("Expected the default language, but got %q", got)
+	}
+	if got := Get("en").T("no.such.key"); got != "no.such.key" {
+		t.Fatalf("Expected the key itself, but got %q", got)
+	}
+
+	// the marker of replies is parsed back from the messages of any language, so it must mean the same in all of them
+	var refURI = Pattern("message.ref_uri", `https:.+`)
+	var marker = Get(DefaultLanguage).T("message.ref_uri", "https://discord.com/channels/1/2/3")
+	for _, lang := range []string{"ja", "en"} {
+		var text = Get(lang).T("message.ref_uri", "https://discord.com/channels/1/2/3")
+		if !refURI.MatchString(text) {
+			t.Fatalf("Expected %q matches %s", text, refURI)
+		}
+		if text != marker {
+			t.Fatalf("Expected the marker of %s is %q, but got %q", lang, marker, text)
+		}
+	}
+}
+
+func TestPatternWithoutMessages(t *testing.T) {
+	var pattern = Pattern("no.such.key", `.*`)
+	for _, text := range []string{"", "no.such.key", "anything"} {
+		if pattern.MatchString(text) {
+			t.Errorf("Expected the pattern of a missing message matches nothing, but it matched %q", text)
+		}
+	}
+
+	if err := Load(t.TempDir()); err == nil {
+		t.Errorf("Expected an error for a directory without locale files")
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/kmc-jp/DiscordSlackSynchronizer/configurator"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_webhook"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_emoji_imager"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
 )
@@ -29,6 +30,7 @@ type Token struct {
 
 var Tokens Token
 var SettingsFile string
+var StateDirectory string
 
 const ProgramName = "DiscordSlackSync"
 
@@ -37,10 +39,25 @@ func init() {
 	Tokens.Slack.Event = os.Getenv("SLACK_EVENT_TOKEN")
 	Tokens.Discord.API = os.Getenv("DISCORD_BOT_TOKEN")
 	Tokens.Slack.User = os.Getenv("SLACK_API_USER_TOKEN")
-	SettingsFile = filepath.Join(os.Getenv("STATE_DIRECTORY"), "settings.json")
-	if SettingsFile == "" {
-		SettingsFile = "settings.json"
+	StateDirectory = os.Getenv("STATE_DIRECTORY")
+	SettingsFile = statePath("settings.json")
+
+	var localesDirectory = os.Getenv("LOCALES_DIRECTORY")
+	if localesDirectory == "" {
+		localesDirectory = "locales"
+	}
+	err := locale.Load(localesDirectory)
+	if err != nil {
+		// the messages and the patterns to recognize them cannot be made without locales
+		fmt.Printf("Failed to load locales: %v\n", err)
+		os.Exit(1)
 	}
+	locale.SetDefault(os.Getenv("LOCALE"))
+}
+
+// statePath returns the path of a file in the state directory
+func statePath(name string) string {
+	return filepath.Join(StateDirectory, name)
 }
 
 func main() {
@@ -50,6 +67,7 @@ func main() {
 	if err != nil {
 		fmt.Println("Imager initialize error:", err)
 	}
+	imager.SetCacheDir(statePath("emoji_cache"))
 
 	if Tokens.Discord.API == "" {
 		fmt.Println("No discord token provided")
@@ -58,9 +76,16 @@ func main() {
 
 	var discordWebhookHandler = discord_webhook.New(Tokens.Discord.API)
 	var slackWebhookHandler = slack_webhook.New(Tokens.Slack.API)
+	var messageLinks = NewMessageLinks(statePath("messages.jsonl"))
+	var userLinks = NewUserLinks(statePath("user_links.json"))
+	var pauses = NewChannelPauses(statePath("channel_pauses.json"))
+	var linkCodes = NewLinkCodes()
+	var emojiSync = NewEmojiSync(statePath("emoji_sync.json"), settings)
+	emojiSync.SetImager(imager)
 
 	var slackReactionHandler = NewSlackReactionHandler(slackWebhookHandler, discordWebhookHandler, settings)
 	slackReactionHandler.SetReactionImager(imager)
+	slackReactionHandler.SetMessageLinks(messageLinks)
 
 	var discordReacionHandler = NewDiscordReactionHandler(slackWebhookHandler, discordWebhookHandler, settings)
 
@@ -68,6 +93,15 @@ func main() {
 	Discord.SetSlackWebhook(slackWebhookHandler)
 	Discord.SetDiscordWebhook(discordWebhookHandler)
 	Discord.SetDiscordReactionHandler(discordReacionHandler)
+	Discord.SetMessageLinks(messageLinks)
+	Discord.SetVoiceSessionStore(NewVoiceSessionStore(statePath("voice_sessions.jsonl")))
+	Discord.SetSlackStatusUpdater(NewSlackStatusUpdater(userLinks, Tokens.Slack.User))
+
+	var appHome = NewAppHome(Discord.Session, slackWebhookHandler, settings, messageLinks)
+	Discord.SetAppHome(appHome)
+	Discord.SetChannelPauses(pauses)
+	Discord.SetUserLinks(userLinks)
+	Discord.SetLinkCodes(linkCodes)
 
 	var Slack = NewSlackBot(Tokens.Slack.API, Tokens.Slack.Event, settings)
 
@@ -75,6 +109,22 @@ func main() {
 	Slack.SetDiscordWebhook(discordWebhookHandler)
 	Slack.SetSlackWebhook(slackWebhookHandler)
 	Slack.SetReactionHandler(slackReactionHandler)
+	Slack.SetMessageLinks(messageLinks)
+	Slack.SetAppHome(appHome)
+	Slack.SetDiscordSession(Discord.Session)
+	Slack.SetUserLinks(userLinks)
+	Slack.SetChannelPauses(pauses)
+	Slack.SetLinkCodes(linkCodes)
+	Slack.SetEmojiSync(emojiSync)
+
+	emojiSync.SetDiscordSession(Discord.Session)
+
+	slackReactionHandler.SetDiscordSession(Discord.Session)
+	slackReactionHandler.SetSlackBotUser(Slack.BotUserID())
+	discordReacionHandler.SetMessageLinks(messageLinks)
+	discordReacionHandler.SetSlackBotUser(Slack.BotUserID())
+	discordReacionHandler.SetEmojiSync(emojiSync)
+	slackReactionHandler.SetEmojiSync(emojiSync)
 
 	go func() {
 		// start Discord session
@@ -84,6 +134,8 @@ func main() {
 		}
 
 		fmt.Println("Discord session is now running.  Press CTRL-C to exit.")
+
+		emojiSync.SyncAll()
 	}()
 	// start Slack session
 	go Slack.Do()
@@ -95,6 +147,9 @@ func main() {
 
 	// start web configurator
 	var conf = configurator.New(Tokens.Discord.API, Tokens.Slack.API, SettingsFile)
+	conf.SetEmojiCacheStats(func() interface{} {
+		return imager.CacheStats()
+	})
 	switch sockType {
 	case "tcp", "unix":
 		controller, err := conf.Start(os.Getenv("HTTP_PATH_PREFIX"), sockType, listenAddr)
@@ -107,6 +162,7 @@ func main() {
 				switch command {
 				case configurator.CommandRestart:
 					discordWebhookHandler.Reset()
+					go emojiSync.SyncAll()
 				default:
 					continue
 				}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// MessageLinksMax is the number of message pairs kept
+const MessageLinksMax = 5000
+
+// messageLinksCompactLines is the number of lines the log grows to before the old links are dropped from it
+const messageLinksCompactLines = 2 * MessageLinksMax
+
+// MessageLink is a pair of a Discord message and a Slack message bridged each other
+type MessageLink struct {
+	DiscordChannel string `json:"discord_channel"`
+	DiscordMessage string `json:"discord_message"`
+	SlackChannel   string `json:"slack_channel"`
+	SlackTS        string `json:"slack_ts"`
+	SlackThreadTS  string `json:"slack_thread_ts,omitempty"`
+	// DiscordAuthor is the user who wrote the Discord message, used for ss/ editing
+	DiscordAuthor string    `json:"discord_author,omitempty"`
+	Created       time.Time `json:"created"`
+}
+
+// MessageLinks stores bridged message pairs on disk, appending each of them to a JSON Lines log
+type MessageLinks struct {
+	path  string
+	links []MessageLink
+	// lines is the number of lines in the log
+	lines int
+	mu    sync.RWMutex
+}
+
+func NewMessageLinks(path string) *MessageLinks {
+	var m = &MessageLinks{path: path}
+
+	fp, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("ReadMessageLinks: %s\n", err.Error())
+		}
+		return m
+	}
+	defer fp.Close()
+
+	var scanner = bufio.NewScanner(fp)
+	for scanner.Scan() {
+		m.lines++
+
+		var link MessageLink
+		err := json.Unmarshal(scanner.Bytes(), &link)
+		if err != nil {
+			log.Printf("ParseMessageLinks: %s\n", err.Error())
+			continue
+		}
+		m.links = append(m.links, link)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("ReadMessageLinks: %s\n", err.Error())
+	}
+
+	if len(m.links) > MessageLinksMax {
+		m.links = m.links[len(m.links)-MessageLinksMax:]
+	}
+
+	return m
+}
+
+func (m *MessageLinks) Add(link MessageLink) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if link.Created.IsZero() {
+		link.Created = time.Now()
+	}
+
+	m.links = append(m.links, link)
+	if len(m.links) > MessageLinksMax {
+		m.links = m.links[len(m.links)-MessageLinksMax:]
+	}
+
+	if m.lines >= messageLinksCompactLines {
+		m.compact()
+		return
+	}
+	m.append(link)
+}
+
+// FindByDiscord finds the link of a Discord message
+func (m *MessageLinks) FindByDiscord(messageID string) (MessageLink, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := len(m.links) - 1; i >= 0; i-- {
+		if m.links[i].DiscordMessage == messageID {
+			return m.links[i], true
+		}
+	}
+	return MessageLink{}, false
+}
+
+// FindBySlack finds the link of a Slack message
+func (m *MessageLinks) FindBySlack(channel, ts string) (MessageLink, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := len(m.links) - 1; i >= 0; i-- {
+		if m.links[i].SlackChannel == channel && m.links[i].SlackTS == ts {
+			return m.links[i], true
+		}
+	}
+	return MessageLink{}, false
+}
+
+// RecentChannels returns the latest link of each channel pair bridged after since, newest first
+func (m *MessageLinks) RecentChannels(since time.Time, max int) []MessageLink {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found = map[string]bool{}
+	var links = []MessageLink{}
+	for i := len(m.links) - 1; i >= 0 && len(links) < max; i-- {
+		if m.links[i].Created.Before(since) {
+			break
+		}
+		var key = m.links[i].DiscordChannel + "/" + m.links[i].SlackChannel
+		if found[key] {
+			continue
+		}
+		found[key] = true
+		links = append(links, m.links[i])
+	}
+	return links
+}
+
+// ThreadTS returns the timestamp of the Slack thread the linked message belongs to
+func (l MessageLink) ThreadTS() string {
+	if l.SlackThreadTS != "" {
+		return l.SlackThreadTS
+	}
+	return l.SlackTS
+}
+
+// append writes the link at the end of the log
+func (m *MessageLinks) append(link MessageLink) {
+	b, err := json.Marshal(link)
+	if err != nil {
+		log.Printf("MarshalMessageLink: %s\n", err.Error())
+		return
+	}
+
+	fp, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("WriteMessageLinks: %s\n", err.Error())
+		return
+	}
+	defer fp.Close()
+
+	_, err = fp.Write(append(b, '\n'))
+	if err != nil {
+		log.Printf("WriteMessageLinks: %s\n", err.Error())
+		return
+	}
+	m.lines++
+}
+
+// compact rewrites the log with the links kept in memory, dropping the older ones
+func (m *MessageLinks) compact() {
+	var tmp = m.path + ".tmp"
+
+	fp, err := os.Create(tmp)
+	if err != nil {
+		log.Printf("WriteMessageLinks: %s\n", err.Error())
+		return
+	}
+
+	var w = bufio.NewWriter(fp)
+	var encoder = json.NewEncoder(w)
+	for _, link := range m.links {
+		err = encoder.Encode(link)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := fp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, m.path)
+	}
+	if err != nil {
+		log.Printf("CompactMessageLinks: %s\n", err.Error())
+		os.Remove(tmp)
+		return
+	}
+
+	m.lines = len(m.links)
+}
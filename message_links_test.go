@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestMessageLinksLog(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "messages.jsonl")
+	var m = NewMessageLinks(path)
+
+	var total = messageLinksCompactLines + 10
+	for i := 0; i < total; i++ {
+		m.Add(MessageLink{DiscordMessage: fmt.Sprint(i), SlackChannel: "C", SlackTS: fmt.Sprint(i)})
+	}
+
+	if m.lines > messageLinksCompactLines {
+		t.Errorf("lines = %d, want the log compacted", m.lines)
+	}
+
+	var loaded = NewMessageLinks(path)
+	if len(loaded.links) != MessageLinksMax {
+		t.Fatalf("loaded %d links, want %d", len(loaded.links), MessageLinksMax)
+	}
+	if _, ok := loaded.FindBySlack("C", fmt.Sprint(total-1)); !ok {
+		t.Errorf("the last link is not loaded")
+	}
+	if _, ok := loaded.FindByDiscord(fmt.Sprint(total - MessageLinksMax - 1)); ok {
+		t.Errorf("an old link is loaded")
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_emoji_imager"
 )
 
 type SettingsHandler struct {
@@ -16,6 +19,36 @@ type SlackDiscordTable struct {
 	Channel       []ChannelSetting `json:"channel"`
 	SlackSuffix   string           `json:"slack_suffix"`
 	DiscordSuffix string           `json:"discord_suffix"`
+	VoiceRoutes   []VoiceRoute     `json:"voice_routes,omitempty"`
+	Locale        string           `json:"locale,omitempty"`
+	EmojiSync     EmojiSyncSetting `json:"emoji_sync"`
+}
+
+// EmojiSyncSetting selects the Slack custom emoji mirrored as the guild emoji
+type EmojiSyncSetting struct {
+	Enabled bool `json:"enabled"`
+	// Names are the Slack emoji to mirror, and nothing is mirrored if empty
+	Names []string `json:"names,omitempty"`
+}
+
+// VoiceStyle is how voice events are notified
+type VoiceStyle string
+
+const (
+	// VoiceStyleBoard keeps a message showing who is in the channels
+	VoiceStyleBoard VoiceStyle = "board"
+	// VoiceStyleLog posts a line each time a user joins or leaves
+	VoiceStyleLog VoiceStyle = "log"
+	// VoiceStyleSummary posts only the summary of a call
+	VoiceStyleSummary VoiceStyle = "summary"
+)
+
+// VoiceRoute sends the voice events of a voice channel or a category to a Slack channel
+type VoiceRoute struct {
+	Discord string      `json:"discord"`
+	Slack   string      `json:"slack"`
+	Style   VoiceStyle  `json:"style"`
+	Setting SendSetting `json:"setting"`
 }
 
 //ChannelSetting Put send settings
@@ -34,6 +67,61 @@ type SendSetting struct {
 	SendVoiceState           bool `json:"SendVoiceState"`
 	SendMuteState            bool `json:"SendMuteState"`
 	CreateSlackChannelOnSend bool `json:"CreateSlackChannelOnSend"`
+	ReplyAsThread            bool `json:"ReplyAsThread"`
+	SendVoiceSummary         bool `json:"SendVoiceSummary"`
+	VoiceSummaryMinMinutes   int  `json:"VoiceSummaryMinMinutes"`
+	SendStreamState          bool `json:"SendStreamState"`
+	SendVideoState           bool `json:"SendVideoState"`
+	SendStageState           bool `json:"SendStageState"`
+	KeepDiscordOriginal      bool `json:"KeepDiscordOriginal"`
+	KeepSlackOriginal        bool `json:"KeepSlackOriginal"`
+
+	SlackToDiscordReactions ReactionMode `json:"SlackToDiscordReactions,omitempty"`
+	DiscordToSlackReactions ReactionMode `json:"DiscordToSlackReactions,omitempty"`
+
+	VoiceIndicators VoiceIndicators            `json:"VoiceIndicators"`
+	ReactionImage   slack_emoji_imager.Options `json:"ReactionImage"`
+}
+
+// ReactionMode is how the reactions of a message are relayed
+type ReactionMode string
+
+const (
+	// ReactionModeOff does not relay reactions
+	ReactionModeOff ReactionMode = "off"
+	// ReactionModeImage shows reactions as an image on Discord, or emoji blocks on Slack
+	ReactionModeImage ReactionMode = "image"
+	// ReactionModeNative mirrors Unicode emoji as the bot's own reactions, and shows the rest as ReactionModeImage
+	ReactionModeNative ReactionMode = "native"
+	// ReactionModeText shows reactions as a line of emoji and counts
+	ReactionModeText ReactionMode = "text"
+)
+
+// SlackToDiscordReactionMode is how Slack reactions are relayed to Discord
+func (s SendSetting) SlackToDiscordReactionMode() ReactionMode {
+	return s.reactionMode(s.SlackToDiscordReactions)
+}
+
+// DiscordToSlackReactionMode is how Discord reactions are relayed to Slack
+func (s SendSetting) DiscordToSlackReactionMode() ReactionMode {
+	return s.reactionMode(s.DiscordToSlackReactions)
+}
+
+// reactionMode falls back to ReactionModeImage when the mode is not set or unknown
+func (s SendSetting) reactionMode(mode ReactionMode) ReactionMode {
+	switch mode {
+	case ReactionModeOff, ReactionModeImage, ReactionModeNative, ReactionModeText:
+		return mode
+	}
+	return ReactionModeImage
+}
+
+// SendsVoiceStateChange reports whether the change of a voice state should be sent
+func (s SendSetting) SendsVoiceStateChange(change VoiceStateChange) bool {
+	return (s.SendMuteState && change&VoiceMuteChanged != 0) ||
+		(s.SendStreamState && change&VoiceStreamChanged != 0) ||
+		(s.SendVideoState && change&VoiceVideoChanged != 0) ||
+		(s.SendStageState && change&VoiceStageChanged != 0)
 }
 
 func NewSettingsHandler(slackToken, discordToken string) *SettingsHandler {
@@ -99,7 +187,7 @@ func (s SettingsHandler) FindSlackChannel(DiscordChannel string, guildID string)
 	return result
 }
 
-// FindDiscordChannel find Discord channel from slack channel id
+// FindDiscordChannel find Discord channel from slack channel id, with the ID of its guild
 func (s SettingsHandler) FindDiscordChannel(SlackChannel string) (ChannelSetting, string) {
 	var dict = s.readChannelMap()
 	if dict == nil {
@@ -120,9 +208,77 @@ func (s SettingsHandler) FindDiscordChannel(SlackChannel string) (ChannelSetting
 					continue
 				}
 				result.SlackChannel = SlackChannel
-				return result, result.DiscordChannel
+				return result, c.Discord
 			}
 		}
 	}
 	return ChannelSetting{}, ""
 }
+
+// FindVoiceRoutes finds the voice routes of the voice channel or its category
+func (s SettingsHandler) FindVoiceRoutes(guildID, channelID, categoryID string) []VoiceRoute {
+	var routes = []VoiceRoute{}
+	for _, c := range s.readChannelMap() {
+		if c.Discord != guildID {
+			continue
+		}
+		for _, route := range c.VoiceRoutes {
+			if route.Discord == channelID || (categoryID != "" && route.Discord == categoryID) {
+				routes = append(routes, route)
+			}
+		}
+	}
+	return routes
+}
+
+// Locale returns the message catalog of the guild
+func (s SettingsHandler) Locale(guildID string) *locale.Catalog {
+	for _, c := range s.readChannelMap() {
+		if c.Discord == guildID {
+			return locale.Get(c.Locale)
+		}
+	}
+	return locale.Default()
+}
+
+// Includes reports whether the Slack emoji is selected to be mirrored
+func (e EmojiSyncSetting) Includes(name string) bool {
+	if !e.Enabled {
+		return false
+	}
+	for _, n := range e.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// EmojiSync returns the emoji sync setting of the guild
+func (s SettingsHandler) EmojiSync(guildID string) EmojiSyncSetting {
+	for _, c := range s.readChannelMap() {
+		if c.Discord == guildID {
+			return c.EmojiSync
+		}
+	}
+	return EmojiSyncSetting{}
+}
+
+// Guilds returns the Discord guilds listed in settings
+func (s SettingsHandler) Guilds() []string {
+	var guilds = []string{}
+	for _, c := range s.readChannelMap() {
+		guilds = append(guilds, c.Discord)
+	}
+	return guilds
+}
+
+// HasGuild reports whether the Discord guild is listed in settings
+func (s SettingsHandler) HasGuild(guildID string) bool {
+	for _, c := range s.readChannelMap() {
+		if c.Discord == guildID {
+			return true
+		}
+	}
+	return false
+}
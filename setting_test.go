@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestReactionMode(t *testing.T) {
+	var cases = []struct {
+		name    string
+		setting SendSetting
+		want    ReactionMode
+	}{
+		{"default", SendSetting{}, ReactionModeImage},
+		{"off", SendSetting{SlackToDiscordReactions: ReactionModeOff}, ReactionModeOff},
+		{"image", SendSetting{SlackToDiscordReactions: ReactionModeImage}, ReactionModeImage},
+		{"native", SendSetting{SlackToDiscordReactions: ReactionModeNative}, ReactionModeNative},
+		{"text", SendSetting{SlackToDiscordReactions: ReactionModeText}, ReactionModeText},
+		{"invalid", SendSetting{SlackToDiscordReactions: "gif"}, ReactionModeImage},
+	}
+
+	for _, c := range cases {
+		if mode := c.setting.SlackToDiscordReactionMode(); mode != c.want {
+			t.Errorf("%s: SlackToDiscordReactionMode() = %q; want %q", c.name, mode, c.want)
+		}
+
+		// the other direction falls back to the same mode
+		var swapped = c.setting
+		swapped.SlackToDiscordReactions, swapped.DiscordToSlackReactions = "", c.setting.SlackToDiscordReactions
+		if mode := swapped.DiscordToSlackReactionMode(); mode != c.want {
+			t.Errorf("%s: DiscordToSlackReactionMode() = %q; want %q", c.name, mode, c.want)
+		}
+	}
+}
+
+func TestReactionModeDirections(t *testing.T) {
+	var setting = SendSetting{
+		SlackToDiscordReactions: ReactionModeText,
+		DiscordToSlackReactions: ReactionModeNative,
+	}
+
+	if mode := setting.SlackToDiscordReactionMode(); mode != ReactionModeText {
+		t.Errorf("SlackToDiscordReactionMode() = %q; want %q", mode, ReactionModeText)
+	}
+	if mode := setting.DiscordToSlackReactionMode(); mode != ReactionModeNative {
+		t.Errorf("DiscordToSlackReactionMode() = %q; want %q", mode, ReactionModeNative)
+	}
+}
+
+func TestEmojiSyncIncludes(t *testing.T) {
+	var cases = []struct {
+		name    string
+		setting EmojiSyncSetting
+		want    bool
+	}{
+		{"selected", EmojiSyncSetting{Enabled: true, Names: []string{"kmc", "party-parrot"}}, true},
+		{"not selected", EmojiSyncSetting{Enabled: true, Names: []string{"kmc"}}, false},
+		{"no names", EmojiSyncSetting{Enabled: true}, false},
+		{"disabled", EmojiSyncSetting{Names: []string{"party-parrot"}}, false},
+	}
+
+	for _, c := range cases {
+		if got := c.setting.Includes("party-parrot"); got != c.want {
+			t.Errorf("%s: Includes() = %v; want %v", c.name, got, c.want)
+		}
+	}
+}
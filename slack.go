@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -10,7 +11,9 @@ import (
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_embed_maker"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_webhook"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/emoji"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
 	"github.com/pkg/errors"
 	"github.com/slack-go/slack"
@@ -18,8 +21,6 @@ import (
 	scm "github.com/slack-go/slack/socketmode"
 )
 
-type SlackLastMessages map[string]string
-
 type SlackHandler struct {
 	api     *slack.Client
 	userAPI *slack.Client
@@ -40,10 +41,23 @@ type SlackHandler struct {
 	userToken  string
 
 	workspaceURI string
+	botID        string
+	botUserID    string
 
 	settings *SettingsHandler
 
 	reactionHandler ReactionHandler
+	messageLinks    *MessageLinks
+	appHome         *AppHome
+
+	// reactionDebouncer coalesces the reaction events of a message
+	reactionDebouncer *Debouncer
+
+	discord   *discordgo.Session
+	userLinks *UserLinks
+	pauses    *ChannelPauses
+	linkCodes *LinkCodes
+	emojiSync *EmojiSync
 }
 
 func NewSlackBot(apiToken, eventToken string, settings *SettingsHandler) *SlackHandler {
@@ -65,9 +79,16 @@ func NewSlackBot(apiToken, eventToken string, settings *SettingsHandler) *SlackH
 	slackBot.eventToken = eventToken
 
 	slackBot.settings = settings
+	slackBot.reactionDebouncer = NewDebouncer(ReactionDebounceDelay, ReactionDebounceMaxWait)
 
-	res, _ := slackBot.api.AuthTest()
-	slackBot.workspaceURI = res.URL
+	res, err := slackBot.api.AuthTest()
+	if err != nil {
+		log.Printf("AuthTest: %s\n", err.Error())
+	} else {
+		slackBot.workspaceURI = res.URL
+		slackBot.botID = res.BotID
+		slackBot.botUserID = res.UserID
+	}
 
 	slackBot.messageUnescaper = strings.NewReplacer(
 		"&amp;", "&",
@@ -90,6 +111,14 @@ func (s *SlackHandler) Do() {
 		switch ev.Type {
 		case scm.EventTypeConnected:
 			fmt.Printf("Start websocket connection with Slack\n")
+		case scm.EventTypeSlashCommand:
+			cmd, ok := ev.Data.(slack.SlashCommand)
+			if !ok {
+				s.scm.Ack(*ev.Request)
+				continue
+			}
+			s.scm.Ack(*ev.Request)
+			go s.respondCommand(cmd)
 		case scm.EventTypeEventsAPI:
 			s.scm.Ack(*ev.Request)
 
@@ -101,16 +130,23 @@ func (s *SlackHandler) Do() {
 			case slackevents.CallbackEvent:
 				switch evi := evp.InnerEvent.Data.(type) {
 				case *slackevents.AppMentionEvent:
+				case *slackevents.AppHomeOpenedEvent:
+					if evi.Tab == "home" && s.appHome != nil {
+						go s.appHome.Open(evi.User)
+					}
 				case *slackevents.MessageEvent:
-					s.messageHandle(evi)
+					s.messageHandle(evi, rawInnerEvent(ev.Request.Payload))
+				case *slackevents.LinkSharedEvent:
+					s.linkSharedHandle(evi)
 				case *slackevents.EmojiChangedEvent:
 					s.emojiChangeHandle(evi)
 				case *slackevents.ReactionAddedEvent:
-					if evi.Item.Type == "message" {
+					// reactions by this bot are mirrored from Discord
+					if evi.Item.Type == "message" && evi.User != s.botUserID {
 						s.reactionHandle(evi.Item.Channel, evi.Item.Timestamp)
 					}
 				case *slackevents.ReactionRemovedEvent:
-					if evi.Item.Type == "message" {
+					if evi.Item.Type == "message" && evi.User != s.botUserID {
 						s.reactionHandle(evi.Item.Channel, evi.Item.Timestamp)
 					}
 				}
@@ -120,10 +156,39 @@ func (s *SlackHandler) Do() {
 	}
 }
 
+// BotUserID returns the Slack user of this bot
+func (s *SlackHandler) BotUserID() string {
+	return s.botUserID
+}
+
 func (s *SlackHandler) SetReactionHandler(handler ReactionHandler) {
 	s.reactionHandler = handler
 }
 
+func (s *SlackHandler) SetMessageLinks(links *MessageLinks) {
+	s.messageLinks = links
+}
+
+func (s *SlackHandler) SetAppHome(home *AppHome) {
+	s.appHome = home
+}
+
+func (s *SlackHandler) SetDiscordSession(session *discordgo.Session) {
+	s.discord = session
+}
+
+func (s *SlackHandler) SetUserLinks(links *UserLinks) {
+	s.userLinks = links
+}
+
+func (s *SlackHandler) SetChannelPauses(pauses *ChannelPauses) {
+	s.pauses = pauses
+}
+
+func (s *SlackHandler) SetLinkCodes(codes *LinkCodes) {
+	s.linkCodes = codes
+}
+
 func (s *SlackHandler) SetDiscordWebhook(hook *discord_webhook.Handler) {
 	s.discordHook = hook
 }
@@ -132,18 +197,27 @@ func (s *SlackHandler) SetSlackWebhook(hook *slack_webhook.Handler) {
 	s.hook = hook
 }
 
+func (s *SlackHandler) SetEmojiSync(emojiSync *EmojiSync) {
+	s.emojiSync = emojiSync
+}
+
 func (s *SlackHandler) SetUserToken(token string) {
 	s.userToken = token
 	s.userAPI = slack.New(token)
 }
 
 func (s *SlackHandler) reactionHandle(channel string, timestamp string) {
-	if s.reactionHandler != nil {
+	if s.reactionHandler == nil {
+		return
+	}
+
+	// only the final state of quick reactions is rendered
+	s.reactionDebouncer.Do(channel+"/"+timestamp, func() {
 		err := s.reactionHandler.GetReaction(channel, timestamp)
 		if err != nil {
 			log.Println("GetReaction:", err)
 		}
-	}
+	})
 }
 
 func (s *SlackHandler) emojiChangeHandle(ev *slackevents.EmojiChangedEvent) {
@@ -154,22 +228,45 @@ func (s *SlackHandler) emojiChangeHandle(ev *slackevents.EmojiChangedEvent) {
 			uri = s.reactionHandler.GetEmojiURI(strings.TrimPrefix(uri, "alias:"))
 		}
 		s.reactionHandler.AddEmoji(ev.Name, uri)
+		go s.emojiSync.SyncAll()
 	case "remove":
 		for _, name := range ev.Names {
 			s.reactionHandler.RemoveEmoji(name)
 		}
+		go s.emojiSync.SyncAll()
 	case "rename":
 		s.reactionHandler.RemoveEmoji(ev.OldName)
 		s.reactionHandler.AddEmoji(ev.NewName, ev.Value)
+		go s.emojiSync.Rename(ev.OldName, ev.NewName)
 	}
 }
 
-func (s *SlackHandler) messageHandle(ev *slackevents.MessageEvent) {
+// rawInnerEvent extracts the inner event of an Events API payload,
+// which has fields slackevents does not parse such as blocks
+func rawInnerEvent(payload json.RawMessage) json.RawMessage {
+	var attr struct {
+		Event json.RawMessage `json:"event"`
+	}
+	json.Unmarshal(payload, &attr)
+	return attr.Event
+}
+
+func (s *SlackHandler) messageHandle(ev *slackevents.MessageEvent, raw json.RawMessage) {
 	var cs, discordID = s.settings.FindDiscordChannel(ev.Channel)
 	//Confirm Slack to Discord setting
 	if !cs.Setting.SlackToDiscord {
 		return
 	}
+	if paused, _ := s.pauses.Paused(ev.Channel); paused {
+		return
+	}
+
+	// Messages of integrations have no user. Ignore messages of this bot itself,
+	// and all of them when this bot is unknown, not to loop its own messages.
+	var isBot = ev.User == ""
+	if isBot && (ev.SubType != "bot_message" || ev.BotID == "" || s.botID == "" || ev.BotID == s.botID) {
+		return
+	}
 
 	type imageFileType struct {
 		info   slackevents.File
@@ -178,22 +275,32 @@ func (s *SlackHandler) messageHandle(ev *slackevents.MessageEvent) {
 
 	var ImageFiles []imageFileType
 	var files = []slackevents.File{}
+	// downloadFailed is set if some images are not sent to Discord
+	var downloadFailed bool
 
 	for _, f := range ev.Files {
 		// if the file is image, upload it for discord
 		if f.Filetype == "png" || f.Filetype == "jpg" || f.Filetype == "gif" {
 			req, err := http.NewRequest("GET", f.URLPrivate, nil)
-
-			req.Header.Set("Authorization", "Bearer "+s.apiToken)
 			if err != nil {
+				downloadFailed = true
 				continue
 			}
 
+			req.Header.Set("Authorization", "Bearer "+s.apiToken)
+
 			resp, err := http.DefaultClient.Do(req)
 			if err != nil {
+				downloadFailed = true
 				continue
 			}
 			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				// the body is an error page, not the image
+				log.Printf("DownloadSlackFile: %s %s\n", f.Name, resp.Status)
+				downloadFailed = true
+				continue
+			}
 			var image = imageFileType{
 				info:   f,
 				reader: resp.Body,
@@ -209,15 +316,33 @@ func (s *SlackHandler) messageHandle(ev *slackevents.MessageEvent) {
 	if err != nil {
 		return
 	}
+	text = s.emojiSync.Emojize(discordID, text)
 
-	user, err := s.api.GetUserInfo(ev.User)
-	if err != nil {
-		return
+	var name, iconURL string
+	if isBot {
+		name, iconURL = s.botProfile(ev)
+	} else {
+		user, err := s.api.GetUserInfo(ev.User)
+		if err != nil {
+			return
+		}
+
+		name = user.Profile.DisplayName
+		if name == "" {
+			name = user.RealName
+		}
+		iconURL = user.Profile.ImageOriginal
 	}
 
-	var name = user.Profile.DisplayName
-	if name == "" {
-		name = user.RealName
+	var embeds = discord_embed_maker.FromAttachments(ev.Attachments, s.userName)
+	var blocks = discord_embed_maker.ParseBlocks(raw)
+	if !discord_embed_maker.OnlyRichText(blocks) {
+		var blockEmbeds = discord_embed_maker.FromBlocks(blocks, s.userName)
+		if len(blockEmbeds) > 0 {
+			// text is only a notification fallback when a message has blocks
+			text = ""
+			embeds = append(blockEmbeds, embeds...)
+		}
 	}
 
 	// send file links by webhook
@@ -239,75 +364,184 @@ func (s *SlackHandler) messageHandle(ev *slackevents.MessageEvent) {
 
 	// Send by webhook
 	var message = discord_webhook.Message{
-		AvaterURL: user.Profile.ImageOriginal,
+		AvaterURL: iconURL,
 		UserName:  name,
 		Message: &discordgo.Message{
 			GuildID:   discordID,
 			ChannelID: cs.DiscordChannel,
 			Content:   text,
+			Embeds:    discord_embed_maker.Limit(embeds),
 		},
 	}
 
-	newMessage, err := s.discordHook.Send(cs.DiscordChannel, message, true, dFiles)
+	var replyTo string
+	if cs.Setting.ReplyAsThread && ev.ThreadTimeStamp != "" && ev.ThreadTimeStamp != ev.TimeStamp {
+		if link, ok := s.messageLinks.FindBySlack(ev.Channel, ev.ThreadTimeStamp); ok {
+			replyTo = link.DiscordMessage
+		} else if parent, err := s.hook.GetMessage(ev.Channel, ev.ThreadTimeStamp); err == nil {
+			// the thread parent is not bridged, so quote it instead
+			parentText, _ := s.EscapeMessage(trimDummyURI(parent.Text))
+			message.Content = fmt.Sprintf("%s\n%s", quote(parentText, s.settings.Locale(discordID)), message.Content)
+		}
+	}
+
+	var newMessage *discord_webhook.Message
+	if replyTo != "" {
+		message.MessageReference = &discordgo.MessageReference{
+			MessageID: replyTo,
+			ChannelID: cs.DiscordChannel,
+		}
+		message.Content = fmt.Sprintf("**%s**\n%s", name, message.Content)
+		newMessage, err = s.discordHook.Reply(cs.DiscordChannel, message, dFiles)
+	} else {
+		newMessage, err = s.discordHook.Send(cs.DiscordChannel, message, true, dFiles)
+	}
 	if err != nil {
 		log.Println(errors.Wrap(err, "ResendingFileMessage: "))
 		return
 	}
 
-	// if user api token is provided, delete message and repost it.
-	if s.userAPI != nil {
-		_, _, err := s.userAPI.DeleteMessage(ev.Channel, ev.TimeStamp)
-		if err == nil {
-			var content = fmt.Sprintf("%s <%s%s|%s>", ev.Text, SlackMessageDummyURI, newMessage.Timestamp, "ㅤ")
-			var blocks = []slack_webhook.BlockBase{}
+	var slackTS = ev.TimeStamp
+	var sent = newMessage != nil && newMessage.Message != nil && newMessage.ID != ""
 
-			for i, image := range ImageFiles {
-				if len(newMessage.Attachments) > i {
-					var block = slack_webhook.ImageBlock(newMessage.Attachments[i].URL, image.info.Name)
-					block.Title = slack_webhook.ImageTitle(image.info.Name, false)
-					blocks = append(blocks, block)
-				}
-			}
+	// if user api token is provided, delete message and repost it,
+	// but only if the whole message has reached Discord.
+	if s.userAPI != nil && !isBot && !cs.Setting.KeepSlackOriginal {
+		var images = []slackevents.File{}
+		for _, image := range ImageFiles {
+			images = append(images, image.info)
+		}
 
-			for _, file := range files {
-				var externalID = fmt.Sprintf("%s:%s", ProgramName, file.ID)
-				_, err := s.hook.FilesRemoteAdd(
-					slack_webhook.FilesRemoteAddParameters{
-						Title:       file.Name,
-						ExternalURL: file.Permalink,
-						ExternalID:  externalID,
-						FileType:    file.Filetype,
-					},
-				)
-				if err != nil {
-					log.Printf("FilesRemoteAddError: %s\n", err.Error())
-					continue
-				}
-				blocks = append(blocks, slack_webhook.FileBlock(externalID))
-			}
+		if !fullySent(newMessage, downloadFailed, len(images)) {
+			log.Printf("RepostSkipped: the message %s was not fully sent to Discord\n", ev.TimeStamp)
+		} else if ts, err := s.repost(ev, name, iconURL, newMessage, images, files); err != nil {
+			log.Printf("RepostError: %s\n", err.Error())
+		} else {
+			slackTS = ts
+		}
+	}
 
-			if len(ImageFiles) > 0 && ev.Text != "" {
-				var section = slack_webhook.SectionBlock()
-				section.Text = slack_webhook.MrkdwnElement(content)
-				blocks = append([]slack_webhook.BlockBase{section}, blocks...)
-			}
+	if sent {
+		s.messageLinks.Add(MessageLink{
+			DiscordChannel: cs.DiscordChannel,
+			DiscordMessage: newMessage.ID,
+			SlackChannel:   ev.Channel,
+			SlackTS:        slackTS,
+			SlackThreadTS:  ev.ThreadTimeStamp,
+		})
+	}
 
-			var message = slack_webhook.Message{
-				IconURL:     user.Profile.ImageOriginal,
-				Username:    name,
-				Channel:     ev.Channel,
-				Text:        content,
-				Blocks:      blocks,
-				UnfurlLinks: true,
-				UnfurlMedia: true,
-				LinkNames:   true,
-			}
+}
 
-			// Send message to Slack
-			s.hook.Send(message)
+// fullySent reports whether the message reached Discord with all of its images,
+// which is needed before the Slack message is deleted and reposted
+func fullySent(message *discord_webhook.Message, downloadFailed bool, images int) bool {
+	if message == nil || message.Message == nil || message.ID == "" || downloadFailed {
+		return false
+	}
+	return len(message.Attachments) >= images
+}
+
+// repost posts the message again through the bot with the link to the Discord message, then deletes the original.
+// The repost stays in the thread of the original and shares its files; it is removed if the original cannot be deleted.
+func (s *SlackHandler) repost(ev *slackevents.MessageEvent, name, iconURL string, sent *discord_webhook.Message, images, files []slackevents.File) (string, error) {
+	var content = fmt.Sprintf("%s <%s%s|%s>", ev.Text, SlackMessageDummyURI, sent.Timestamp, "ㅤ")
+	var blocks = []slack_webhook.BlockBase{}
+
+	for i, image := range images {
+		var block = slack_webhook.ImageBlock(sent.Attachments[i].URL, image.Name)
+		block.Title = slack_webhook.ImageTitle(image.Name, false)
+		blocks = append(blocks, block)
+	}
+
+	for _, file := range files {
+		var externalID = fmt.Sprintf("%s:%s", ProgramName, file.ID)
+		_, err := s.hook.FilesRemoteAdd(
+			slack_webhook.FilesRemoteAddParameters{
+				Title:       file.Name,
+				ExternalURL: file.Permalink,
+				ExternalID:  externalID,
+				FileType:    file.Filetype,
+			},
+		)
+		if err != nil {
+			// the file would be lost with the original
+			return "", errors.Wrap(err, "FilesRemoteAdd")
 		}
+		blocks = append(blocks, slack_webhook.FileBlock(externalID))
 	}
 
+	if len(images) > 0 && ev.Text != "" {
+		var section = slack_webhook.SectionBlock()
+		section.Text = slack_webhook.MrkdwnElement(content)
+		blocks = append([]slack_webhook.BlockBase{section}, blocks...)
+	}
+
+	var message = slack_webhook.Message{
+		IconURL:     iconURL,
+		Username:    name,
+		Channel:     ev.Channel,
+		Text:        content,
+		Blocks:      blocks,
+		UnfurlLinks: true,
+		UnfurlMedia: true,
+		LinkNames:   true,
+	}
+	if ev.ThreadTimeStamp != "" && ev.ThreadTimeStamp != ev.TimeStamp {
+		message.ThreadTimestamp = ev.ThreadTimeStamp
+		message.ReplyBroadcast = ev.SubType == "thread_broadcast"
+	}
+
+	ts, err := s.hook.Send(message)
+	if err != nil {
+		return "", errors.Wrap(err, "Send")
+	}
+
+	_, _, err = s.userAPI.DeleteMessage(ev.Channel, ev.TimeStamp)
+	if err != nil {
+		if _, rerr := s.hook.Remove(ev.Channel, ts); rerr != nil {
+			log.Printf("RemoveRepost: %s\n", rerr.Error())
+		}
+		return "", errors.Wrap(err, "DeleteOriginal")
+	}
+
+	return ts, nil
+}
+
+// botProfile returns the name and the icon of an integration which posted the message
+func (s *SlackHandler) botProfile(ev *slackevents.MessageEvent) (name, iconURL string) {
+	name = ev.Username
+	if ev.Icons != nil {
+		iconURL = ev.Icons.IconURL
+	}
+	if name != "" && iconURL != "" {
+		return
+	}
+
+	bot, err := s.api.GetBotInfo(ev.BotID)
+	if err != nil {
+		log.Printf("GetBotInfo: %s\n", err.Error())
+		return
+	}
+	if name == "" {
+		name = bot.Name
+	}
+	if iconURL == "" {
+		iconURL = bot.Icons.Image72
+	}
+	return
+}
+
+// userName returns the display name of a Slack user, or an empty string if it is unknown
+func (s *SlackHandler) userName(userID string) string {
+	u, err := s.api.GetUserInfo(userID)
+	if err != nil {
+		return ""
+	}
+	if u.Profile.DisplayName != "" {
+		return u.Profile.DisplayName
+	}
+	return u.RealName
 }
 
 func (s *SlackHandler) EscapeMessage(content string) (output string, err error) {
@@ -356,5 +590,5 @@ func (s *SlackHandler) EscapeMessage(content string) (output string, err error)
 		)
 	}
 
-	return s.messageUnescaper.Replace(content), nil
+	return s.messageUnescaper.Replace(emoji.Emojize(content)), nil
 }
@@ -0,0 +1,90 @@
+package slack_attachment_maker
+
+import (
+	"regexp"
+	"strings"
+)
+
+var markdownRegExp = struct {
+	codeBlock   *regexp.Regexp
+	inlineCode  *regexp.Regexp
+	bareLink    *regexp.Regexp
+	customEmoji *regexp.Regexp
+	maskedLink  *regexp.Regexp
+	bold        *regexp.Regexp
+	italic      *regexp.Regexp
+	underline   *regexp.Regexp
+	strike      *regexp.Regexp
+	spoiler     *regexp.Regexp
+	heading     *regexp.Regexp
+}{
+	codeBlock:   regexp.MustCompile("(?s)```.*?```"),
+	inlineCode:  regexp.MustCompile("`[^`\n]+`"),
+	bareLink:    regexp.MustCompile(`&lt;(https?://\S+?)&gt;`),
+	customEmoji: regexp.MustCompile(`&lt;a?:(\w+):\d+&gt;`),
+	maskedLink:  regexp.MustCompile(`\[([^\[\]\n]+)\]\((https?://[^\s)]+)\)`),
+	bold:        regexp.MustCompile(`\*\*([^\n]+?)\*\*`),
+	italic:      regexp.MustCompile(`\*([^*\n]+)\*`),
+	underline:   regexp.MustCompile(`__([^\n]+?)__`),
+	strike:      regexp.MustCompile(`~~([^\n]+?)~~`),
+	spoiler:     regexp.MustCompile(`\|\|([^\n]+?)\|\|`),
+	heading:     regexp.MustCompile(`(?m)^#{1,3} +(.+)$`),
+}
+
+var slackEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+)
+
+// boldMarker temporarily replaces "**" while single asterisks are converted to underscores
+const boldMarker = "\x00"
+
+// ToMrkdwn translates Discord markdown into Slack mrkdwn.
+// Code spans and code blocks are kept as they are.
+func ToMrkdwn(text string) string {
+	var result strings.Builder
+
+	var codes = markdownRegExp.codeBlock.FindAllStringIndex(text, -1)
+	var last int
+	for _, code := range codes {
+		result.WriteString(translateInline(text[last:code[0]]))
+		result.WriteString(slackEscaper.Replace(text[code[0]:code[1]]))
+		last = code[1]
+	}
+	result.WriteString(translateInline(text[last:]))
+
+	return result.String()
+}
+
+func translateInline(text string) string {
+	var result strings.Builder
+
+	var codes = markdownRegExp.inlineCode.FindAllStringIndex(text, -1)
+	var last int
+	for _, code := range codes {
+		result.WriteString(translate(text[last:code[0]]))
+		result.WriteString(slackEscaper.Replace(text[code[0]:code[1]]))
+		last = code[1]
+	}
+	result.WriteString(translate(text[last:]))
+
+	return result.String()
+}
+
+func translate(text string) string {
+	text = slackEscaper.Replace(text)
+
+	text = markdownRegExp.bareLink.ReplaceAllString(text, "<$1>")
+	text = markdownRegExp.customEmoji.ReplaceAllString(text, ":$1:")
+	text = markdownRegExp.maskedLink.ReplaceAllString(text, "<$2|$1>")
+
+	text = markdownRegExp.heading.ReplaceAllString(text, boldMarker+"$1"+boldMarker)
+	text = markdownRegExp.bold.ReplaceAllString(text, boldMarker+"$1"+boldMarker)
+	text = markdownRegExp.italic.ReplaceAllString(text, "_${1}_")
+	text = markdownRegExp.underline.ReplaceAllString(text, "$1")
+	text = markdownRegExp.strike.ReplaceAllString(text, "~$1~")
+	text = markdownRegExp.spoiler.ReplaceAllString(text, "$1")
+
+	return strings.ReplaceAll(text, boldMarker, "*")
+}
@@ -0,0 +1,26 @@
+package slack_attachment_maker
+
+import "testing"
+
+func TestToMrkdwn(t *testing.T) {
+	var cases = []struct {
+		input  string
+		expect string
+	}{
+		{"**bold** and *italic*", "*bold* and _italic_"},
+		{"~~strike~~ __underline__ ||spoiler||", "~strike~ underline spoiler"},
+		{"[docs](https://example.com/a?b=1&c=2)", "<https://example.com/a?b=1&amp;c=2|docs>"},
+		{"<https://example.com> a < b", "<https://example.com> a &lt; b"},
+		{"`**not bold**` **bold**", "`**not bold**` *bold*"},
+		{"```\n*keep*\n```", "```\n*keep*\n```"},
+		{"# Title", "*Title*"},
+		{"<:party:123456> <a:dance:42>", ":party: :dance:"},
+	}
+
+	for _, c := range cases {
+		var output = ToMrkdwn(c.input)
+		if output != c.expect {
+			t.Errorf("ToMrkdwn(%q): expected %q, but got %q", c.input, c.expect, output)
+		}
+	}
+}
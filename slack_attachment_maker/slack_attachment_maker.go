@@ -0,0 +1,138 @@
+package slack_attachment_maker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
+	"github.com/slack-go/slack"
+)
+
+// Slack truncates or rejects attachments over these sizes
+const (
+	MaxAttachments  = 20
+	MaxFields       = 20
+	MaxTitleLength  = 256
+	MaxTextLength   = 3000
+	MaxFieldLength  = 2000
+	MaxFooterLength = 300
+)
+
+// Build converts Discord embeds into Slack attachments.
+// Embeds which only preview a URL contained in content are skipped,
+// because Slack unfurls them by itself.
+func Build(embeds []*discordgo.MessageEmbed, content string) []slack_webhook.Attachment {
+	var attachments = []slack_webhook.Attachment{}
+
+	for _, embed := range embeds {
+		if embed == nil {
+			continue
+		}
+		if embed.Type != discordgo.EmbedTypeRich && embed.URL != "" && strings.Contains(content, embed.URL) {
+			continue
+		}
+
+		attachments = append(attachments, Convert(embed))
+
+		if len(attachments) >= MaxAttachments {
+			break
+		}
+	}
+
+	return attachments
+}
+
+// Convert converts a Discord embed into a Slack attachment
+func Convert(embed *discordgo.MessageEmbed) slack_webhook.Attachment {
+	var attachment = slack_webhook.Attachment{
+		Title:      truncate(embed.Title, MaxTitleLength),
+		TitleLink:  embed.URL,
+		Text:       truncate(ToMrkdwn(embed.Description), MaxTextLength),
+		MarkdownIn: []string{"text", "fields"},
+	}
+
+	if embed.Color != 0 {
+		attachment.Color = fmt.Sprintf("#%06x", embed.Color)
+	}
+
+	if embed.Author != nil {
+		attachment.AuthorName = truncate(embed.Author.Name, MaxTitleLength)
+		attachment.AuthorLink = embed.Author.URL
+		attachment.AuthorIcon = embed.Author.IconURL
+	}
+
+	if embed.Provider != nil {
+		attachment.ServiceName = embed.Provider.Name
+	}
+
+	for i, field := range embed.Fields {
+		if field == nil {
+			continue
+		}
+		if i >= MaxFields {
+			break
+		}
+
+		attachment.Fields = append(attachment.Fields, slack.AttachmentField{
+			Title: truncate(field.Name, MaxTitleLength),
+			Value: truncate(ToMrkdwn(field.Value), MaxFieldLength),
+			Short: field.Inline,
+		})
+	}
+
+	switch {
+	case embed.Image != nil:
+		attachment.ImageURL = embed.Image.URL
+		if embed.Thumbnail != nil {
+			attachment.ThumbURL = embed.Thumbnail.URL
+		}
+	case embed.Thumbnail != nil && embed.Type != discordgo.EmbedTypeRich:
+		// link previews put their main picture in the thumbnail
+		attachment.ImageURL = embed.Thumbnail.URL
+	case embed.Thumbnail != nil:
+		attachment.ThumbURL = embed.Thumbnail.URL
+	}
+
+	if embed.Footer != nil {
+		attachment.Footer = truncate(embed.Footer.Text, MaxFooterLength)
+		attachment.FooterIcon = embed.Footer.IconURL
+	}
+
+	if embed.Timestamp != "" {
+		t, err := time.Parse(time.RFC3339, embed.Timestamp)
+		if err == nil {
+			attachment.Ts = json.Number(strconv.FormatInt(t.Unix(), 10))
+		}
+	}
+
+	attachment.Fallback = fallback(embed)
+
+	return attachment
+}
+
+func fallback(embed *discordgo.MessageEmbed) string {
+	for _, text := range []string{embed.Title, embed.Description, embed.URL} {
+		if text != "" {
+			return truncate(text, MaxTitleLength)
+		}
+	}
+	if embed.Author != nil && embed.Author.Name != "" {
+		return truncate(embed.Author.Name, MaxTitleLength)
+	}
+
+	return "Discord Embed"
+}
+
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	var runes = []rune(text)
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,157 @@
+package slack_attachment_maker
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
+	"github.com/slack-go/slack"
+)
+
+func TestConvert(t *testing.T) {
+	var cases = []struct {
+		name   string
+		embed  *discordgo.MessageEmbed
+		check  func(a slack_webhook.Attachment) bool
+		expect string
+	}{
+		{
+			name:   "color",
+			embed:  &discordgo.MessageEmbed{Title: "t", Color: 0x4a154b},
+			check:  func(a slack_webhook.Attachment) bool { return a.Color == "#4a154b" },
+			expect: "color #4a154b",
+		},
+		{
+			name:   "no color",
+			embed:  &discordgo.MessageEmbed{Title: "t"},
+			check:  func(a slack_webhook.Attachment) bool { return a.Color == "" },
+			expect: "no color",
+		},
+		{
+			name:  "title and description",
+			embed: &discordgo.MessageEmbed{Title: "Title", URL: "https://example.com", Description: "**bold**"},
+			check: func(a slack_webhook.Attachment) bool {
+				return a.Title == "Title" && a.TitleLink == "https://example.com" && a.Text == "*bold*" && a.Fallback == "Title"
+			},
+			expect: "title, link, translated text and fallback",
+		},
+		{
+			name: "fields",
+			embed: &discordgo.MessageEmbed{Fields: []*discordgo.MessageEmbedField{
+				{Name: "a", Value: "~~x~~", Inline: true},
+				nil,
+				{Name: "b", Value: "y"},
+			}},
+			check: func(a slack_webhook.Attachment) bool {
+				return len(a.Fields) == 2 &&
+					a.Fields[0] == slack.AttachmentField{Title: "a", Value: "~x~", Short: true} &&
+					a.Fields[1] == slack.AttachmentField{Title: "b", Value: "y"}
+			},
+			expect: "2 translated fields",
+		},
+		{
+			name:   "too many fields",
+			embed:  &discordgo.MessageEmbed{Fields: manyFields(MaxFields + 5)},
+			check:  func(a slack_webhook.Attachment) bool { return len(a.Fields) == MaxFields },
+			expect: "MaxFields fields",
+		},
+		{
+			name: "image and thumbnail",
+			embed: &discordgo.MessageEmbed{
+				Type:      discordgo.EmbedTypeRich,
+				Image:     &discordgo.MessageEmbedImage{URL: "image.png"},
+				Thumbnail: &discordgo.MessageEmbedThumbnail{URL: "thumb.png"},
+			},
+			check:  func(a slack_webhook.Attachment) bool { return a.ImageURL == "image.png" && a.ThumbURL == "thumb.png" },
+			expect: "image and thumbnail",
+		},
+		{
+			name: "thumbnail of rich embed",
+			embed: &discordgo.MessageEmbed{
+				Type:      discordgo.EmbedTypeRich,
+				Thumbnail: &discordgo.MessageEmbedThumbnail{URL: "thumb.png"},
+			},
+			check:  func(a slack_webhook.Attachment) bool { return a.ImageURL == "" && a.ThumbURL == "thumb.png" },
+			expect: "thumbnail only",
+		},
+		{
+			name: "thumbnail of link preview",
+			embed: &discordgo.MessageEmbed{
+				Type:      discordgo.EmbedTypeLink,
+				Thumbnail: &discordgo.MessageEmbedThumbnail{URL: "thumb.png"},
+			},
+			check:  func(a slack_webhook.Attachment) bool { return a.ImageURL == "thumb.png" && a.ThumbURL == "" },
+			expect: "thumbnail as image",
+		},
+		{
+			name: "author and footer",
+			embed: &discordgo.MessageEmbed{
+				Author:    &discordgo.MessageEmbedAuthor{Name: "author", URL: "https://example.com/a", IconURL: "a.png"},
+				Footer:    &discordgo.MessageEmbedFooter{Text: "footer", IconURL: "f.png"},
+				Provider:  &discordgo.MessageEmbedProvider{Name: "provider"},
+				Timestamp: "2021-04-01T20:00:00+09:00",
+			},
+			check: func(a slack_webhook.Attachment) bool {
+				return a.AuthorName == "author" && a.AuthorLink == "https://example.com/a" && a.AuthorIcon == "a.png" &&
+					a.Footer == "footer" && a.FooterIcon == "f.png" && a.ServiceName == "provider" &&
+					a.Ts == json.Number("1617274800") && a.Fallback == "author"
+			},
+			expect: "author, footer, provider, timestamp and fallback",
+		},
+		{
+			name:  "long title",
+			embed: &discordgo.MessageEmbed{Title: strings.Repeat("あ", MaxTitleLength+1)},
+			check: func(a slack_webhook.Attachment) bool {
+				return len([]rune(a.Title)) == MaxTitleLength && strings.HasSuffix(a.Title, "…")
+			},
+			expect: "truncated title",
+		},
+		{
+			name:   "empty",
+			embed:  &discordgo.MessageEmbed{},
+			check:  func(a slack_webhook.Attachment) bool { return a.Fallback == "Discord Embed" },
+			expect: "default fallback",
+		},
+	}
+
+	for _, c := range cases {
+		var attachment = Convert(c.embed)
+		if !c.check(attachment) {
+			t.Errorf("Convert(%s): expected %s, but got %+v", c.name, c.expect, attachment)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	var content = "see https://example.com/page"
+	var embeds = []*discordgo.MessageEmbed{
+		nil,
+		// unfurled by Slack from the content
+		{Type: discordgo.EmbedTypeLink, URL: "https://example.com/page", Title: "page"},
+		{Type: discordgo.EmbedTypeRich, URL: "https://example.com/page", Title: "rich"},
+		{Type: discordgo.EmbedTypeLink, URL: "https://example.com/other", Title: "other"},
+	}
+
+	var attachments = Build(embeds, content)
+	if len(attachments) != 2 || attachments[0].Title != "rich" || attachments[1].Title != "other" {
+		t.Errorf("Build: expected the rich and other embeds, but got %+v", attachments)
+	}
+
+	embeds = []*discordgo.MessageEmbed{}
+	for i := 0; i < MaxAttachments+5; i++ {
+		embeds = append(embeds, &discordgo.MessageEmbed{Type: discordgo.EmbedTypeRich, Title: "t"})
+	}
+	if attachments := Build(embeds, ""); len(attachments) != MaxAttachments {
+		t.Errorf("Build: expected %d attachments, but got %d", MaxAttachments, len(attachments))
+	}
+}
+
+func manyFields(n int) []*discordgo.MessageEmbedField {
+	var fields = []*discordgo.MessageEmbedField{}
+	for i := 0; i < n; i++ {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "f", Value: "v"})
+	}
+	return fields
+}
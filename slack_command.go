@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
+	"github.com/slack-go/slack"
+)
+
+var (
+	discordUserIDRegExp = regexp.MustCompile(`^<?@?!?(\d{15,20})>?$`)
+	linkCodeRegExp      = regexp.MustCompile(`^\d{6}$`)
+)
+
+// slashCommandResponse is the payload acknowledging a slash command
+type slashCommandResponse struct {
+	ResponseType string                    `json:"response_type"`
+	Text         string                    `json:"text"`
+	Blocks       []slack_webhook.BlockBase `json:"blocks,omitempty"`
+}
+
+func ephemeral(text string, blocks ...slack_webhook.BlockBase) slashCommandResponse {
+	return slashCommandResponse{ResponseType: "ephemeral", Text: text, Blocks: blocks}
+}
+
+// respondCommand handles the command and sends the response to its response URL.
+// The command is acknowledged beforehand, because it may call the APIs longer than the deadline of the acknowledgement.
+func (s *SlackHandler) respondCommand(cmd slack.SlashCommand) {
+	b, err := json.Marshal(s.commandHandle(cmd))
+	if err != nil {
+		log.Printf("EncodeCommandResponse: %s\n", err.Error())
+		return
+	}
+
+	resp, err := http.Post(cmd.ResponseURL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		log.Printf("CommandResponse: %s\n", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("CommandResponse: %s\n", resp.Status)
+	}
+}
+
+// commandHandle handles /discord commands
+func (s *SlackHandler) commandHandle(cmd slack.SlashCommand) slashCommandResponse {
+	var cs, guildID = s.settings.FindDiscordChannel(cmd.ChannelID)
+	var lc = s.settings.Locale(guildID)
+
+	var args = strings.Fields(cmd.Text)
+	if len(args) == 0 {
+		return ephemeral(lc.T("command.usage"))
+	}
+
+	switch args[0] {
+	case "who":
+		return s.whoCommand(guildID, lc)
+	case "status":
+		return s.statusCommand(cmd.ChannelID, cs, lc)
+	case "link":
+		return s.linkCommand(cmd.UserID, args[1:], lc)
+	case "mute":
+		return s.muteCommand(cmd.UserID, cmd.ChannelID, cs, args[1:], lc)
+	default:
+		return ephemeral(lc.T("command.usage"))
+	}
+}
+
+// whoCommand shows the voice channels of the guild, or of all guilds if the channel is not bridged
+func (s *SlackHandler) whoCommand(guildID string, lc *locale.Catalog) slashCommandResponse {
+	var guilds = []string{guildID}
+	if guildID == "" {
+		guilds = s.settings.Guilds()
+	}
+
+	var blocks = []slack_webhook.BlockBase{}
+
+	voiceChannels.Mutex.Lock()
+	defer voiceChannels.Mutex.Unlock()
+
+	for _, id := range guilds {
+		var channels = voiceChannels.Guilds[id]
+		if channels == nil {
+			channels = &VoiceChannels{}
+		}
+
+		if len(guilds) > 1 {
+			var title = slack_webhook.SectionBlock()
+			title.Text = slack_webhook.MrkdwnElement("*" + s.guildName(id) + "*")
+			blocks = append(blocks, title)
+		}
+
+		voiceBlocks, err := channels.SlackBlocksMultiChannel(VoiceIndicators{}, s.settings.Locale(id))
+		if err != nil {
+			log.Printf("WhoCommand: %s\n", err.Error())
+			continue
+		}
+		blocks = append(blocks, voiceBlocks...)
+	}
+
+	if len(blocks) > AppHomeMaxBlocks/2 {
+		blocks = blocks[:AppHomeMaxBlocks/2]
+	}
+
+	return ephemeral(lc.T("home.voice_title"), blocks...)
+}
+
+// statusCommand shows the connection and the mapping of the channel
+func (s *SlackHandler) statusCommand(channelID string, cs ChannelSetting, lc *locale.Catalog) slashCommandResponse {
+	var lines = []string{}
+
+	if s.discord != nil && s.discord.DataReady {
+		lines = append(lines, lc.T("command.status.discord_connected"))
+	} else {
+		lines = append(lines, lc.T("command.status.discord_disconnected"))
+	}
+
+	if cs.DiscordChannel == "" {
+		lines = append(lines, lc.T("command.status.not_bridged"))
+		return ephemeral(strings.Join(lines, "\n"))
+	}
+
+	var discordChannel = cs.DiscordChannel
+	if s.discord != nil {
+		if channel, err := s.discord.State.Channel(cs.DiscordChannel); err == nil {
+			discordChannel = fmt.Sprintf("<https://discord.com/channels/%s/%s|#%s>", channel.GuildID, channel.ID, channel.Name)
+		}
+	}
+
+	lines = append(lines, lc.T("command.status.mapping",
+		discordChannel, onOff(cs.Setting.SlackToDiscord, lc), onOff(cs.Setting.DiscordToSlack, lc),
+	))
+
+	if paused, until := s.pauses.Paused(channelID); paused {
+		if until.IsZero() {
+			lines = append(lines, lc.T("command.status.paused"))
+		} else {
+			lines = append(lines, lc.T("command.status.paused_until", slackDate(until)))
+		}
+	}
+
+	for _, link := range s.messageLinks.RecentChannels(time.Time{}, MessageLinksMax) {
+		if link.SlackChannel == channelID {
+			lines = append(lines, lc.T("command.status.last_message", slackDate(link.Created)))
+			break
+		}
+	}
+
+	return ephemeral(strings.Join(lines, "\n"))
+}
+
+// linkCommand links the Slack user to a Discord account after confirming with a code sent by DM
+func (s *SlackHandler) linkCommand(slackUser string, args []string, lc *locale.Catalog) slashCommandResponse {
+	if len(args) == 0 {
+		link, ok := s.userLinks.FindBySlack(slackUser)
+		if !ok {
+			return ephemeral(lc.T("command.link.none"))
+		}
+		return ephemeral(lc.T("command.link.current", s.discordUserName(link.DiscordUser), onOff(link.VoiceStatus, lc)))
+	}
+
+	switch {
+	case args[0] == "remove":
+		if link, ok := s.userLinks.FindBySlack(slackUser); ok {
+			s.userLinks.Remove(link.DiscordUser)
+		}
+		return ephemeral(lc.T("command.link.removed"))
+
+	case args[0] == "voice" && len(args) > 1:
+		link, ok := s.userLinks.FindBySlack(slackUser)
+		if !ok {
+			return ephemeral(lc.T("command.link.none"))
+		}
+		link.VoiceStatus = args[1] == "on"
+		s.userLinks.Set(link)
+		return ephemeral(lc.T("command.link.voice", onOff(link.VoiceStatus, lc)))
+
+	case linkCodeRegExp.MatchString(args[0]):
+		link, ok := s.linkCodes.Confirm(args[0], func(link UserLink) bool {
+			return link.SlackUser == slackUser
+		})
+		if !ok {
+			return ephemeral(lc.T("command.link.invalid_code"))
+		}
+		if old, ok := s.userLinks.FindByDiscord(link.DiscordUser); ok {
+			link.VoiceStatus = old.VoiceStatus
+			link.SlackToken = old.SlackToken
+			link.StatusEmoji = old.StatusEmoji
+		}
+		s.userLinks.Set(link)
+		return ephemeral(lc.T("command.link.linked", s.discordUserName(link.DiscordUser)))
+
+	case discordUserIDRegExp.MatchString(args[0]):
+		var discordUser = discordUserIDRegExp.FindStringSubmatch(args[0])[1]
+		if s.discord == nil {
+			return ephemeral(lc.T("command.status.discord_disconnected"))
+		}
+
+		user, err := s.discord.User(discordUser)
+		if err != nil {
+			return ephemeral(lc.T("command.link.user_not_found", discordUser))
+		}
+
+		code, err := s.linkCodes.Issue(UserLink{DiscordUser: user.ID, SlackUser: slackUser})
+		if err == ErrorLinkCodeTooSoon {
+			return ephemeral(lc.T("command.link.too_soon"))
+		}
+		if err != nil {
+			log.Printf("IssueLinkCode: %s\n", err.Error())
+			return ephemeral(lc.T("command.link.dm_failed", err.Error()))
+		}
+
+		dm, err := s.discord.UserChannelCreate(user.ID)
+		if err == nil {
+			_, err = s.discord.ChannelMessageSend(dm.ID, lc.T("command.link.dm", s.userName(slackUser), code))
+		}
+		if err != nil {
+			return ephemeral(lc.T("command.link.dm_failed", err.Error()))
+		}
+
+		return ephemeral(lc.T("command.link.code_sent", user.String()))
+	}
+
+	return ephemeral(lc.T("command.usage"))
+}
+
+// muteCommand pauses relaying in the channel, or resumes it with "off".
+// Only workspace admins and the creator of the channel can do it.
+func (s *SlackHandler) muteCommand(userID, channelID string, cs ChannelSetting, args []string, lc *locale.Catalog) slashCommandResponse {
+	if cs.DiscordChannel == "" {
+		return ephemeral(lc.T("command.status.not_bridged"))
+	}
+	if !s.canManageChannel(userID, channelID) {
+		return ephemeral(lc.T("command.forbidden"))
+	}
+
+	if len(args) == 0 {
+		s.pauses.Pause(channelID, 0)
+		return ephemeral(lc.T("command.mute.paused"))
+	}
+
+	if args[0] == "off" {
+		s.pauses.Resume(channelID)
+		return ephemeral(lc.T("command.mute.resumed"))
+	}
+
+	d, err := time.ParseDuration(args[0])
+	if err != nil || d <= 0 {
+		return ephemeral(lc.T("command.mute.invalid"))
+	}
+	s.pauses.Pause(channelID, d)
+	return ephemeral(lc.T("command.mute.paused_for", formatDuration(d, lc)))
+}
+
+// canManageChannel reports whether the user is an admin or an owner of the workspace, or created the channel
+func (s *SlackHandler) canManageChannel(userID, channelID string) bool {
+	user, err := s.hook.GetUserInfo(userID)
+	if err != nil {
+		log.Printf("GetUserInfo: %s\n", err.Error())
+		return false
+	}
+	if user.IsAdmin || user.IsOwner {
+		return true
+	}
+
+	channel, err := s.hook.GetConversationInfo(channelID)
+	if err != nil {
+		log.Printf("GetConversationInfo: %s\n", err.Error())
+		return false
+	}
+	return channel.Creator == userID
+}
+
+func (s *SlackHandler) guildName(guildID string) string {
+	if s.discord != nil {
+		if guild, err := s.discord.State.Guild(guildID); err == nil {
+			return guild.Name
+		}
+	}
+	return guildID
+}
+
+func (s *SlackHandler) discordUserName(userID string) string {
+	if s.discord != nil {
+		if user, err := s.discord.User(userID); err == nil {
+			return user.String()
+		}
+	}
+	return userID
+}
+
+func onOff(ok bool, lc *locale.Catalog) string {
+	if ok {
+		return lc.T("command.on")
+	}
+	return lc.T("command.off")
+}
+
+func slackDate(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), t.Format("2006-01-02 15:04"))
+}
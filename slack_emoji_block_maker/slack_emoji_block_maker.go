@@ -3,8 +3,10 @@ package slack_emoji_block_maker
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/emoji"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
 )
 
@@ -18,6 +20,9 @@ func Build(reacts []*discordgo.MessageReactions) []slack_webhook.BlockBase {
 	for _, react := range reacts {
 		if react.Emoji.ID == "" {
 			var text = react.Emoji.Name
+			if name, ok := emoji.Shortcode(text); ok {
+				text = ":" + name + ":"
+			}
 			var stdEmojiElem = slack_webhook.MrkdwnElement(text)
 
 			elements = append(elements, stdEmojiElem)
@@ -55,3 +60,22 @@ func Build(reacts []*discordgo.MessageReactions) []slack_webhook.BlockBase {
 
 	return blocks
 }
+
+// BuildText makes a block of a line of emoji and counts
+func BuildText(reacts []*discordgo.MessageReactions) []slack_webhook.BlockBase {
+	var summary = []string{}
+	for _, react := range reacts {
+		var name = ":" + react.Emoji.Name + ":"
+		if shortcode, ok := emoji.Shortcode(react.Emoji.Name); ok && react.Emoji.ID == "" {
+			name = ":" + shortcode + ":"
+		}
+		summary = append(summary, fmt.Sprintf("%s %d", name, react.Count))
+	}
+
+	if len(summary) == 0 {
+		return []slack_webhook.BlockBase{}
+	}
+
+	var element = slack_webhook.MrkdwnElement(strings.Join(summary, "   "))
+	return []slack_webhook.BlockBase{slack_webhook.ContextBlock(element)}
+}
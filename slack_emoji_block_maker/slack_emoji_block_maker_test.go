@@ -0,0 +1,26 @@
+package slack_emoji_block_maker
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestBuildText(t *testing.T) {
+	var reacts = []*discordgo.MessageReactions{
+		{Count: 2, Emoji: &discordgo.Emoji{Name: "\U0001F44D"}},
+		{Count: 1, Emoji: &discordgo.Emoji{ID: "1", Name: "party"}},
+	}
+
+	var blocks = BuildText(reacts)
+	if len(blocks) != 1 || blocks[0].Type != "context" || len(blocks[0].Elements) != 1 {
+		t.Fatalf("BuildText() = %+v; want a context block", blocks)
+	}
+	if text, want := blocks[0].Elements[0].Text, ":+1: 2   :party: 1"; text != want {
+		t.Errorf("BuildText() text = %q; want %q", text, want)
+	}
+
+	if blocks := BuildText(nil); len(blocks) != 0 {
+		t.Errorf("BuildText(nil) = %+v; want no blocks", blocks)
+	}
+}
@@ -0,0 +1,373 @@
+package slack_emoji_imager
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// emojiCacheCapacity is the number of resized emoji kept in memory
+const emojiCacheCapacity = 512
+
+// emojiDiskCacheCapacity is the number of emoji URLs whose images are kept on disk
+const emojiDiskCacheCapacity = 4096
+
+// emojiDiskPruneInterval is the number of images saved between prunings of the disk cache
+const emojiDiskPruneInterval = 256
+
+// emojiCacheFormat is changed with the saved images, so that the old ones are not loaded
+const emojiCacheFormat = 2
+
+// CacheStats are the counters of the emoji image cache
+type CacheStats struct {
+	Entries       int    `json:"entries"`
+	Capacity      int    `json:"capacity"`
+	Hits          uint64 `json:"hits"`
+	DiskHits      uint64 `json:"disk_hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+	DiskErrors    uint64 `json:"disk_errors"`
+}
+
+// emojiImage is a decoded and resized emoji
+type emojiImage struct {
+	isGif     bool
+	converted []*image.Paletted
+	bounds    []image.Rectangle
+	// delays are the delays of the frames as in the source GIF
+	delays []int
+	other  image.Image
+}
+
+// frames is the number of the frames of the emoji
+func (e emojiImage) frames() int {
+	if e.isGif {
+		return len(e.converted)
+	}
+	return 1
+}
+
+// emojiCache keeps resized custom emoji by their URLs and sizes, in memory with LRU and on disk
+type emojiCache struct {
+	mutex sync.Mutex
+
+	// dir is where the images are saved, or "" to keep them only in memory
+	dir          string
+	capacity     int
+	diskCapacity int
+	// saved counts the images saved since the last pruning
+	saved int
+
+	entries map[string]*list.Element
+	order   *list.List
+
+	stats CacheStats
+}
+
+type cacheEntry struct {
+	key   string
+	uri   string
+	image emojiImage
+}
+
+func newEmojiCache(capacity int) *emojiCache {
+	return &emojiCache{
+		capacity:     capacity,
+		diskCapacity: emojiDiskCacheCapacity,
+		entries:      map[string]*list.Element{},
+		order:        list.New(),
+	}
+}
+
+func cacheKey(uri string, size int) string {
+	return fmt.Sprintf("%d:%s", size, uri)
+}
+
+// uriDir is the directory of the images of the URL in all sizes
+func (c *emojiCache) uriDir(uri string) string {
+	var sum = sha1.Sum([]byte(uri))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+func (c *emojiCache) path(uri string, size int, isGif bool) string {
+	var ext = ".png"
+	if isGif {
+		ext = ".gif"
+	}
+	return filepath.Join(c.uriDir(uri), fmt.Sprintf("%d.v%d%s", size, emojiCacheFormat, ext))
+}
+
+// get returns the image from memory, or from disk. The files are read without the lock.
+func (c *emojiCache) get(uri string, size int) (emojiImage, bool) {
+	c.mutex.Lock()
+	if element, ok := c.entries[cacheKey(uri, size)]; ok {
+		c.order.MoveToFront(element)
+		c.stats.Hits++
+		c.mutex.Unlock()
+		return element.Value.(*cacheEntry).image, true
+	}
+	c.mutex.Unlock()
+
+	if c.dir != "" {
+		img, err := c.load(uri, size)
+		if err == nil {
+			// the recently used images are left by pruning
+			var now = time.Now()
+			os.Chtimes(c.uriDir(uri), now, now)
+
+			c.mutex.Lock()
+			c.stats.DiskHits++
+			c.add(uri, size, img)
+			c.mutex.Unlock()
+			return img, true
+		}
+		if !os.IsNotExist(errors.Cause(err)) {
+			c.mutex.Lock()
+			c.stats.DiskErrors++
+			c.mutex.Unlock()
+			log.Println(errors.Wrap(err, "LoadEmojiCache").Error())
+		}
+	}
+
+	c.mutex.Lock()
+	c.stats.Misses++
+	c.mutex.Unlock()
+	return emojiImage{}, false
+}
+
+// put adds the image in memory, and saves it on disk without the lock
+func (c *emojiCache) put(uri string, size int, img emojiImage) {
+	c.mutex.Lock()
+	c.add(uri, size, img)
+	c.mutex.Unlock()
+
+	if c.dir == "" {
+		return
+	}
+
+	err := c.save(uri, size, img)
+
+	c.mutex.Lock()
+	if err != nil {
+		c.stats.DiskErrors++
+	}
+	c.saved++
+	var prune = c.saved >= emojiDiskPruneInterval
+	if prune {
+		c.saved = 0
+	}
+	c.mutex.Unlock()
+
+	if err != nil {
+		log.Println(errors.Wrap(err, "SaveEmojiCache").Error())
+	}
+	if prune {
+		c.prune()
+	}
+}
+
+// prune removes the images of old formats, and the images of the least recently used URLs over diskCapacity
+func (c *emojiCache) prune() {
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(errors.Wrap(err, "ReadEmojiCacheDir").Error())
+		}
+		return
+	}
+
+	var suffix = fmt.Sprintf(".v%d", emojiCacheFormat)
+	var dirs = []os.FileInfo{}
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+
+		var dir = filepath.Join(c.dir, info.Name())
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		var kept int
+		for _, file := range files {
+			if strings.HasSuffix(strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())), suffix) {
+				kept++
+				continue
+			}
+			if strings.HasPrefix(file.Name(), "saving-") && time.Since(file.ModTime()) < time.Hour {
+				// being saved now
+				continue
+			}
+			os.Remove(filepath.Join(dir, file.Name()))
+		}
+		if kept == 0 {
+			os.Remove(dir)
+			continue
+		}
+		dirs = append(dirs, info)
+	}
+
+	if len(dirs) <= c.diskCapacity {
+		return
+	}
+
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].ModTime().Before(dirs[j].ModTime())
+	})
+	for _, info := range dirs[:len(dirs)-c.diskCapacity] {
+		err := os.RemoveAll(filepath.Join(c.dir, info.Name()))
+		if err != nil {
+			log.Println(errors.Wrap(err, "PruneEmojiCache").Error())
+		}
+	}
+}
+
+// add puts the image in memory, evicting the least recently used ones
+func (c *emojiCache) add(uri string, size int, img emojiImage) {
+	var key = cacheKey(uri, size)
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).image = img
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, uri: uri, image: img})
+
+	for c.order.Len() > c.capacity {
+		var oldest = c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// invalidate removes the images of the URL in all sizes
+func (c *emojiCache) invalidate(uri string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for element := c.order.Front(); element != nil; {
+		var next = element.Next()
+		if entry := element.Value.(*cacheEntry); entry.uri == uri {
+			c.order.Remove(element)
+			delete(c.entries, entry.key)
+			c.stats.Invalidations++
+		}
+		element = next
+	}
+
+	if c.dir != "" {
+		err := os.RemoveAll(c.uriDir(uri))
+		if err != nil {
+			c.stats.DiskErrors++
+			log.Println(errors.Wrap(err, "RemoveEmojiCache").Error())
+		}
+	}
+}
+
+func (c *emojiCache) statistics() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var stats = c.stats
+	stats.Entries = c.order.Len()
+	stats.Capacity = c.capacity
+	return stats
+}
+
+// save writes the frames of an animated emoji as GIF, or a still one as PNG.
+// The file is written under a temporary name and renamed, so that it is never read half written.
+func (c *emojiCache) save(uri string, size int, img emojiImage) error {
+	err := os.MkdirAll(c.uriDir(uri), 0755)
+	if err != nil {
+		return errors.Wrap(err, "MkdirAll")
+	}
+
+	fp, err := ioutil.TempFile(c.uriDir(uri), "saving-")
+	if err != nil {
+		return errors.Wrap(err, "Create")
+	}
+	defer os.Remove(fp.Name())
+
+	err = encodeCache(fp, img)
+	if closeErr := fp.Close(); err == nil {
+		err = errors.Wrap(closeErr, "Close")
+	}
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(os.Rename(fp.Name(), c.path(uri, size, img.isGif)), "Rename")
+}
+
+func encodeCache(w io.Writer, img emojiImage) error {
+	if !img.isGif {
+		return errors.Wrap(png.Encode(w, img.other), "EncodePNG")
+	}
+
+	var anim = &gif.GIF{
+		Image: img.converted,
+		Delay: make([]int, len(img.converted)),
+	}
+	copy(anim.Delay, img.delays)
+	for _, bound := range img.bounds {
+		if bound.Max.X > anim.Config.Width {
+			anim.Config.Width = bound.Max.X
+		}
+		if bound.Max.Y > anim.Config.Height {
+			anim.Config.Height = bound.Max.Y
+		}
+	}
+
+	return errors.Wrap(gif.EncodeAll(w, anim), "EncodeGIF")
+}
+
+func (c *emojiCache) load(uri string, size int) (emojiImage, error) {
+	var img emojiImage
+
+	fp, err := os.Open(c.path(uri, size, true))
+	if err == nil {
+		defer fp.Close()
+
+		anim, err := gif.DecodeAll(fp)
+		if err != nil {
+			return img, errors.Wrap(err, "DecodeGIF")
+		}
+
+		img.isGif = true
+		img.converted = anim.Image
+		img.delays = anim.Delay
+		for _, frame := range anim.Image {
+			img.bounds = append(img.bounds, frame.Bounds())
+		}
+		return img, nil
+	}
+
+	fp, err = os.Open(c.path(uri, size, false))
+	if err != nil {
+		return img, errors.Wrap(err, "Open")
+	}
+	defer fp.Close()
+
+	img.other, err = png.Decode(fp)
+	if err != nil {
+		return img, errors.Wrap(err, "DecodePNG")
+	}
+	return img, nil
+}
@@ -9,7 +9,7 @@ import (
 	"image/color/palette"
 	"image/gif"
 	_ "image/jpeg"
-	_ "image/png"
+	"image/png"
 	"io"
 	"log"
 	"net/http"
@@ -22,6 +22,7 @@ import (
 	"golang.org/x/image/draw"
 
 	"github.com/golang/freetype/truetype"
+	"github.com/nfnt/resize"
 	"github.com/pkg/errors"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/gofont/gobold"
@@ -33,46 +34,46 @@ var ErrorNoReactions = errors.Errorf("NoReactions")
 const SlackAPIEndpoint = "https://slack.com/api"
 
 const reactionEmojiSize = 50
-const reactionNumSize = 50
-const reactionMerginSize = 5
 const laneReactionNum = 8
 const emojiFilePath = "NotoColorEmoji"
 
-var reactionWidth = reactionEmojiSize + reactionNumSize + reactionMerginSize*2
-var imageWidth = reactionWidth * laneReactionNum
-var imageLaneHeight = reactionMerginSize*2 + reactionEmojiSize
-
 var colorPalette = append(palette.WebSafe, image.Transparent)
 
 type Imager struct {
-	EmojiList EmojiList
+	EmojiList      EmojiList
+	emojiListMutex sync.RWMutex
+
 	userToken string
 	botToken  string
+	emojiDir  string
+
+	cache *emojiCache
 }
 
 type EmojiList map[string]string
 
 type MessageReaction struct {
-	Emoji string
-	Num   int
+	Emoji    string
+	Num      int
+	Reactors []Reactor
+}
+
+// Reactor is a user who reacted, shown under the emoji
+type Reactor struct {
+	Name      string
+	AvatarURL string
 }
 
 type slackReaction struct {
-	Count int    `json:"count"`
-	Name  string `json:"name"`
-	image struct {
-		isGif     bool
-		converted []*image.Paletted
-		bounds    []image.Rectangle
-		other     *image.Paletted
-	}
+	Count    int    `json:"count"`
+	Name     string `json:"name"`
+	image    emojiImage
+	reactors []reactor
 }
-type reactionsGetResponse struct {
-	Message struct {
-		Reactions []slackReaction `json:"reactions"`
-	} `json:"message"`
-	Error string `json:"error"`
-	OK    bool   `json:"ok"`
+
+type reactor struct {
+	Reactor
+	avatar image.Image
 }
 
 func New(userToken, botToken string) (*Imager, error) {
@@ -80,121 +81,348 @@ func New(userToken, botToken string) (*Imager, error) {
 		EmojiList: make(EmojiList),
 		userToken: userToken,
 		botToken:  botToken,
+		emojiDir:  emojiFilePath,
+		cache:     newEmojiCache(emojiCacheCapacity),
 	}
 	err := imager.getEmojiList()
 
 	return imager, err
 }
 
-func (s *Imager) MakeReactionsImage(channel string, timestamp string) (r io.Reader, err error) {
-	// Get Slack Message Reactions
-	reactions, err := s.getSlackReactions(channel, timestamp)
-	if err != nil {
-		return nil, errors.Wrap(err, "getSlackReactinos")
+// MakeImage makes the image of the given reactions instead of all reactions of a message.
+// contentType is "image/png" when options.StaticPNG is set and no reaction is animated, otherwise "image/gif".
+func (s *Imager) MakeImage(reactions []MessageReaction, options Options) (r io.Reader, contentType string, err error) {
+	var slackReactions = make([]slackReaction, len(reactions))
+	for i, reaction := range reactions {
+		slackReactions[i].Name = reaction.Emoji
+		slackReactions[i].Count = reaction.Num
+		for _, user := range reaction.Reactors {
+			slackReactions[i].reactors = append(slackReactions[i].reactors, reactor{Reactor: user})
+		}
 	}
 
+	return s.makeImage(slackReactions, options)
+}
+
+func (s *Imager) makeImage(reactions []slackReaction, options Options) (r io.Reader, contentType string, err error) {
 	if len(reactions) == 0 {
-		return nil, ErrorNoReactions
+		return nil, "", ErrorNoReactions
 	}
 
+	options = options.WithDefault()
+	var l = newLayout(options, len(reactions))
+
 	var maxFrame int = 1
 
 	// Get Reaction Images
 	for i := range reactions {
-		reactions[i], maxFrame, err = s.resize(reactions[i])
+		var frames int
+		reactions[i], frames, err = s.resize(reactions[i], options.Size)
 		if err != nil {
 			log.Println(errors.Wrap(err, "Resize").Error())
 		}
+		if frames > maxFrame {
+			maxFrame = frames
+		}
 	}
 
-	// Make Reaction Image
-	var gifImage *gif.GIF
-	frames := make([]*image.Paletted, maxFrame)
-	gifImage = &gif.GIF{
-		Image: frames,
+	if options.Reactors == ReactorAvatars {
+		s.loadAvatars(reactions, l.avatarSize)
 	}
 
 	ft, err := truetype.Parse(gobold.TTF)
 	if err != nil {
-		return nil, errors.Wrap(err, "FontParseError")
+		return nil, "", errors.Wrap(err, "FontParseError")
+	}
+
+	if options.StaticPNG && maxFrame == 1 {
+		var frame = image.NewRGBA(l.bounds())
+		draw.Draw(frame, frame.Bounds(), image.NewUniform(l.background()), image.Point{}, draw.Src)
+		s.drawFrame(frame, 0, reactions, l, newFaces(ft, l))
+
+		var encodedPNG = new(bytes.Buffer)
+		err = png.Encode(encodedPNG, frame)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "EncodePNG")
+		}
+
+		return encodedPNG, "image/png", nil
+	}
+
+	// static images are dithered once, instead of on every frame
+	var p = l.palette()
+	for i := range reactions {
+		if reactions[i].image.other != nil {
+			reactions[i].image.other = dither(reactions[i].image.other, p)
+		}
+		for j := range reactions[i].reactors {
+			if reactions[i].reactors[j].avatar != nil {
+				reactions[i].reactors[j].avatar = dither(reactions[i].reactors[j].avatar, p)
+			}
+		}
+	}
+
+	var images = make([]emojiImage, len(reactions))
+	for i := range reactions {
+		images[i] = reactions[i].image
 	}
 
+	// the frames are halved until the image is small enough to upload
+	for budget := maxReactionFrames; ; budget /= 2 {
+		var tl = newTimeline(images, budget)
+
+		encodedGIF, err := s.encodeGIF(reactions, tl, l, ft)
+		if err != nil {
+			return nil, "", err
+		}
+		if encodedGIF.Len() <= maxReactionImageBytes || len(tl.starts) <= 1 {
+			return encodedGIF, "image/gif", nil
+		}
+	}
+}
+
+// encodeGIF draws the reactions at each start of the timeline.
+// On an opaque background, the frames after the first are only the parts changed from the previous ones.
+func (s *Imager) encodeGIF(reactions []slackReaction, tl timeline, l layout, ft *truetype.Font) (*bytes.Buffer, error) {
+	var p = l.palette()
+	var frames = make([]*image.Paletted, len(tl.starts))
+
 	var setEmojiToImage = func(fromFrame, toFrame int) {
+		// font faces cannot be shared between goroutines
+		var faces = newFaces(ft, l)
+
 		for frameNum := fromFrame; frameNum < toFrame; frameNum++ {
-			var frame = image.NewPaletted(image.Rect(0, 0, imageWidth, imageLaneHeight*((len(reactions)-1)/laneReactionNum+1)), colorPalette)
-			frame = s.fillFrame(frame, color.White)
-
-			for j, reaction := range reactions {
-				// draw reaction image
-				var img *image.Paletted
-				var bound image.Rectangle
-				if reaction.image.isGif {
-					// if image is gif, select a draw frame
-					if frameNum >= len(reaction.image.converted) {
-						// frameNum%len(reaction.image.converted) make GIF loop
-						img = reaction.image.converted[frameNum%len(reaction.image.converted)]
-						bound = reaction.image.bounds[frameNum%len(reaction.image.converted)]
-					} else {
-						img = reaction.image.converted[frameNum]
-						bound = reaction.image.bounds[frameNum]
-					}
-				} else {
-					img = reaction.image.other
-					if img == nil {
-						continue
-					}
-					bound = img.Bounds()
-				}
+			var frame = image.NewPaletted(l.bounds(), p)
+			frame = s.fillFrame(frame, l.background())
 
-				var imgPoint = image.Point{
-					img.Bounds().Min.X + reactionWidth*(j%laneReactionNum) + reactionMerginSize + reactionEmojiSize/2 - img.Bounds().Dx()/2,
-					img.Bounds().Min.Y + imageLaneHeight*(j/laneReactionNum) + reactionMerginSize + reactionEmojiSize/2 - img.Bounds().Dy()/2,
-				}
+			s.drawFrame(frame, tl.starts[frameNum], reactions, l, faces)
 
-				draw.Copy(frame, imgPoint, img, bound, draw.Over, nil)
-
-				// draw reaction number
-				var number = strconv.Itoa(reaction.Count)
-
-				var dr = &font.Drawer{
-					Dst: frame,
-					Src: image.Black,
-					Face: truetype.NewFace(
-						ft,
-						&truetype.Options{
-							Size: reactionNumSize,
-						},
-					),
-					Dot: fixed.Point26_6{},
-				}
+			frames[frameNum] = frame
+		}
+	}
+
+	s.paralleExec(len(frames), setEmojiToImage)
+
+	var gifImage = &gif.GIF{}
+	for i, frame := range frames {
+		var delay = tl.delay(i)
+		if len(frames) == 1 {
+			delay = 0
+		}
 
-				dr.Dot.X = fixed.I(reactionWidth*(j%laneReactionNum)+reactionMerginSize+reactionEmojiSize) +
-					(fixed.I(reactionNumSize)-dr.MeasureString(number))/2
-				dr.Dot.Y = fixed.I(reactionEmojiSize) + fixed.I(imageLaneHeight*(j/laneReactionNum))
+		if l.Transparent {
+			// the transparent pixels would show the previous frame
+			gifImage.Image = append(gifImage.Image, frame)
+			gifImage.Delay = append(gifImage.Delay, delay)
+			gifImage.Disposal = append(gifImage.Disposal, gif.DisposalBackground)
+			continue
+		}
 
-				dr.DrawString(number)
+		if i > 0 {
+			var changed = changedRect(frames[i-1], frame)
+			if changed.Empty() {
+				gifImage.Delay[len(gifImage.Delay)-1] += delay
+				continue
 			}
+			frame = frame.SubImage(changed).(*image.Paletted)
+		}
 
-			gifImage.Image[frameNum] = frame
+		gifImage.Image = append(gifImage.Image, frame)
+		gifImage.Delay = append(gifImage.Delay, delay)
+		gifImage.Disposal = append(gifImage.Disposal, gif.DisposalNone)
+	}
+
+	var encodedGIF = new(bytes.Buffer)
+	err := gif.EncodeAll(encodedGIF, gifImage)
+	if err != nil {
+		return nil, errors.Wrap(err, "EncodeGIF")
+	}
+
+	return encodedGIF, nil
+}
+
+// changedRect is the smallest rectangle which has all the pixels different between the frames
+func changedRect(previous, frame *image.Paletted) image.Rectangle {
+	var changed image.Rectangle
+	var bounds = frame.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if previous.ColorIndexAt(x, y) != frame.ColorIndexAt(x, y) {
+				changed = changed.Union(image.Rect(x, y, x+1, y+1))
+			}
 		}
 	}
+	return changed
+}
 
-	s.paralleExec(maxFrame, setEmojiToImage)
+type faces struct {
+	number font.Face
+	name   font.Face
+}
 
-	gifImage.Delay = make([]int, maxFrame)
-	gifImage.Disposal = make([]byte, maxFrame)
+func newFaces(ft *truetype.Font, l layout) faces {
+	return faces{
+		number: truetype.NewFace(ft, &truetype.Options{Size: float64(l.numWidth)}),
+		name:   truetype.NewFace(ft, &truetype.Options{Size: float64(l.nameSize)}),
+	}
+}
 
-	// TODO: Dynamically adjust the delay time value
+// drawFrame draws the reactions as they are shown at the time in 1/100 seconds
+func (s *Imager) drawFrame(frame draw.Image, t int, reactions []slackReaction, l layout, faces faces) {
+	for j, reaction := range reactions {
+		var origin = l.origin(j)
+
+		// draw reaction image
+		var img image.Image
+		var bound image.Rectangle
+		if reaction.image.isGif {
+			var frameNum = reaction.image.frameAt(t)
+			img = reaction.image.converted[frameNum]
+			bound = reaction.image.bounds[frameNum]
+		} else {
+			img = reaction.image.other
+			if img == nil {
+				continue
+			}
+			bound = img.Bounds()
+		}
+
+		var imgPoint = image.Point{
+			img.Bounds().Min.X + origin.X + l.margin + l.Size/2 - img.Bounds().Dx()/2,
+			img.Bounds().Min.Y + origin.Y + l.margin + l.Size/2 - img.Bounds().Dy()/2,
+		}
+
+		draw.Copy(frame, imgPoint, img, bound, draw.Over, nil)
+
+		// draw reaction number
+		var number = strconv.Itoa(reaction.Count)
+
+		var dr = &font.Drawer{
+			Dst:  frame,
+			Src:  l.foreground(),
+			Face: faces.number,
+			Dot:  fixed.Point26_6{},
+		}
+
+		dr.Dot.X = fixed.I(origin.X+l.margin+l.Size) +
+			(fixed.I(l.numWidth)-dr.MeasureString(number))/2
+		dr.Dot.Y = fixed.I(l.Size) + fixed.I(origin.Y)
 
-	for i := range gifImage.Delay {
-		gifImage.Delay[i] = 4
-		gifImage.Disposal[i] = gif.DisposalBackground
+		dr.DrawString(number)
+
+		var top = origin.Y + l.margin*2 + l.Size
+		switch l.Reactors {
+		case ReactorNames:
+			s.drawNames(frame, reaction, image.Pt(origin.X+l.margin, top), l, faces.name)
+		case ReactorAvatars:
+			s.drawAvatars(frame, reaction, image.Pt(origin.X+l.margin, top), l, faces.name)
+		}
 	}
+}
 
-	var encodedGIF = new(bytes.Buffer)
-	gif.EncodeAll(encodedGIF, gifImage)
+// drawNames draws the names of the reactors from the point, and the number of the rest if they do not fit
+func (s *Imager) drawNames(frame draw.Image, reaction slackReaction, point image.Point, l layout, face font.Face) {
+	var lineHeight = l.nameSize * 6 / 5
+	var width = fixed.I(l.reactionWidth - l.margin*2)
 
-	return encodedGIF, nil
+	var lines = []string{}
+	for i, user := range reaction.reactors {
+		if i == maxReactorLines-1 && len(reaction.reactors) > maxReactorLines {
+			lines = append(lines, fmt.Sprintf("+%d", len(reaction.reactors)-i))
+			break
+		}
+		lines = append(lines, user.Name)
+	}
+
+	var dr = &font.Drawer{
+		Dst:  frame,
+		Src:  l.foreground(),
+		Face: face,
+	}
+
+	for i, line := range lines {
+		if dr.MeasureString(line) > width {
+			var runes = []rune(line)
+			for len(runes) > 0 && dr.MeasureString(string(runes)+"…") > width {
+				runes = runes[:len(runes)-1]
+			}
+			line = string(runes) + "…"
+		}
+
+		dr.Dot = fixed.P(point.X, point.Y+lineHeight*(i+1)-lineHeight/5)
+		dr.DrawString(line)
+	}
+}
+
+// drawAvatars draws the icons of the reactors in a row from the point, and the number of the rest if they do not fit
+func (s *Imager) drawAvatars(frame draw.Image, reaction slackReaction, point image.Point, l layout, face font.Face) {
+	var max = l.maxAvatars()
+	for i, user := range reaction.reactors {
+		var x = point.X + (l.avatarSize+l.margin)*i
+
+		if i == max-1 && len(reaction.reactors) > max {
+			var dr = &font.Drawer{
+				Dst:  frame,
+				Src:  l.foreground(),
+				Face: face,
+				Dot:  fixed.P(x, point.Y+(l.avatarSize+l.nameSize)/2),
+			}
+			dr.DrawString(fmt.Sprintf("+%d", len(reaction.reactors)-i))
+			return
+		}
+
+		if user.avatar == nil {
+			continue
+		}
+		draw.Copy(frame, image.Pt(x, point.Y), user.avatar, user.avatar.Bounds(), draw.Over, nil)
+	}
+}
+
+// loadAvatars downloads the icons of the reactors, fitting them in size pixels
+func (s *Imager) loadAvatars(reactions []slackReaction, size int) {
+	var avatars = map[string]image.Image{}
+
+	for i := range reactions {
+		for j, user := range reactions[i].reactors {
+			if user.AvatarURL == "" {
+				continue
+			}
+
+			avatar, ok := avatars[user.AvatarURL]
+			if !ok {
+				var err error
+				avatar, err = s.loadAvatar(user.AvatarURL, size)
+				if err != nil {
+					log.Println(errors.Wrap(err, "LoadAvatar").Error())
+				}
+				avatars[user.AvatarURL] = avatar
+			}
+
+			reactions[i].reactors[j].avatar = avatar
+		}
+	}
+}
+
+func (s *Imager) loadAvatar(uri string, size int) (image.Image, error) {
+	resp, err := http.Get(uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetAvatar")
+	}
+	defer resp.Body.Close()
+
+	img, _, err := image.Decode(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "DecodeImage")
+	}
+
+	return clampAlpha(resize.Resize(uint(size), uint(size), img, resize.Lanczos3)), nil
+}
+
+// dither converts the image to the palette
+func dither(img image.Image, p color.Palette) *image.Paletted {
+	var paletted = image.NewPaletted(img.Bounds(), p)
+	draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, img.Bounds().Min)
+	return paletted
 }
 
 func (s *Imager) fillFrame(frame *image.Paletted, c color.Color) *image.Paletted {
@@ -278,23 +506,59 @@ func (s *Imager) getEmojiList() error {
 		return fmt.Errorf("EmojiListGetError")
 	}
 
+	s.emojiListMutex.Lock()
 	s.EmojiList = responseAttr.Emoji
+	s.emojiListMutex.Unlock()
 
 	return err
 }
 
+// SetCacheDir saves the resized custom emoji in the directory, to be used after restarts.
+// The images of old formats and of too many emoji in the directory are removed.
+func (s *Imager) SetCacheDir(dir string) {
+	s.cache.dir = dir
+	s.cache.prune()
+}
+
+// CacheStats returns the counters of the custom emoji cache
+func (s *Imager) CacheStats() CacheStats {
+	return s.cache.statistics()
+}
+
+// AddEmoji adds or replaces the custom emoji, dropping the cached images of the old and new URLs
 func (s *Imager) AddEmoji(name string, uri string) {
+	s.emojiListMutex.Lock()
+	var old = s.EmojiList[name]
 	s.EmojiList[name] = uri
+	s.emojiListMutex.Unlock()
+
+	if old != "" && !strings.HasPrefix(old, "alias:") {
+		s.cache.invalidate(old)
+	}
+	if !strings.HasPrefix(uri, "alias:") {
+		s.cache.invalidate(uri)
+	}
 }
 
+// RemoveEmoji removes the custom emoji and its cached images
 func (s *Imager) RemoveEmoji(name string) {
+	s.emojiListMutex.Lock()
+	var old = s.EmojiList[name]
 	delete(s.EmojiList, name)
+	s.emojiListMutex.Unlock()
+
+	if old != "" && !strings.HasPrefix(old, "alias:") {
+		s.cache.invalidate(old)
+	}
 }
 
 func (s *Imager) GetEmojiURI(name string) string {
+	s.emojiListMutex.RLock()
 	var uri = s.EmojiList[name]
+	s.emojiListMutex.RUnlock()
+
 	if strings.HasPrefix(uri, "alias:") {
-		uri = s.GetEmojiURI(strings.TrimPrefix(uri, "aslias:"))
+		uri = s.GetEmojiURI(strings.TrimPrefix(uri, "alias:"))
 	}
 
 	return uri
@@ -0,0 +1,402 @@
+package slack_emoji_imager
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden images")
+
+// testServer serves a 2 frame custom emoji and a user icon
+func testServer(t *testing.T) *httptest.Server {
+	var mux = http.NewServeMux()
+
+	mux.HandleFunc("/parrot.gif", func(w http.ResponseWriter, r *http.Request) {
+		var p = color.Palette{color.White, color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0, 0xff, 0xff}}
+		var anim = &gif.GIF{}
+		for i := 1; i <= 2; i++ {
+			var frame = image.NewPaletted(image.Rect(0, 0, 32, 32), p)
+			for y := 8; y < 24; y++ {
+				for x := 8; x < 24; x++ {
+					frame.SetColorIndex(x, y, uint8(i))
+				}
+			}
+			anim.Image = append(anim.Image, frame)
+			anim.Delay = append(anim.Delay, 10)
+		}
+		gif.EncodeAll(w, anim)
+	})
+
+	mux.HandleFunc("/avatar.png", func(w http.ResponseWriter, r *http.Request) {
+		var avatar = image.NewRGBA(image.Rect(0, 0, 48, 48))
+		for y := 0; y < 48; y++ {
+			for x := 0; x < 48; x++ {
+				avatar.Set(x, y, color.RGBA{0, 0x99, 0x33, 0xff})
+			}
+		}
+		png.Encode(w, avatar)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestMakeImage(t *testing.T) {
+	var server = testServer(t)
+	defer server.Close()
+
+	var imager = &Imager{
+		EmojiList: EmojiList{"parrot": server.URL + "/parrot.gif"},
+		emojiDir:  filepath.Join("..", emojiFilePath),
+		cache:     newEmojiCache(emojiCacheCapacity),
+	}
+
+	var users = func(names ...string) []Reactor {
+		var reactors = []Reactor{}
+		for _, name := range names {
+			reactors = append(reactors, Reactor{Name: name, AvatarURL: server.URL + "/avatar.png"})
+		}
+		return reactors
+	}
+
+	var cases = []struct {
+		name        string
+		reactions   []MessageReaction
+		options     Options
+		contentType string
+	}{
+		{
+			name: "default",
+			reactions: []MessageReaction{
+				{Emoji: "+1", Num: 3}, {Emoji: "tada", Num: 1}, {Emoji: "parrot", Num: 12},
+			},
+			contentType: "image/gif",
+		},
+		{
+			name: "dark_columns",
+			reactions: []MessageReaction{
+				{Emoji: "+1", Num: 3}, {Emoji: "tada", Num: 1}, {Emoji: "parrot", Num: 2},
+			},
+			options:     Options{Size: 32, Columns: 2, Theme: ThemeDark},
+			contentType: "image/gif",
+		},
+		{
+			name: "transparent_png",
+			reactions: []MessageReaction{
+				{Emoji: "+1::skin-tone-4", Num: 1}, {Emoji: "heart", Num: 5},
+			},
+			options:     Options{Transparent: true, StaticPNG: true},
+			contentType: "image/png",
+		},
+		{
+			name: "animated_not_png",
+			reactions: []MessageReaction{
+				{Emoji: "parrot", Num: 1},
+			},
+			options:     Options{Size: 24, StaticPNG: true},
+			contentType: "image/gif",
+		},
+		{
+			name: "names",
+			reactions: []MessageReaction{
+				{Emoji: "+1", Num: 4, Reactors: users("alice", "bob", "carol", "dave")},
+				{Emoji: "eyes", Num: 1, Reactors: users("a_very_long_display_name")},
+			},
+			options:     Options{Columns: 2, StaticPNG: true, Reactors: ReactorNames},
+			contentType: "image/png",
+		},
+		{
+			name: "avatars",
+			reactions: []MessageReaction{
+				{Emoji: "+1", Num: 7, Reactors: users("1", "2", "3", "4", "5", "6", "7")},
+				{Emoji: "parrot", Num: 1, Reactors: users("1")},
+			},
+			options:     Options{Columns: 2, Reactors: ReactorAvatars},
+			contentType: "image/gif",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, contentType, err := imager.MakeImage(c.reactions, c.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contentType != c.contentType {
+				t.Fatalf("contentType = %s; want %s", contentType, c.contentType)
+			}
+
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var golden = filepath.Join("testdata", c.name+".gif")
+			if contentType == "image/png" {
+				golden = filepath.Join("testdata", c.name+".png")
+			}
+
+			if *update {
+				if err := ioutil.WriteFile(golden, b, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := decodeFrames(bytes.NewReader(b), contentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantFrames, err := decodeFrames(bytes.NewReader(want), contentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(wantFrames) {
+				t.Fatalf("%d frames; want %d", len(got), len(wantFrames))
+			}
+			for i := range got {
+				if !sameImage(got[i], wantFrames[i]) {
+					t.Errorf("frame %d differs from %s", i, golden)
+				}
+			}
+		})
+	}
+}
+
+func decodeFrames(r io.Reader, contentType string) ([]image.Image, error) {
+	if contentType == "image/png" {
+		img, err := png.Decode(r)
+		return []image.Image{img}, err
+	}
+
+	anim, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var frames = []image.Image{}
+	for _, frame := range anim.Image {
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+func sameImage(a, b image.Image) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+
+	for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+		for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+			r1, g1, b1, a1 := a.At(x, y).RGBA()
+			r2, g2, b2, a2 := b.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestEmojiCache(t *testing.T) {
+	var server = testServer(t)
+	defer server.Close()
+
+	var dir = t.TempDir()
+	var uri = server.URL + "/parrot.gif"
+
+	var newImager = func() *Imager {
+		var imager = &Imager{
+			EmojiList: EmojiList{"parrot": uri, "party_parrot": "alias:parrot"},
+			emojiDir:  filepath.Join("..", emojiFilePath),
+			cache:     newEmojiCache(1),
+		}
+		imager.SetCacheDir(dir)
+		return imager
+	}
+
+	var makeImage = func(imager *Imager, reactions ...MessageReaction) []byte {
+		r, _, err := imager.MakeImage(reactions, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	var imager = newImager()
+	var first = makeImage(imager, MessageReaction{Emoji: "parrot", Num: 1})
+	makeImage(imager, MessageReaction{Emoji: "party_parrot", Num: 1})
+
+	if stats := imager.CacheStats(); stats.Misses != 1 || stats.Hits != 1 || stats.Entries != 1 {
+		t.Errorf("stats = %+v; want 1 miss and 1 hit", stats)
+	}
+
+	// restarted
+	imager = newImager()
+	if !bytes.Equal(makeImage(imager, MessageReaction{Emoji: "parrot", Num: 1}), first) {
+		t.Error("image from the disk cache differs")
+	}
+	if stats := imager.CacheStats(); stats.DiskHits != 1 || stats.Misses != 0 {
+		t.Errorf("stats = %+v; want 1 disk hit", stats)
+	}
+
+	// another size evicts the least recently used one
+	imager.MakeImage([]MessageReaction{{Emoji: "parrot", Num: 1}}, Options{Size: 32})
+	if stats := imager.CacheStats(); stats.Evictions != 1 || stats.Entries != 1 {
+		t.Errorf("stats = %+v; want 1 eviction", stats)
+	}
+
+	imager.RemoveEmoji("parrot")
+	if stats := imager.CacheStats(); stats.Invalidations != 1 || stats.Entries != 0 {
+		t.Errorf("stats = %+v; want 1 invalidation", stats)
+	}
+	if _, err := os.Stat(imager.cache.uriDir(uri)); !os.IsNotExist(err) {
+		t.Errorf("cache files remain: %v", err)
+	}
+}
+
+func TestShrinkGIF(t *testing.T) {
+	var anim = &gif.GIF{}
+	for i := 0; i < 4; i++ {
+		var frame = image.NewPaletted(image.Rect(0, 0, 256, 256), colorPalette)
+		for y := 0; y < 256; y++ {
+			for x := 0; x < 256; x++ {
+				frame.SetColorIndex(x, y, uint8((x*7+y*13+i*31)%len(colorPalette)))
+			}
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10*(i+1))
+	}
+	anim.Config.Width, anim.Config.Height = 256, 256
+
+	data, err := shrinkGIF(anim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > GuildEmojiMaxBytes {
+		t.Errorf("size = %d, want <= %d", len(data), GuildEmojiMaxBytes)
+	}
+
+	shrunk, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shrunk.Config.Width > GuildEmojiMaxSize || shrunk.Config.Height > GuildEmojiMaxSize {
+		t.Errorf("bounds = %dx%d, want <= %d", shrunk.Config.Width, shrunk.Config.Height, GuildEmojiMaxSize)
+	}
+
+	var total int
+	for _, delay := range shrunk.Delay {
+		total += delay
+	}
+	if total != 100 {
+		t.Errorf("total delay = %d, want 100", total)
+	}
+
+	frames, delays := thinFrames(composeFrames(anim), anim.Delay)
+	if len(frames) != 2 || delays[0] != 30 || delays[1] != 70 {
+		t.Errorf("thinFrames = %d frames %v, want 2 frames [30 70]", len(frames), delays)
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	var animation = func(delays ...int) emojiImage {
+		return emojiImage{isGif: true, converted: make([]*image.Paletted, len(delays)), delays: delays}
+	}
+
+	var fast = animation(10, 10)
+	var slow = animation(15, 15, 0)
+	var still = emojiImage{}
+
+	if got := slow.frameAt(24); got != 1 {
+		t.Errorf("frameAt(24) = %d; want 1", got)
+	}
+	if got := slow.frameAt(40 + 5); got != 0 {
+		t.Errorf("frameAt(45) = %d; want 0 of the second loop", got)
+	}
+
+	var tl = newTimeline([]emojiImage{fast, slow, still}, maxReactionFrames)
+	if tl.period != 40 {
+		t.Fatalf("period = %d; want 40", tl.period)
+	}
+	var want = []int{0, 10, 15, 20, 30}
+	if len(tl.starts) != len(want) {
+		t.Fatalf("starts = %v; want %v", tl.starts, want)
+	}
+	var total int
+	for i := range want {
+		if tl.starts[i] != want[i] {
+			t.Fatalf("starts = %v; want %v", tl.starts, want)
+		}
+		total += tl.delay(i)
+	}
+	if total != tl.period {
+		t.Errorf("total delay = %d; want %d", total, tl.period)
+	}
+
+	tl = newTimeline([]emojiImage{fast, slow}, 3)
+	if len(tl.starts) > 3 {
+		t.Errorf("%d frames over the budget: %v", len(tl.starts), tl.starts)
+	}
+
+	tl = newTimeline([]emojiImage{still}, maxReactionFrames)
+	if len(tl.starts) != 1 || tl.period != 0 {
+		t.Errorf("still timeline = %+v; want a frame", tl)
+	}
+}
+
+func TestEmojiCachePrune(t *testing.T) {
+	var cache = newEmojiCache(1)
+	cache.dir = t.TempDir()
+	cache.diskCapacity = 2
+
+	var img = emojiImage{other: image.NewRGBA(image.Rect(0, 0, 1, 1))}
+	var uris = []string{"https://example.com/1.png", "https://example.com/2.png", "https://example.com/3.png"}
+	for i, uri := range uris {
+		if err := cache.save(uri, 64, img); err != nil {
+			t.Fatal(err)
+		}
+		var modified = time.Now().Add(time.Duration(i-len(uris)) * time.Hour)
+		os.Chtimes(cache.uriDir(uri), modified, modified)
+	}
+
+	// a file of an old format
+	var old = filepath.Join(cache.uriDir(uris[2]), "64.png")
+	if err := ioutil.WriteFile(old, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.prune()
+
+	if _, err := os.Stat(cache.uriDir(uris[0])); !os.IsNotExist(err) {
+		t.Errorf("the least recently used images remain: %v", err)
+	}
+	for _, uri := range uris[1:] {
+		if _, err := cache.load(uri, 64); err != nil {
+			t.Errorf("the image of %s was removed: %v", uri, err)
+		}
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("the image of the old format remains: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package slack_emoji_imager
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+
+	"github.com/nfnt/resize"
+	"github.com/pkg/errors"
+	"golang.org/x/image/draw"
+)
+
+var (
+	ErrorEmojiNotFound = errors.Errorf("EmojiNotFound")
+	ErrorEmojiTooLarge = errors.Errorf("EmojiTooLarge")
+)
+
+const (
+	// GuildEmojiMaxBytes is the largest image Discord accepts as a guild emoji
+	GuildEmojiMaxBytes = 256 * 1024
+	// GuildEmojiMaxSize is the largest width and height of a guild emoji
+	GuildEmojiMaxSize = 128
+
+	// maxEmojiDownload limits the size of a custom emoji to download
+	maxEmojiDownload = 16 * 1024 * 1024
+)
+
+// guildEmojiSizes are the sizes tried in order until an image fits in GuildEmojiMaxBytes
+var guildEmojiSizes = []int{GuildEmojiMaxSize, 96, 64, 48, 32}
+
+// GuildEmoji is a custom emoji image prepared to be a Discord guild emoji
+type GuildEmoji struct {
+	// URI is the Slack URL of the image
+	URI      string
+	Animated bool
+	// Image is the data URI of the image to upload
+	Image string
+}
+
+// GuildEmoji downloads the custom emoji and fits it in the limits of Discord guild emoji.
+// Animated GIFs are resized frame by frame, and their frames are thinned out if they are still too large.
+func (s *Imager) GuildEmoji(name string) (GuildEmoji, error) {
+	var uri = s.GetEmojiURI(name)
+	if uri == "" {
+		return GuildEmoji{}, ErrorEmojiNotFound
+	}
+
+	body, err := s.fetchEmoji(uri)
+	if err != nil {
+		return GuildEmoji{}, errors.Wrap(err, "FetchEmoji")
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxEmojiDownload))
+	if err != nil {
+		return GuildEmoji{}, errors.Wrap(err, "ReadEmoji")
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return GuildEmoji{}, errors.Wrap(err, "DecodeConfig")
+	}
+
+	var emoji = GuildEmoji{URI: uri, Animated: format == "gif"}
+
+	// small enough as it is
+	if len(data) <= GuildEmojiMaxBytes && config.Width <= GuildEmojiMaxSize && config.Height <= GuildEmojiMaxSize {
+		emoji.Image = dataURI("image/"+format, data)
+		return emoji, nil
+	}
+
+	if emoji.Animated {
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return GuildEmoji{}, errors.Wrap(err, "DecodeGIF")
+		}
+		data, err = shrinkGIF(anim)
+		if err != nil {
+			return GuildEmoji{}, err
+		}
+		emoji.Image = dataURI("image/gif", data)
+		return emoji, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return GuildEmoji{}, errors.Wrap(err, "DecodeImage")
+	}
+	data, err = shrinkImage(img)
+	if err != nil {
+		return GuildEmoji{}, err
+	}
+	emoji.Image = dataURI("image/png", data)
+	return emoji, nil
+}
+
+// fetchEmoji requests the image of a custom emoji
+func (s *Imager) fetchEmoji(uri string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "makeRequestCustomEmojiImage")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.botToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "requestCustomEmojiImage")
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("requestCustomEmojiImage: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func dataURI(contentType string, data []byte) string {
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// fit returns the size of the bounds scaled to fit in size pixels, never enlarged
+func fit(bounds image.Rectangle, size int) (uint, uint) {
+	var width, height = float64(bounds.Dx()), float64(bounds.Dy())
+	var ratio = math.Min(float64(size)/math.Max(width, height), 1)
+	return uint(math.Max(math.Floor(width*ratio), 1)), uint(math.Max(math.Floor(height*ratio), 1))
+}
+
+// shrinkImage encodes a still image as PNG in the largest size within the limits
+func shrinkImage(img image.Image) ([]byte, error) {
+	for _, size := range guildEmojiSizes {
+		var width, height = fit(img.Bounds(), size)
+		var resized = clampAlpha(resize.Resize(width, height, img, resize.Lanczos3))
+
+		var buf bytes.Buffer
+		err := png.Encode(&buf, resized)
+		if err != nil {
+			return nil, errors.Wrap(err, "EncodePNG")
+		}
+		if buf.Len() <= GuildEmojiMaxBytes {
+			return buf.Bytes(), nil
+		}
+	}
+	return nil, ErrorEmojiTooLarge
+}
+
+// shrinkGIF encodes an animation in the largest size within the limits.
+// When even the smallest size is too large, every other frame is dropped, keeping the total duration.
+func shrinkGIF(anim *gif.GIF) ([]byte, error) {
+	var frames = composeFrames(anim)
+	var delays = append([]int{}, anim.Delay...)
+
+	for {
+		for _, size := range guildEmojiSizes {
+			data, err := encodeFrames(frames, delays, anim.LoopCount, size)
+			if err != nil {
+				return nil, err
+			}
+			if len(data) <= GuildEmojiMaxBytes {
+				return data, nil
+			}
+		}
+
+		if len(frames) <= 1 {
+			return nil, ErrorEmojiTooLarge
+		}
+		frames, delays = thinFrames(frames, delays)
+	}
+}
+
+// composeFrames draws the frames of the animation over the previous ones as their disposal methods say,
+// so that each frame can be resized alone
+func composeFrames(anim *gif.GIF) []*image.RGBA {
+	var bounds = image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	if bounds.Empty() && len(anim.Image) > 0 {
+		bounds = anim.Image[0].Bounds()
+	}
+
+	var canvas = image.NewRGBA(bounds)
+	var frames = make([]*image.RGBA, len(anim.Image))
+
+	for i, frame := range anim.Image {
+		var previous *image.RGBA
+		var disposal byte
+		if i < len(anim.Disposal) {
+			disposal = anim.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			draw.Draw(previous, bounds, canvas, bounds.Min, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		frames[i] = image.NewRGBA(bounds)
+		draw.Draw(frames[i], bounds, canvas, bounds.Min, draw.Src)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return frames
+}
+
+// thinFrames drops every other frame, adding its delay to the previous one
+func thinFrames(frames []*image.RGBA, delays []int) ([]*image.RGBA, []int) {
+	var thinned = []*image.RGBA{}
+	var thinnedDelays = []int{}
+	for i, frame := range frames {
+		var delay int
+		if i < len(delays) {
+			delay = delays[i]
+		}
+		if i%2 == 0 {
+			thinned = append(thinned, frame)
+			thinnedDelays = append(thinnedDelays, delay)
+			continue
+		}
+		thinnedDelays[len(thinnedDelays)-1] += delay
+	}
+	return thinned, thinnedDelays
+}
+
+// encodeFrames resizes the whole frames and encodes them as a GIF, each frame replacing the previous one
+func encodeFrames(frames []*image.RGBA, delays []int, loopCount int, size int) ([]byte, error) {
+	var anim = &gif.GIF{LoopCount: loopCount}
+
+	for i, frame := range frames {
+		var width, height = fit(frame.Bounds(), size)
+		var resized = clampAlpha(resize.Resize(width, height, frame, resize.Lanczos3))
+
+		var paletted = image.NewPaletted(resized.Bounds(), colorPalette)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), resized, resized.Bounds().Min)
+
+		var delay int
+		if i < len(delays) {
+			delay = delays[i]
+		}
+
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+		anim.Config.Width, anim.Config.Height = int(width), int(height)
+	}
+
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, anim)
+	if err != nil {
+		return nil, errors.Wrap(err, "EncodeGIF")
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,157 @@
+package slack_emoji_imager
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+)
+
+// Theme is the color scheme of reaction images
+type Theme string
+
+const (
+	// ThemeLight draws black numbers on white
+	ThemeLight Theme = "light"
+	// ThemeDark draws white numbers on the background of the Discord dark theme
+	ThemeDark Theme = "dark"
+)
+
+// ReactorStyle is how the users who reacted are shown under each emoji
+type ReactorStyle string
+
+const (
+	// ReactorNone shows only the emoji and the number
+	ReactorNone ReactorStyle = ""
+	// ReactorNames shows the user names
+	ReactorNames ReactorStyle = "names"
+	// ReactorAvatars shows the user icons
+	ReactorAvatars ReactorStyle = "avatars"
+)
+
+// Options configures how reaction images are rendered
+type Options struct {
+	// Size is the size of an emoji in pixels
+	Size int `json:"Size,omitempty"`
+	// Columns is the number of reactions in a lane
+	Columns int   `json:"Columns,omitempty"`
+	Theme   Theme `json:"Theme,omitempty"`
+	// Transparent draws no background
+	Transparent bool `json:"Transparent,omitempty"`
+	// StaticPNG makes a PNG image instead of GIF when no reaction is animated
+	StaticPNG bool         `json:"StaticPNG,omitempty"`
+	Reactors  ReactorStyle `json:"Reactors,omitempty"`
+}
+
+// DefaultOptions are the options of the images made before they were configurable
+var DefaultOptions = Options{
+	Size:    reactionEmojiSize,
+	Columns: laneReactionNum,
+	Theme:   ThemeLight,
+}
+
+const (
+	minEmojiSize = 16
+	maxEmojiSize = 128
+	maxColumns   = 20
+
+	// maxReactorLines is the number of user names under an emoji, including the line of the rest
+	maxReactorLines = 3
+)
+
+// WithDefault fills the unset or invalid options with DefaultOptions
+func (o Options) WithDefault() Options {
+	if o.Size < minEmojiSize || o.Size > maxEmojiSize {
+		o.Size = DefaultOptions.Size
+	}
+	if o.Columns <= 0 || o.Columns > maxColumns {
+		o.Columns = DefaultOptions.Columns
+	}
+	if o.Theme != ThemeDark {
+		o.Theme = ThemeLight
+	}
+	if o.Reactors != ReactorNames && o.Reactors != ReactorAvatars {
+		o.Reactors = ReactorNone
+	}
+	return o
+}
+
+// layout is the sizes of the parts of a reaction image
+type layout struct {
+	Options
+
+	margin        int
+	numWidth      int
+	reactionWidth int
+	nameSize      int
+	avatarSize    int
+	reactorHeight int
+	laneHeight    int
+	lanes         int
+}
+
+func newLayout(options Options, reactions int) layout {
+	var l = layout{Options: options}
+
+	l.margin = options.Size / 10
+	l.numWidth = options.Size
+	l.reactionWidth = options.Size + l.numWidth + l.margin*2
+	l.nameSize = options.Size * 3 / 10
+	l.avatarSize = options.Size * 2 / 5
+
+	switch options.Reactors {
+	case ReactorNames:
+		l.reactorHeight = l.nameSize * 6 / 5 * maxReactorLines
+	case ReactorAvatars:
+		l.reactorHeight = l.avatarSize + l.margin
+	}
+
+	l.laneHeight = l.margin*2 + options.Size + l.reactorHeight
+	l.lanes = (reactions-1)/options.Columns + 1
+
+	return l
+}
+
+func (l layout) bounds() image.Rectangle {
+	return image.Rect(0, 0, l.reactionWidth*l.Columns, l.laneHeight*l.lanes)
+}
+
+// origin is the top left of the n-th reaction
+func (l layout) origin(n int) image.Point {
+	return image.Point{
+		X: l.reactionWidth * (n % l.Columns),
+		Y: l.laneHeight * (n / l.Columns),
+	}
+}
+
+// maxAvatars is the number of user icons in a row under an emoji
+func (l layout) maxAvatars() int {
+	return (l.reactionWidth - l.margin) / (l.avatarSize + l.margin)
+}
+
+func (l layout) background() color.Color {
+	switch {
+	case l.Transparent:
+		return image.Transparent
+	case l.Theme == ThemeDark:
+		return color.RGBA{0x36, 0x39, 0x3f, 0xff}
+	default:
+		return color.White
+	}
+}
+
+func (l layout) foreground() *image.Uniform {
+	if l.Theme == ThemeDark {
+		return image.White
+	}
+	return image.Black
+}
+
+// palette is the colors of GIF frames, which has the background color exactly
+func (l layout) palette() color.Palette {
+	var p = append(color.Palette{}, palette.WebSafe...)
+	p = append(p, image.Transparent)
+	if l.Theme == ThemeDark && !l.Transparent {
+		p = append(p, l.background())
+	}
+	return p
+}
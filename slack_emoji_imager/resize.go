@@ -1,47 +1,51 @@
 package slack_emoji_imager
 
 import (
-	"fmt"
 	"image"
-	"image/color"
 	"image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 	"math"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/kyokomi/emoji"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/emoji"
 	"github.com/nfnt/resize"
 	"github.com/pkg/errors"
 	"golang.org/x/image/draw"
 )
 
-func (s *Imager) resize(reaction slackReaction) (resizedReaction slackReaction, maxFrame int, err error) {
+// resize loads the emoji image of the reaction, fitting it in size pixels
+func (s *Imager) resize(reaction slackReaction, size int) (resizedReaction slackReaction, maxFrame int, err error) {
 	var uri = s.GetEmojiURI(reaction.Name)
 
-	switch {
-	case uri != "":
-		// custom emoji
-		req, err := http.NewRequest("GET", uri, nil)
-		if err != nil {
-			return reaction, 0, errors.Wrap(err, "makeRequestCustomEmojiImage")
+	if uri != "" {
+		if cached, ok := s.cache.get(uri, size); ok {
+			reaction.image = cached
+			return reaction, cached.frames(), nil
 		}
 
-		req.Header.Set("Authorization", "Bearer "+s.botToken)
+		defer func() {
+			if err == nil {
+				s.cache.put(uri, size, resizedReaction.image)
+			}
+		}()
+	}
 
-		resp, err := http.DefaultClient.Do(req)
+	switch {
+	case uri != "":
+		// custom emoji
+		body, err := s.fetchEmoji(uri)
 		if err != nil {
-			return reaction, 0, errors.Wrap(err, "requestCustomEmojiImage")
+			return reaction, 0, err
 		}
-		defer resp.Body.Close()
+		defer body.Close()
 
 		switch {
 		case strings.HasSuffix(uri, ".gif"):
 			// isGif
-			gifImage, err := gif.DecodeAll(resp.Body)
+			gifImage, err := gif.DecodeAll(body)
 			if err != nil {
 				return reaction, 0, errors.Wrap(err, "DecodeGif")
 			}
@@ -50,75 +54,45 @@ func (s *Imager) resize(reaction slackReaction) (resizedReaction slackReaction,
 				maxFrame = len(gifImage.Image)
 			}
 
-			reaction.image.converted = make([]*image.Paletted, len(gifImage.Image))
-			reaction.image.bounds = make([]image.Rectangle, len(gifImage.Image))
+			// frames may be only the parts changed from the previous ones, so they are resized as they are shown
+			var composed = composeFrames(gifImage)
 
 			reaction.image.isGif = true
-
-			var width, height = float64(gifImage.Config.Width), float64(gifImage.Config.Height)
-
-			var ratio float64
-			if width > height {
-				ratio = float64(reactionEmojiSize) / width
-			} else {
-				ratio = float64(reactionEmojiSize) / height
-			}
-
-			{
-				// First, get backgound color
-				var bColor color.Color
-				var haveBackgound bool
-
-				p, haveBackgound := gifImage.Config.ColorModel.(color.Palette)
-				if haveBackgound {
-					bColor = p[int(gifImage.BackgroundIndex)]
-					bColor = color.Palette(colorPalette).Convert(bColor)
-				}
-
-				// Then, resize GIF frames
-				var resizeGIF = func(fromFrame, toFrame int) {
-					for frameNum := fromFrame; frameNum < toFrame; frameNum++ {
-						var frame = gifImage.Image[frameNum]
-						var rect = frame.Bounds()
-						var tmpImage = frame.SubImage(rect)
-						var resizedImage = resize.Resize(
-							uint(math.Floor(float64(rect.Dx())*ratio)),
-							uint(math.Floor(float64(rect.Dy())*ratio)),
-							tmpImage, resize.Lanczos3,
-						)
-
-						var resizedBounds = resizedImage.Bounds()
-
-						marginX := int(math.Floor(float64(rect.Min.X) * ratio))
-						marginY := int(math.Floor(float64(rect.Min.Y) * ratio))
-
-						reaction.image.bounds[frameNum] = image.Rect(
-							marginX, marginY,
-							resizedBounds.Dx()+marginX,
-							resizedBounds.Dy()+marginY,
-						)
-
-						resizedPaletted := image.NewPaletted(reaction.image.bounds[frameNum], colorPalette)
-						if haveBackgound {
-							resizedPaletted.ColorModel().Convert(bColor)
-							resizedPaletted = s.fillFrame(resizedPaletted, bColor)
-						}
-
-						draw.FloydSteinberg.Draw(resizedPaletted, reaction.image.bounds[frameNum], resizedImage, image.Point{})
-						reaction.image.converted[frameNum] = resizedPaletted
+			reaction.image.converted = make([]*image.Paletted, len(composed))
+			reaction.image.bounds = make([]image.Rectangle, len(composed))
+			reaction.image.delays = make([]int, len(composed))
+			copy(reaction.image.delays, gifImage.Delay)
+
+			var resizeGIF = func(fromFrame, toFrame int) {
+				for frameNum := fromFrame; frameNum < toFrame; frameNum++ {
+					var frame = composed[frameNum]
+					var width, height = float64(frame.Bounds().Dx()), float64(frame.Bounds().Dy())
+
+					var ratio float64
+					if width > height {
+						ratio = float64(size) / width
+					} else {
+						ratio = float64(size) / height
 					}
-				}
 
-				s.paralleExec(len(gifImage.Image), resizeGIF)
+					var resizedImage = clampAlpha(resize.Resize(
+						uint(math.Floor(width*ratio)),
+						uint(math.Floor(height*ratio)),
+						frame, resize.Lanczos3,
+					))
+
+					var resizedPaletted = image.NewPaletted(resizedImage.Bounds(), colorPalette)
+					draw.FloydSteinberg.Draw(resizedPaletted, resizedPaletted.Bounds(), resizedImage, resizedImage.Bounds().Min)
 
-				gifImage.Delay = make([]int, maxFrame)
-				for i := range gifImage.Delay {
-					gifImage.Delay[i] = 4
+					reaction.image.converted[frameNum] = resizedPaletted
+					reaction.image.bounds[frameNum] = resizedPaletted.Bounds()
 				}
 			}
+
+			s.paralleExec(len(composed), resizeGIF)
 		default:
 			// resize png, jpg
-			srcImage, _, err := image.Decode(resp.Body)
+			srcImage, _, err := image.Decode(body)
 			if err != nil {
 				return reaction, 0, errors.Wrap(err, "DecodeImage")
 			}
@@ -127,18 +101,16 @@ func (s *Imager) resize(reaction slackReaction) (resizedReaction slackReaction,
 
 			var ratio float64
 			if width > height {
-				ratio = float64(reactionEmojiSize) / width
+				ratio = float64(size) / width
 			} else {
-				ratio = float64(reactionEmojiSize) / height
+				ratio = float64(size) / height
 			}
 			srcImage = resize.Resize(
 				uint(math.Floor(width*ratio)),
 				uint(math.Floor(height*ratio)),
 				srcImage, resize.Lanczos3,
 			)
-			resizedPaletted := image.NewPaletted(srcImage.Bounds(), colorPalette)
-			draw.FloydSteinberg.Draw(resizedPaletted, srcImage.Bounds(), srcImage, image.Point{})
-			reaction.image.other = resizedPaletted
+			reaction.image.other = clampAlpha(srcImage)
 
 			if 1 > maxFrame {
 				maxFrame = 1
@@ -147,16 +119,17 @@ func (s *Imager) resize(reaction slackReaction) (resizedReaction slackReaction,
 
 	case uri == "":
 		// default emoji
-		var emojiStr = emoji.Sprintf(":%s:", reaction.Name)
-		if emojiStr == fmt.Sprintf(":%s:", reaction.Name) {
+		unicode, ok := emoji.Unicode(reaction.Name)
+		if !ok {
 			// emoji not found
 			return reaction, 0, errors.New("DefaultEmojiNotFound")
 		}
 
-		var emojiRune = []rune(emojiStr)
-
-		var path = filepath.Join(emojiFilePath, fmt.Sprintf("emoji_u%x.png", emojiRune[0]))
-		fp, err := os.Open(path)
+		fp, err := os.Open(filepath.Join(s.emojiDir, emoji.FileName(unicode)))
+		if err != nil {
+			// fall back to the emoji without skin tone or ZWJ parts
+			fp, err = os.Open(filepath.Join(s.emojiDir, emoji.FileName(string([]rune(unicode)[0]))))
+		}
 		if err != nil {
 			return reaction, 0, errors.New("EmojiFileOpen")
 		}
@@ -171,9 +144,9 @@ func (s *Imager) resize(reaction slackReaction) (resizedReaction slackReaction,
 
 		var ratio float64
 		if width > height {
-			ratio = float64(reactionEmojiSize) / width
+			ratio = float64(size) / width
 		} else {
-			ratio = float64(reactionEmojiSize) / height
+			ratio = float64(size) / height
 		}
 		srcImage = resize.Resize(
 			uint(math.Floor(width*ratio)),
@@ -181,10 +154,7 @@ func (s *Imager) resize(reaction slackReaction) (resizedReaction slackReaction,
 			srcImage, resize.Lanczos3,
 		)
 
-		resizedPaletted := image.NewPaletted(srcImage.Bounds(), colorPalette)
-		draw.FloydSteinberg.Draw(resizedPaletted, srcImage.Bounds(), srcImage, image.Point{})
-
-		reaction.image.other = resizedPaletted
+		reaction.image.other = clampAlpha(srcImage)
 		if 1 > maxFrame {
 			maxFrame = 1
 		}
@@ -192,3 +162,28 @@ func (s *Imager) resize(reaction slackReaction) (resizedReaction slackReaction,
 
 	return reaction, maxFrame, nil
 }
+
+// clampAlpha fixes the pixels brighter than their alpha, which Lanczos resampling makes on the edges
+// and which are drawn in wrong colors
+func clampAlpha(img image.Image) image.Image {
+	switch img := img.(type) {
+	case *image.RGBA:
+		for i := 0; i < len(img.Pix); i += 4 {
+			for c := i; c < i+3; c++ {
+				if img.Pix[c] > img.Pix[i+3] {
+					img.Pix[c] = img.Pix[i+3]
+				}
+			}
+		}
+	case *image.RGBA64:
+		for i := 0; i < len(img.Pix); i += 8 {
+			var a = uint16(img.Pix[i+6])<<8 | uint16(img.Pix[i+7])
+			for c := i; c < i+6; c += 2 {
+				if uint16(img.Pix[c])<<8|uint16(img.Pix[c+1]) > a {
+					img.Pix[c], img.Pix[c+1] = img.Pix[i+6], img.Pix[i+7]
+				}
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,149 @@
+package slack_emoji_imager
+
+import "sort"
+
+// Times are in 1/100 seconds, the unit of GIF delays.
+const (
+	// defaultFrameDelay is the delay browsers use for the frames of no or too short delays
+	defaultFrameDelay = 10
+	// minFrameDelay is the shortest delay browsers respect
+	minFrameDelay = 2
+	// maxTimelineDuration limits the length of a reaction image which loops all the emoji together
+	maxTimelineDuration = 1000
+
+	// maxReactionFrames is the number of frames of a reaction image at most
+	maxReactionFrames = 100
+	// maxReactionImageBytes is the size of a reaction image which makes its frames halved
+	maxReactionImageBytes = 2 * 1024 * 1024
+)
+
+// frameDelay is the delay of the i-th frame as browsers show it
+func frameDelay(delays []int, i int) int {
+	if i >= len(delays) || delays[i] < minFrameDelay {
+		return defaultFrameDelay
+	}
+	return delays[i]
+}
+
+// duration is the time of a loop of the emoji, or 0 if it is still
+func (e emojiImage) duration() int {
+	if !e.isGif || len(e.converted) <= 1 {
+		return 0
+	}
+
+	var d int
+	for i := range e.converted {
+		d += frameDelay(e.delays, i)
+	}
+	return d
+}
+
+// frameAt is the index of the frame shown at the time, looping the animation
+func (e emojiImage) frameAt(t int) int {
+	var d = e.duration()
+	if d == 0 {
+		return 0
+	}
+
+	t %= d
+	for i := range e.converted {
+		t -= frameDelay(e.delays, i)
+		if t < 0 {
+			return i
+		}
+	}
+	return len(e.converted) - 1
+}
+
+// timeline is when the frames of a reaction image start, shared by all the emoji in it
+type timeline struct {
+	starts []int
+	// period is the length of the loop, or 0 for a still image
+	period int
+}
+
+// newTimeline puts the frame changes of all the emoji on a timeline which loops them together.
+// Changes closer than minFrameDelay are merged, and the rest are rounded to coarser steps until the frames are at most maxFrames.
+func newTimeline(images []emojiImage, maxFrames int) timeline {
+	var durations = []int{}
+	for _, img := range images {
+		if d := img.duration(); d > 0 {
+			durations = append(durations, d)
+		}
+	}
+	if len(durations) == 0 {
+		return timeline{starts: []int{0}}
+	}
+
+	// the longest emoji loops exactly when looping all of them would take too long
+	var period = durations[0]
+	var longest = durations[0]
+	for _, d := range durations[1:] {
+		period = lcm(period, d)
+		if d > longest {
+			longest = d
+		}
+		if period > maxTimelineDuration {
+			break
+		}
+	}
+	if period > maxTimelineDuration {
+		period = longest
+	}
+
+	var changes = []int{}
+	for _, img := range images {
+		var d = img.duration()
+		if d == 0 {
+			continue
+		}
+		for loop := 0; loop < period; loop += d {
+			var t = loop
+			for i := range img.converted {
+				if t >= period {
+					break
+				}
+				changes = append(changes, t)
+				t += frameDelay(img.delays, i)
+			}
+		}
+	}
+	sort.Ints(changes)
+
+	for step := 1; ; step++ {
+		var gap = step
+		if gap < minFrameDelay {
+			gap = minFrameDelay
+		}
+
+		var starts = []int{0}
+		for _, t := range changes {
+			if t = t / step * step; t-starts[len(starts)-1] >= gap {
+				starts = append(starts, t)
+			}
+		}
+		if len(starts) > 1 && period-starts[len(starts)-1] < gap {
+			starts = starts[:len(starts)-1]
+		}
+
+		if len(starts) <= maxFrames || step >= period {
+			return timeline{starts: starts, period: period}
+		}
+	}
+}
+
+// delay is the time the i-th frame is shown
+func (t timeline) delay(i int) int {
+	if i+1 < len(t.starts) {
+		return t.starts[i+1] - t.starts[i]
+	}
+	return t.period - t.starts[i]
+}
+
+func lcm(a, b int) int {
+	var x, y = a, b
+	for y != 0 {
+		x, y = y, x%y
+	}
+	return a / x * b
+}
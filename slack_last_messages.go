@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// SlackLastMessage is the voice status message posted on a Slack channel
+type SlackLastMessage struct {
+	TS             string `json:"ts"`
+	GuildID        string `json:"guild_id"`
+	DiscordChannel string `json:"discord_channel"`
+	SlackChannel   string `json:"slack_channel,omitempty"`
+}
+
+// Channel returns the Slack channel of the message.
+// The key is the channel for the messages saved before voice routes were introduced.
+func (m SlackLastMessage) Channel(key string) string {
+	if m.SlackChannel != "" {
+		return m.SlackChannel
+	}
+	return key
+}
+
+// SlackLastMessages keeps the voice status messages by VoiceTarget.Key and saves them on disk.
+// It is guarded by voiceChannels.Mutex.
+type SlackLastMessages struct {
+	path     string
+	messages map[string]SlackLastMessage
+}
+
+func LoadSlackLastMessages(path string) *SlackLastMessages {
+	var m = &SlackLastMessages{path: path, messages: map[string]SlackLastMessage{}}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("ReadSlackLastMessages: %s\n", err.Error())
+		}
+		return m
+	}
+
+	err = json.Unmarshal(b, &m.messages)
+	if err != nil {
+		log.Printf("ParseSlackLastMessages: %s\n", err.Error())
+		m.messages = map[string]SlackLastMessage{}
+	}
+
+	return m
+}
+
+func (m *SlackLastMessages) Get(slackChannel string) (SlackLastMessage, bool) {
+	message, ok := m.messages[slackChannel]
+	return message, ok
+}
+
+func (m *SlackLastMessages) Set(slackChannel string, message SlackLastMessage) {
+	m.messages[slackChannel] = message
+	m.save()
+}
+
+func (m *SlackLastMessages) Delete(slackChannel string) {
+	delete(m.messages, slackChannel)
+	m.save()
+}
+
+// Guild returns the messages about the guild by key
+func (m *SlackLastMessages) Guild(guildID string) map[string]SlackLastMessage {
+	var messages = map[string]SlackLastMessage{}
+	for channel, message := range m.messages {
+		if message.GuildID == guildID {
+			messages[channel] = message
+		}
+	}
+	return messages
+}
+
+func (m *SlackLastMessages) save() {
+	if m.path == "" {
+		return
+	}
+
+	b, err := json.Marshal(m.messages)
+	if err != nil {
+		log.Printf("EncodeSlackLastMessages: %s\n", err.Error())
+		return
+	}
+
+	err = ioutil.WriteFile(m.path, b, 0644)
+	if err != nil {
+		log.Printf("SaveSlackLastMessages: %s\n", err.Error())
+	}
+}
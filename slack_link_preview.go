@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_embed_maker"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
+)
+
+const slackPreviewColor = 0x4a154b
+
+var slackMessageLinkRegExp = regexp.MustCompile(
+	`https://[\w-]+(?:\.enterprise)?\.slack\.com/archives/([A-Z0-9]+)/p(\d{10})(\d{6})(?:\?[^\s>]*)?`,
+)
+
+// previewSlackLinks makes embeds of the Slack messages linked in content posted in the guild.
+// Links are rewritten to the Discord copies of the messages if they exist.
+func (d *DiscordHandler) previewSlackLinks(guildID, content string) (string, []*discordgo.MessageEmbed) {
+	var embeds = []*discordgo.MessageEmbed{}
+
+	for _, match := range slackMessageLinkRegExp.FindAllStringSubmatch(content, -1) {
+		var link, channel, ts = match[0], match[1], match[2] + "." + match[3]
+
+		var cs, mappedGuildID = d.settings.FindDiscordChannel(channel)
+		if cs.DiscordChannel == "" || cs.DiscordChannel == "all" || mappedGuildID != guildID {
+			// only messages of channels bridged with the guild can be shown
+			continue
+		}
+
+		message, err := d.slackHook.GetMessage(channel, ts)
+		if err != nil {
+			log.Printf("PreviewSlackLink: %s\n", err.Error())
+			continue
+		}
+		if message.TS != ts {
+			continue
+		}
+
+		embeds = append(embeds, d.slackMessageEmbed(link, message))
+
+		if jumpURL := d.discordCopyURL(guildID, channel, ts); jumpURL != "" {
+			content = strings.ReplaceAll(content, link, jumpURL)
+		}
+	}
+
+	return content, embeds
+}
+
+// discordCopyURL returns the URL of the Discord message
+// which is bridged with the Slack message, or an empty string
+func (d *DiscordHandler) discordCopyURL(guildID, channel, ts string) string {
+	link, ok := d.messageLinks.FindBySlack(channel, ts)
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, link.DiscordChannel, link.DiscordMessage)
+}
+
+func (d *DiscordHandler) slackMessageEmbed(link string, message *slack_webhook.Message) *discordgo.MessageEmbed {
+	var embed = &discordgo.MessageEmbed{
+		Type:        discordgo.EmbedTypeRich,
+		URL:         link,
+		Color:       slackPreviewColor,
+		Description: discord_embed_maker.ToMarkdown(trimDummyURI(message.Text), d.slackUserName),
+		Author:      &discordgo.MessageEmbedAuthor{Name: message.Username},
+		Footer:      &discordgo.MessageEmbedFooter{Text: "Slack"},
+	}
+
+	if message.User != "" {
+		user, err := d.slackHook.GetUserInfo(message.User)
+		if err == nil {
+			embed.Author.Name = user.Profile.DisplayName
+			if embed.Author.Name == "" {
+				embed.Author.Name = user.RealName
+			}
+			embed.Author.IconURL = user.Profile.Image72
+		}
+	}
+	if embed.Author.Name == "" {
+		embed.Author = nil
+	}
+
+	sec, err := strconv.ParseFloat(message.TS, 64)
+	if err == nil {
+		embed.Timestamp = time.Unix(int64(sec), 0).Format(time.RFC3339)
+	}
+
+	return embed
+}
+
+func (d *DiscordHandler) slackUserName(userID string) string {
+	user, err := d.slackHook.GetUserInfo(userID)
+	if err != nil {
+		return ""
+	}
+	if user.Profile.DisplayName != "" {
+		return user.Profile.DisplayName
+	}
+	return user.RealName
+}
+
+// trimDummyURI removes SlackMessageDummyURI from a Slack message text
+func trimDummyURI(text string) string {
+	return strings.TrimSpace(strings.Split(text, "<"+SlackMessageDummyURI)[0])
+}
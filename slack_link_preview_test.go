@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPreviewSlackLinksOfOtherGuild(t *testing.T) {
+	var settingsFile = SettingsFile
+	SettingsFile = filepath.Join(t.TempDir(), "settings.json")
+	defer func() { SettingsFile = settingsFile }()
+
+	var tables = []SlackDiscordTable{{
+		Discord: "guildB",
+		Channel: []ChannelSetting{{SlackChannel: "C0123", DiscordChannel: "channelB"}},
+	}}
+	b, err := json.Marshal(tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(SettingsFile, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var settings = NewSettingsHandler("", "")
+	// the channels are not fetched from Slack and Discord
+	settings.channelMap.lastUpdated = time.Now()
+
+	var d = NewDiscordBot("", settings)
+
+	// the Slack hook is not set, so the message must not be fetched
+	var content = "see https://kmc.slack.com/archives/C0123/p1617274800000100"
+	got, embeds := d.previewSlackLinks("guildA", content)
+	if got != content || len(embeds) != 0 {
+		t.Errorf("previewSlackLinks in another guild = %q with %d embeds, want the content as it is", got, len(embeds))
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
+)
+
+const SlackStatusDefaultEmoji = ":discord:"
+
+// SlackStatusUpdater sets the Slack status of linked users while they are in Discord voice channels.
+// Updates are applied one by one in order, out of the voice state lock.
+type SlackStatusUpdater struct {
+	links      *UserLinks
+	adminToken string
+	queue      chan slackStatusUpdate
+}
+
+type slackStatusUpdate struct {
+	discordUser string
+	channelName string // empty on leave
+}
+
+func NewSlackStatusUpdater(links *UserLinks, adminToken string) *SlackStatusUpdater {
+	var u = &SlackStatusUpdater{
+		links:      links,
+		adminToken: adminToken,
+		queue:      make(chan slackStatusUpdate, 100),
+	}
+	go u.run()
+	return u
+}
+
+// Join sets the status of the user who joined the voice channel
+func (u *SlackStatusUpdater) Join(discordUser, channelName string) {
+	u.enqueue(slackStatusUpdate{discordUser: discordUser, channelName: channelName})
+}
+
+// Leave clears the status of the user who left voice channels
+func (u *SlackStatusUpdater) Leave(discordUser string) {
+	u.enqueue(slackStatusUpdate{discordUser: discordUser})
+}
+
+func (u *SlackStatusUpdater) enqueue(update slackStatusUpdate) {
+	if u == nil {
+		return
+	}
+	link, ok := u.links.FindByDiscord(update.discordUser)
+	if !ok || !link.VoiceStatus {
+		return
+	}
+
+	select {
+	case u.queue <- update:
+	default:
+		log.Println("SlackStatus: queue is full")
+	}
+}
+
+func (u *SlackStatusUpdater) run() {
+	for update := range u.queue {
+		err := u.apply(update)
+		if err != nil {
+			log.Printf("SlackStatus: %s\n", err.Error())
+		}
+	}
+}
+
+func (u *SlackStatusUpdater) apply(update slackStatusUpdate) error {
+	link, ok := u.links.FindByDiscord(update.discordUser)
+	if !ok || !link.VoiceStatus {
+		return nil
+	}
+
+	// With the user's own token, the user must not be specified
+	var hook *slack_webhook.Handler
+	var userID string
+	if link.SlackToken != "" {
+		hook = slack_webhook.New(link.SlackToken)
+	} else if u.adminToken != "" {
+		hook = slack_webhook.New(u.adminToken)
+		userID = link.SlackUser
+	} else {
+		return fmt.Errorf("NoTokenForUser: %s", link.SlackUser)
+	}
+
+	if update.channelName != "" {
+		var emoji = link.StatusEmoji
+		if emoji == "" {
+			emoji = SlackStatusDefaultEmoji
+		}
+		return hook.SetUserStatus(userID, slack_webhook.UserStatus{
+			Text:  slackVoiceStatusText(update.channelName),
+			Emoji: emoji,
+		})
+	}
+
+	// Clear the status only if it is still the one set here
+	current, err := hook.GetUserStatus(userID)
+	if err != nil {
+		return err
+	}
+	if !isSlackVoiceStatusText(current.Text) {
+		return nil
+	}
+
+	return hook.SetUserStatus(userID, slack_webhook.UserStatus{})
+}
+
+func slackVoiceStatusText(channelName string) string {
+	return locale.Default().T("voice.status", channelName)
+}
+
+// isSlackVoiceStatusText reports whether the status was set here in any language
+func isSlackVoiceStatusText(text string) bool {
+	for _, format := range locale.Values("voice.status") {
+		var prefix = strings.SplitN(format, "%s", 2)[0]
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
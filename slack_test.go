@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_webhook"
+)
+
+func TestFullySent(t *testing.T) {
+	var sent = func(id string, attachments int) *discord_webhook.Message {
+		var message = &discord_webhook.Message{Message: &discordgo.Message{ID: id}}
+		for i := 0; i < attachments; i++ {
+			message.Attachments = append(message.Attachments, discord_webhook.Attachment{})
+		}
+		return message
+	}
+
+	var cases = []struct {
+		name           string
+		message        *discord_webhook.Message
+		downloadFailed bool
+		images         int
+		want           bool
+	}{
+		{"all images", sent("1", 2), false, 2, true},
+		{"text only", sent("1", 0), false, 0, true},
+		{"not sent", nil, false, 0, false},
+		{"no response", &discord_webhook.Message{}, false, 0, false},
+		{"no ID", sent("", 0), false, 0, false},
+		{"download failed", sent("1", 1), true, 1, false},
+		{"images missing", sent("1", 1), false, 2, false},
+	}
+
+	for _, c := range cases {
+		if got := fullySent(c.message, c.downloadFailed, c.images); got != c.want {
+			t.Errorf("%s: fullySent = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
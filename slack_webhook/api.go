@@ -0,0 +1,81 @@
+package slack_webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// get calls the Web API method with GET and decodes the response into out
+func (s *Handler) get(method string, value url.Values, out interface{}) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s?%s", SlackAPIEndpoint, method, value.Encode()), nil)
+	if err != nil {
+		return errors.Wrap(err, "Request")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	return s.do(req, out)
+}
+
+// do sends the request and decodes the response into out, if it is not nil
+func (s *Handler) do(req *http.Request, out interface{}) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Sending")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "ReadAll")
+	}
+
+	var responseAttr struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+
+	err = json.Unmarshal(body, &responseAttr)
+	if err != nil {
+		return errors.Wrapf(err, "DecodingJSON: %s", body)
+	}
+
+	if !responseAttr.OK {
+		return errors.New("SlackAPIError: " + responseAttr.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		return errors.Wrapf(err, "DecodingJSON: %s", body)
+	}
+
+	return nil
+}
+
+// post calls the Web API method with a JSON body and decodes the response into out, if it is not nil
+func (s *Handler) post(method string, body interface{}, out interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "EncodingJSON")
+	}
+
+	req, err := http.NewRequest("POST", SlackAPIEndpoint+"/"+method, bytes.NewBuffer(b))
+	if err != nil {
+		return errors.Wrap(err, "Request")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	return s.do(req, out)
+}
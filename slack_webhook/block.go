@@ -68,6 +68,13 @@ func DividerBlock() BlockBase {
 	return BlockBase{Type: "divider"}
 }
 
+func HeaderBlock(text string) BlockBase {
+	return BlockBase{
+		Type: "header",
+		Text: BlockElement{Type: "plain_text", Text: text},
+	}
+}
+
 func SectionBlock() BlockBase {
 	return BlockBase{Type: "section"}
 }
@@ -112,7 +119,7 @@ func (b BlockBase) MarshalJSON() ([]byte, error) {
 			Elements []BlockElement `json:"elements,omitempty"`
 		}
 		return json.Marshal(baseElem{b.Type, b.Elements})
-	case "section":
+	case "section", "header":
 		type baseText struct {
 			Type string       `json:"type"`
 			Text BlockElement `json:"text,omitempty"`
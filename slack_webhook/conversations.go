@@ -0,0 +1,81 @@
+package slack_webhook
+
+import (
+	"net/url"
+
+	"github.com/slack-go/slack"
+)
+
+// GetConversationInfo gets the channel
+func (s *Handler) GetConversationInfo(channelID string) (*slack.Channel, error) {
+	var value = make(url.Values)
+	value.Set("channel", channelID)
+
+	var responseAttr struct {
+		Channel slack.Channel `json:"channel"`
+	}
+
+	err := s.get("conversations.info", value, &responseAttr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &responseAttr.Channel, nil
+}
+
+// GetConversationMembers gets the IDs of the channel members, up to limit
+func (s *Handler) GetConversationMembers(channelID string, limit int) ([]string, error) {
+	var members = []string{}
+	var cursor string
+
+	for len(members) < limit {
+		var value = make(url.Values)
+		value.Set("channel", channelID)
+		value.Set("limit", "200")
+		if cursor != "" {
+			value.Set("cursor", cursor)
+		}
+
+		var responseAttr struct {
+			Members          []string `json:"members"`
+			ResponseMetadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+
+		err := s.get("conversations.members", value, &responseAttr)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, responseAttr.Members...)
+
+		cursor = responseAttr.ResponseMetadata.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+
+	if len(members) > limit {
+		members = members[:limit]
+	}
+
+	return members, nil
+}
+
+// GetUserPresence gets whether the user is "active" or "away"
+func (s *Handler) GetUserPresence(userID string) (string, error) {
+	var value = make(url.Values)
+	value.Set("user", userID)
+
+	var responseAttr struct {
+		Presence string `json:"presence"`
+	}
+
+	err := s.get("users.getPresence", value, &responseAttr)
+	if err != nil {
+		return "", err
+	}
+
+	return responseAttr.Presence, nil
+}
@@ -0,0 +1,59 @@
+package slack_webhook
+
+import (
+	"net/url"
+)
+
+// Reaction is a reaction on a message
+type Reaction struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Users []string `json:"users"`
+}
+
+// HasUser reports whether the user is one of the reactors
+func (r Reaction) HasUser(userID string) bool {
+	for _, user := range r.Users {
+		if user == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetReactions gets the reactions on the message
+func (s *Handler) GetReactions(channel, timestamp string) ([]Reaction, error) {
+	var value = make(url.Values)
+	value.Set("channel", channel)
+	value.Set("timestamp", timestamp)
+	value.Set("full", "true")
+
+	var responseAttr struct {
+		Message struct {
+			Reactions []Reaction `json:"reactions"`
+		} `json:"message"`
+	}
+
+	err := s.get("reactions.get", value, &responseAttr)
+	if err != nil {
+		return nil, err
+	}
+
+	return responseAttr.Message.Reactions, nil
+}
+
+// AddReaction adds the reaction to the message as the token owner
+func (s *Handler) AddReaction(channel, timestamp, name string) error {
+	return s.post("reactions.add", reactionParameters{channel, timestamp, name}, nil)
+}
+
+// RemoveReaction removes the reaction of the token owner from the message
+func (s *Handler) RemoveReaction(channel, timestamp, name string) error {
+	return s.post("reactions.remove", reactionParameters{channel, timestamp, name}, nil)
+}
+
+type reactionParameters struct {
+	Channel   string `json:"channel"`
+	Timestamp string `json:"timestamp"`
+	Name      string `json:"name"`
+}
@@ -32,6 +32,7 @@ type Message struct {
 	Attachments []Attachment `json:"attachments,omitempty"`
 
 	LinkNames bool   `json:"link_names,omitempty"`
+	User      string `json:"user,omitempty"`
 	Username  string `json:"username,omitempty"`
 	AsUser    bool   `json:"as_user,omitempty"`
 
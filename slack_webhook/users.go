@@ -0,0 +1,153 @@
+package slack_webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+)
+
+func (s *Handler) GetUserInfo(userID string) (*slack.User, error) {
+	var value = make(url.Values)
+	value.Set("user", userID)
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/users.info?%s", SlackAPIEndpoint, value.Encode()), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Request")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "Sending")
+	}
+	defer resp.Body.Close()
+
+	var responseAttr struct {
+		OK    bool       `json:"ok"`
+		Error string     `json:"error"`
+		User  slack.User `json:"user"`
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadAll")
+	}
+
+	err = json.Unmarshal(body, &responseAttr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DecodingJSON: %s", body)
+	}
+
+	if !responseAttr.OK {
+		return nil, errors.New("SlackAPIError: " + responseAttr.Error)
+	}
+
+	return &responseAttr.User, nil
+}
+
+// UserStatus is the custom status of a Slack user
+type UserStatus struct {
+	Text       string `json:"status_text"`
+	Emoji      string `json:"status_emoji"`
+	Expiration int64  `json:"status_expiration"`
+}
+
+// GetUserStatus gets the status of the user.
+// If userID is empty, the status of the token owner is returned.
+func (s *Handler) GetUserStatus(userID string) (UserStatus, error) {
+	var value = make(url.Values)
+	if userID != "" {
+		value.Set("user", userID)
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/users.profile.get?%s", SlackAPIEndpoint, value.Encode()), nil)
+	if err != nil {
+		return UserStatus{}, errors.Wrap(err, "Request")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return UserStatus{}, errors.Wrap(err, "Sending")
+	}
+	defer resp.Body.Close()
+
+	var responseAttr struct {
+		OK      bool       `json:"ok"`
+		Error   string     `json:"error"`
+		Profile UserStatus `json:"profile"`
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return UserStatus{}, errors.Wrap(err, "ReadAll")
+	}
+
+	err = json.Unmarshal(body, &responseAttr)
+	if err != nil {
+		return UserStatus{}, errors.Wrapf(err, "DecodingJSON: %s", body)
+	}
+
+	if !responseAttr.OK {
+		return UserStatus{}, errors.New("SlackAPIError: " + responseAttr.Error)
+	}
+
+	return responseAttr.Profile, nil
+}
+
+// SetUserStatus sets the status of the user.
+// userID can be specified only with an admin token; otherwise leave it empty.
+func (s *Handler) SetUserStatus(userID string, status UserStatus) error {
+	var requestAttr = struct {
+		User    string     `json:"user,omitempty"`
+		Profile UserStatus `json:"profile"`
+	}{userID, status}
+
+	b, err := json.Marshal(requestAttr)
+	if err != nil {
+		return errors.Wrap(err, "EncodingJSON")
+	}
+
+	req, err := http.NewRequest("POST", SlackAPIEndpoint+"/users.profile.set", bytes.NewBuffer(b))
+	if err != nil {
+		return errors.Wrap(err, "Request")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Sending")
+	}
+	defer resp.Body.Close()
+
+	var responseAttr struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "ReadAll")
+	}
+
+	err = json.Unmarshal(body, &responseAttr)
+	if err != nil {
+		return errors.Wrapf(err, "DecodingJSON: %s", body)
+	}
+
+	if !responseAttr.OK {
+		return errors.New("SlackAPIError: " + responseAttr.Error)
+	}
+
+	return nil
+}
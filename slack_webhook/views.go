@@ -0,0 +1,68 @@
+package slack_webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// View is a surface such as the App Home tab
+type View struct {
+	Type   string      `json:"type"`
+	Blocks []BlockBase `json:"blocks"`
+}
+
+func HomeView(blocks []BlockBase) View {
+	return View{Type: "home", Blocks: blocks}
+}
+
+// PublishView publishes the view to the user
+func (s *Handler) PublishView(userID string, view View) error {
+	var requestAttr = struct {
+		UserID string `json:"user_id"`
+		View   View   `json:"view"`
+	}{userID, view}
+
+	b, err := json.Marshal(requestAttr)
+	if err != nil {
+		return errors.Wrap(err, "EncodingJSON")
+	}
+
+	req, err := http.NewRequest("POST", SlackAPIEndpoint+"/views.publish", bytes.NewBuffer(b))
+	if err != nil {
+		return errors.Wrap(err, "Request")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Sending")
+	}
+	defer resp.Body.Close()
+
+	var responseAttr struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "ReadAll")
+	}
+
+	err = json.Unmarshal(body, &responseAttr)
+	if err != nil {
+		return errors.Wrapf(err, "DecodingJSON: %s", body)
+	}
+
+	if !responseAttr.OK {
+		return errors.New("SlackAPIError: " + responseAttr.Error)
+	}
+
+	return nil
+}
@@ -2,6 +2,8 @@ var Settings = [];
 
 class GuildSettings {
     constructor(guild_setting) {
+        // keep the settings which are not editable here, such as voice_routes
+        Object.assign(this, guild_setting)
         this.discord_server = guild_setting.discord_server
         this.channel = []
         for (let chan of guild_setting.channel) {
@@ -16,13 +18,24 @@ class ChannelSettings {
         this.discord = String(channel_setting.discord);
         this.comment = String(channel_setting.comment);
         if (channel_setting.setting) {
-            this.setting = {
+            // keep the settings which are not editable here
+            this.setting = Object.assign({}, channel_setting.setting, {
                 slack2discord: Boolean(channel_setting.setting.slack2discord),
                 discord2slack: Boolean(channel_setting.setting.discord2slack),
                 ShowChannelName: Boolean(channel_setting.setting.ShowChannelName),
                 SendMuteState: Boolean(channel_setting.setting.SendMuteState),
-                SendVoiceState: Boolean(channel_setting.setting.SendVoiceState)
-            }
+                SendVoiceState: Boolean(channel_setting.setting.SendVoiceState),
+                ReplyAsThread: Boolean(channel_setting.setting.ReplyAsThread),
+                SendVoiceSummary: Boolean(channel_setting.setting.SendVoiceSummary),
+                VoiceSummaryMinMinutes: Number(channel_setting.setting.VoiceSummaryMinMinutes) || 0,
+                SendStreamState: Boolean(channel_setting.setting.SendStreamState),
+                SendVideoState: Boolean(channel_setting.setting.SendVideoState),
+                SendStageState: Boolean(channel_setting.setting.SendStageState),
+                KeepDiscordOriginal: Boolean(channel_setting.setting.KeepDiscordOriginal),
+                KeepSlackOriginal: Boolean(channel_setting.setting.KeepSlackOriginal),
+                SlackToDiscordReactions: String(channel_setting.setting.SlackToDiscordReactions || ""),
+                DiscordToSlackReactions: String(channel_setting.setting.DiscordToSlackReactions || "")
+            })
         } else {
             this.setting = {}
         }
@@ -36,6 +49,16 @@ class ChannelSettings {
     set ShowChannelName(ok) { this.setting.ShowChannelName = Boolean(ok) }
     set SendVoiceState(ok) { this.setting.SendVoiceState = Boolean(ok) }
     set SendMuteState(ok) { this.setting.SendMuteState = Boolean(ok) }
+    set SendStreamState(ok) { this.setting.SendStreamState = Boolean(ok) }
+    set SendVideoState(ok) { this.setting.SendVideoState = Boolean(ok) }
+    set SendStageState(ok) { this.setting.SendStageState = Boolean(ok) }
+    set ReplyAsThread(ok) { this.setting.ReplyAsThread = Boolean(ok) }
+    set KeepDiscordOriginal(ok) { this.setting.KeepDiscordOriginal = Boolean(ok) }
+    set KeepSlackOriginal(ok) { this.setting.KeepSlackOriginal = Boolean(ok) }
+    set SlackToDiscordReactions(mode) { this.setting.SlackToDiscordReactions = String(mode) }
+    set DiscordToSlackReactions(mode) { this.setting.DiscordToSlackReactions = String(mode) }
+    set SendVoiceSummary(ok) { this.setting.SendVoiceSummary = Boolean(ok) }
+    set VoiceSummaryMinMinutes(minutes) { this.setting.VoiceSummaryMinMinutes = Math.max(0, parseInt(minutes) || 0) }
 
 
     get Comment() { return this.comment }
@@ -46,6 +69,16 @@ class ChannelSettings {
     get ShowChannelName() { return this.setting.ShowChannelName }
     get SendVoiceState() { return this.setting.SendVoiceState }
     get SendMuteState() { return this.setting.SendMuteState }
+    get SendStreamState() { return this.setting.SendStreamState }
+    get SendVideoState() { return this.setting.SendVideoState }
+    get SendStageState() { return this.setting.SendStageState }
+    get ReplyAsThread() { return this.setting.ReplyAsThread }
+    get KeepDiscordOriginal() { return this.setting.KeepDiscordOriginal }
+    get KeepSlackOriginal() { return this.setting.KeepSlackOriginal }
+    get SlackToDiscordReactions() { return this.setting.SlackToDiscordReactions || "image" }
+    get DiscordToSlackReactions() { return this.setting.DiscordToSlackReactions || "image" }
+    get SendVoiceSummary() { return this.setting.SendVoiceSummary }
+    get VoiceSummaryMinMinutes() { return this.setting.VoiceSummaryMinMinutes }
 
 }
 
@@ -566,11 +599,13 @@ const make_settings_list = async(guild_id, discord_channel_list, slack_channel_l
                     button.appendChild(span);
                 }
 
-                let mute_state = document.querySelector("#send-mute-state-" + index);
-                if (mute_state) {
-                    mute_state.disabled = setting.SendVoiceState == false;
-                    if (!setting.SendVoiceState) {
-                        mute_state.checked = false;
+                for (let state_id of ["send-mute-state-", "send-stream-state-", "send-video-state-", "send-stage-state-"]) {
+                    let state = document.querySelector("#" + state_id + index);
+                    if (state) {
+                        state.disabled = setting.SendVoiceState == false;
+                        if (!setting.SendVoiceState) {
+                            state.checked = false;
+                        }
                     }
                 }
             }
@@ -615,6 +650,41 @@ const make_settings_list = async(guild_id, discord_channel_list, slack_channel_l
 
         accordion_body.appendChild(mute_state_check);
 
+        // Stream, Video and Stage State
+        for (let [key, id, text] of [
+                ["SendStreamState", "send-stream-state-", "配信(Go Live)の開始／終了も通知"],
+                ["SendVideoState", "send-video-state-", "カメラのオン／オフも通知"],
+                ["SendStageState", "send-stage-state-", "ステージの登壇／降壇も通知"]
+            ]) {
+            let state_check = document.createElement("div");
+            state_check.className = "form-check";
+
+            let state_input = document.createElement("input");
+            state_input.className = "form-check-input";
+            state_input.type = "checkbox";
+            state_input.id = id + settings_index;
+
+            state_input.disabled = setting.SendVoiceState == false
+
+            if (setting[key]) {
+                state_input.checked = "checked"
+            }
+
+            state_input.onchange = (event) => {
+                setting[key] = event.target.checked == true
+            }
+
+            let state_input_label = document.createElement("label");
+            state_input_label.className = "form-check-label";
+            state_input_label.setAttribute("for", id + settings_index);
+            state_input_label.innerText = text;
+
+            state_check.appendChild(state_input);
+            state_check.appendChild(state_input_label);
+
+            accordion_body.appendChild(state_check);
+        }
+
         // Slack to Discord 
         let slack_to_discord_check = document.createElement("div");
         slack_to_discord_check.className = "form-check";
@@ -697,6 +767,179 @@ const make_settings_list = async(guild_id, discord_channel_list, slack_channel_l
 
         accordion_body.appendChild(add_channel_name_check);
 
+        // Reply as Thread
+        let reply_as_thread_check = document.createElement("div");
+        reply_as_thread_check.className = "form-check";
+
+        let reply_as_thread_input = document.createElement("input");
+        reply_as_thread_input.className = "form-check-input";
+        reply_as_thread_input.type = "checkbox";
+        reply_as_thread_input.id = "reply-as-thread-" + settings_index;
+
+        if (setting.ReplyAsThread) {
+            reply_as_thread_input.checked = "checked"
+        }
+
+        reply_as_thread_input.onchange = (event) => {
+            setting.ReplyAsThread = event.target.checked == true
+        }
+
+        let reply_as_thread_input_label = document.createElement("label");
+        reply_as_thread_input_label.className = "form-check-label";
+        reply_as_thread_input_label.setAttribute("for", "reply-as-thread-" + settings_index);
+        reply_as_thread_input_label.innerText = "Discordの返信をSlackのスレッドとして転送"
+
+        reply_as_thread_check.appendChild(reply_as_thread_input);
+        reply_as_thread_check.appendChild(reply_as_thread_input_label);
+
+        accordion_body.appendChild(reply_as_thread_check);
+
+        // Keep Discord Original
+        let keep_discord_original_check = document.createElement("div");
+        keep_discord_original_check.className = "form-check";
+
+        let keep_discord_original_input = document.createElement("input");
+        keep_discord_original_input.className = "form-check-input";
+        keep_discord_original_input.type = "checkbox";
+        keep_discord_original_input.id = "keep-discord-original-" + settings_index;
+
+        if (setting.KeepDiscordOriginal) {
+            keep_discord_original_input.checked = "checked"
+        }
+
+        keep_discord_original_input.onchange = (event) => {
+            setting.KeepDiscordOriginal = event.target.checked == true
+        }
+
+        let keep_discord_original_input_label = document.createElement("label");
+        keep_discord_original_input_label.className = "form-check-label";
+        keep_discord_original_input_label.setAttribute("for", "keep-discord-original-" + settings_index);
+        keep_discord_original_input_label.innerText = "Discordのメッセージを削除・再投稿せずにそのまま残す"
+
+        keep_discord_original_check.appendChild(keep_discord_original_input);
+        keep_discord_original_check.appendChild(keep_discord_original_input_label);
+
+        accordion_body.appendChild(keep_discord_original_check);
+
+        // Keep Slack Original
+        let keep_slack_original_check = document.createElement("div");
+        keep_slack_original_check.className = "form-check";
+
+        let keep_slack_original_input = document.createElement("input");
+        keep_slack_original_input.className = "form-check-input";
+        keep_slack_original_input.type = "checkbox";
+        keep_slack_original_input.id = "keep-slack-original-" + settings_index;
+
+        if (setting.KeepSlackOriginal) {
+            keep_slack_original_input.checked = "checked"
+        }
+
+        keep_slack_original_input.onchange = (event) => {
+            setting.KeepSlackOriginal = event.target.checked == true
+        }
+
+        let keep_slack_original_input_label = document.createElement("label");
+        keep_slack_original_input_label.className = "form-check-label";
+        keep_slack_original_input_label.setAttribute("for", "keep-slack-original-" + settings_index);
+        keep_slack_original_input_label.innerText = "Slackのメッセージを削除・再投稿せずにそのまま残す"
+
+        keep_slack_original_check.appendChild(keep_slack_original_input);
+        keep_slack_original_check.appendChild(keep_slack_original_input_label);
+
+        accordion_body.appendChild(keep_slack_original_check);
+
+        // Reaction Modes
+        for (let [key, id, text] of [
+                ["SlackToDiscordReactions", "slack-to-discord-reactions-", "Slack→Discordのリアクション"],
+                ["DiscordToSlackReactions", "discord-to-slack-reactions-", "Discord→Slackのリアクション"]
+            ]) {
+            let reaction_mode = document.createElement("div");
+            reaction_mode.className = "input-group input-group-sm my-1";
+
+            let reaction_mode_label = document.createElement("label");
+            reaction_mode_label.className = "input-group-text";
+            reaction_mode_label.setAttribute("for", id + settings_index);
+            reaction_mode_label.innerText = text
+
+            let reaction_mode_select = document.createElement("select");
+            reaction_mode_select.className = "form-select";
+            reaction_mode_select.id = id + settings_index;
+
+            for (let [value, name] of [
+                    ["off", "転送しない"],
+                    ["image", "画像・絵文字ブロック"],
+                    ["native", "実際のリアクション"],
+                    ["text", "テキストでまとめて表示"]
+                ]) {
+                let option = document.createElement("option")
+                option.value = value
+                option.innerText = name
+                if (setting[key] == value) {
+                    option.selected = true
+                }
+                reaction_mode_select.appendChild(option)
+            }
+
+            reaction_mode_select.onchange = (event) => {
+                setting[key] = event.target.value
+            }
+
+            reaction_mode.appendChild(reaction_mode_label);
+            reaction_mode.appendChild(reaction_mode_select);
+
+            accordion_body.appendChild(reaction_mode);
+        }
+
+        // VoiceSummary
+        let voice_summary_check = document.createElement("div");
+        voice_summary_check.className = "form-check";
+
+        let voice_summary_input = document.createElement("input");
+        voice_summary_input.className = "form-check-input";
+        voice_summary_input.type = "checkbox";
+        voice_summary_input.id = "send-voice-summary-" + settings_index;
+
+        if (setting.SendVoiceSummary) {
+            voice_summary_input.checked = "checked"
+        }
+
+        voice_summary_input.onchange = (event) => {
+            setting.SendVoiceSummary = event.target.checked == true
+        }
+
+        let voice_summary_input_label = document.createElement("label");
+        voice_summary_input_label.className = "form-check-label";
+        voice_summary_input_label.setAttribute("for", "send-voice-summary-" + settings_index);
+        voice_summary_input_label.innerText = "通話終了時にまとめを送信"
+
+        voice_summary_check.appendChild(voice_summary_input);
+        voice_summary_check.appendChild(voice_summary_input_label);
+
+        accordion_body.appendChild(voice_summary_check);
+
+        // VoiceSummaryMinMinutes
+        let voice_summary_min = document.createElement("div");
+        voice_summary_min.className = "input-group input-group-sm my-1";
+
+        let voice_summary_min_label = document.createElement("span");
+        voice_summary_min_label.className = "input-group-text";
+        voice_summary_min_label.innerText = "まとめを送る最短の通話時間(分)"
+
+        let voice_summary_min_input = document.createElement("input");
+        voice_summary_min_input.className = "form-control";
+        voice_summary_min_input.type = "number";
+        voice_summary_min_input.min = "0";
+        voice_summary_min_input.value = setting.VoiceSummaryMinMinutes || 0;
+
+        voice_summary_min_input.onchange = (event) => {
+            setting.VoiceSummaryMinMinutes = event.target.value
+        }
+
+        voice_summary_min.appendChild(voice_summary_min_label);
+        voice_summary_min.appendChild(voice_summary_min_input);
+
+        accordion_body.appendChild(voice_summary_min);
+
         accordion_collapse.appendChild(accordion_body);
         accordion_item.appendChild(accordion_collapse);
         accordion_div.appendChild(accordion_item);
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/discord_webhook"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_attachment_maker"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack/slackevents"
+)
+
+const unfurlContentLength = 1000
+
+var discordMessageLinkRegExp = regexp.MustCompile(
+	`^https://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/channels/(\d+)/(\d+)/(\d+)`,
+)
+
+func (s *SlackHandler) linkSharedHandle(ev *slackevents.LinkSharedEvent) {
+	var unfurls = slack_webhook.UnfURLs{}
+
+	for _, link := range ev.Links {
+		var match = discordMessageLinkRegExp.FindStringSubmatch(link.URL)
+		if len(match) < 4 {
+			continue
+		}
+
+		var guildID, channelID, messageID = match[1], match[2], match[3]
+		if !s.settings.HasGuild(guildID) {
+			continue
+		}
+
+		blocks, err := s.discordMessageBlocks(guildID, channelID, messageID)
+		if err != nil {
+			log.Printf("UnfurlDiscordMessage: %s\n", err.Error())
+			continue
+		}
+
+		unfurls[link.URL] = slack_webhook.UnfURL{Blocks: blocks}
+	}
+
+	if len(unfurls) == 0 {
+		return
+	}
+
+	err := s.hook.ChatUnfURL(slack_webhook.UnfURLsParameters{
+		Channel:   ev.Channel,
+		TimeStamp: ev.MessageTimeStamp,
+		UnfURLs:   unfurls,
+	})
+	if err != nil {
+		log.Printf("ChatUnfURL: %s\n", err.Error())
+	}
+}
+
+// discordMessageBlocks makes Slack blocks which show a Discord message
+func (s *SlackHandler) discordMessageBlocks(guildID, channelID, messageID string) ([]slack_webhook.BlockBase, error) {
+	message, err := s.discordHook.GetMessage(channelID, messageID)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetMessage")
+	}
+	if message.ID == "" || message.Author == nil {
+		return nil, fmt.Errorf("MessageNotFound")
+	}
+
+	channel, err := s.discordHook.GetChannel(channelID)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetChannel")
+	}
+	// the guild in the link is what decides the bridge, so a channel elsewhere must not be shown
+	if channel.GuildID != guildID {
+		return nil, fmt.Errorf("ChannelNotInGuild")
+	}
+
+	var blocks = []slack_webhook.BlockBase{
+		slack_webhook.ContextBlock(
+			slack_webhook.ImageElement(message.Author.AvatarURL(""), message.Author.Username),
+			slack_webhook.MrkdwnElement("*"+message.Author.Username+"*"),
+		),
+	}
+
+	var content = strings.TrimSpace(message.Content)
+	if content == "" && len(message.Embeds) > 0 && message.Embeds[0] != nil {
+		content = message.Embeds[0].Description
+	}
+	if content != "" {
+		var section = slack_webhook.SectionBlock()
+		section.Text = slack_webhook.MrkdwnElement(
+			truncateRunes(slack_attachment_maker.ToMrkdwn(content), unfurlContentLength),
+		)
+		blocks = append(blocks, section)
+	}
+
+	if imageURL, title := firstImage(message); imageURL != "" {
+		blocks = append(blocks, slack_webhook.ImageBlock(imageURL, title))
+	}
+
+	var footer = fmt.Sprintf("<https://discord.com/channels/%s/%s|#%s>", guildID, channelID, channel.Name)
+	if t, err := message.Timestamp.Parse(); err == nil {
+		footer += fmt.Sprintf(" | <!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), t.Format("2006-01-02 15:04"))
+	}
+	blocks = append(blocks, slack_webhook.ContextBlock(slack_webhook.MrkdwnElement(footer)))
+
+	return blocks, nil
+}
+
+// firstImage finds the first image of attachments or embeds of a Discord message
+func firstImage(message discordgo.Message) (imageURL, title string) {
+	for _, attach := range message.Attachments {
+		if attach == nil {
+			continue
+		}
+		if strings.HasPrefix(discord_webhook.FindContentType(attach.Filename), "image/") {
+			return attach.URL, attach.Filename
+		}
+	}
+	for _, embed := range message.Embeds {
+		if embed == nil {
+			continue
+		}
+		if embed.Image != nil {
+			return embed.Image.URL, embed.Title
+		}
+		if embed.Thumbnail != nil {
+			return embed.Thumbnail.URL, embed.Title
+		}
+	}
+	return "", ""
+}
+
+func truncateRunes(text string, max int) string {
+	var runes = []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
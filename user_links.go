@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UserLink links a Discord account to a Slack account
+type UserLink struct {
+	DiscordUser string `json:"discord_user"`
+	SlackUser   string `json:"slack_user"`
+
+	// SlackToken is the user token of the Slack user, used to set the status of the user.
+	// If empty, SLACK_API_USER_TOKEN is used as an admin token.
+	SlackToken string `json:"slack_token,omitempty"`
+
+	// VoiceStatus opts in to set the Slack status while in a Discord voice channel
+	VoiceStatus bool   `json:"voice_status"`
+	StatusEmoji string `json:"status_emoji,omitempty"`
+}
+
+// UserLinks stores user links on disk
+type UserLinks struct {
+	path  string
+	links []UserLink
+	mu    sync.RWMutex
+}
+
+func NewUserLinks(path string) *UserLinks {
+	var u = &UserLinks{path: path}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("ReadUserLinks: %s\n", err.Error())
+		}
+		return u
+	}
+
+	err = json.Unmarshal(b, &u.links)
+	if err != nil {
+		log.Printf("ParseUserLinks: %s\n", err.Error())
+	}
+
+	return u
+}
+
+// Set adds or replaces the link of the Discord user.
+// The old links of either of the users are all removed, so that each user has one link.
+func (u *UserLinks) Set(link UserLink) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var links = []UserLink{}
+	for _, old := range u.links {
+		if old.DiscordUser != link.DiscordUser && old.SlackUser != link.SlackUser {
+			links = append(links, old)
+		}
+	}
+	u.links = append(links, link)
+
+	u.save()
+}
+
+// Remove removes the link of the Discord user
+func (u *UserLinks) Remove(discordUser string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var links = []UserLink{}
+	for _, old := range u.links {
+		if old.DiscordUser != discordUser {
+			links = append(links, old)
+		}
+	}
+	u.links = links
+
+	u.save()
+}
+
+func (u *UserLinks) FindByDiscord(discordUser string) (UserLink, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	for _, link := range u.links {
+		if link.DiscordUser == discordUser {
+			return link, true
+		}
+	}
+	return UserLink{}, false
+}
+
+func (u *UserLinks) FindBySlack(slackUser string) (UserLink, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	for _, link := range u.links {
+		if link.SlackUser == slackUser {
+			return link, true
+		}
+	}
+	return UserLink{}, false
+}
+
+func (u *UserLinks) save() {
+	b, err := json.MarshalIndent(u.links, "", "  ")
+	if err != nil {
+		log.Printf("EncodeUserLinks: %s\n", err.Error())
+		return
+	}
+
+	err = ioutil.WriteFile(u.path, b, 0600)
+	if err != nil {
+		log.Printf("SaveUserLinks: %s\n", err.Error())
+	}
+}
+
+// LinkCodeExpiration is how long a link code is valid
+const LinkCodeExpiration = 10 * time.Minute
+
+// LinkCodeInterval is how long a user waits before another code is sent to the same account
+const LinkCodeInterval = time.Minute
+
+// ErrorLinkCodeTooSoon is returned when a code is requested again within LinkCodeInterval
+var ErrorLinkCodeTooSoon = errors.New("LinkCodeTooSoon")
+
+// LinkCodes keeps one-time codes to confirm a user owns both accounts before linking them
+type LinkCodes struct {
+	codes map[string]pendingLink
+	mu    sync.Mutex
+}
+
+type pendingLink struct {
+	link    UserLink
+	issued  time.Time
+	expires time.Time
+}
+
+func NewLinkCodes() *LinkCodes {
+	return &LinkCodes{codes: map[string]pendingLink{}}
+}
+
+// Issue makes a code for the link. The older codes of the users are replaced,
+// and a code is not issued again within LinkCodeInterval, not to spam the account with codes.
+func (l *LinkCodes) Issue(link UserLink) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for code, pending := range l.codes {
+		if time.Now().After(pending.expires) {
+			delete(l.codes, code)
+			continue
+		}
+		if pending.link.DiscordUser != link.DiscordUser && pending.link.SlackUser != link.SlackUser {
+			continue
+		}
+		if time.Since(pending.issued) < LinkCodeInterval {
+			return "", ErrorLinkCodeTooSoon
+		}
+		delete(l.codes, code)
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	var code = fmt.Sprintf("%06d", n.Int64())
+
+	l.codes[code] = pendingLink{link: link, issued: time.Now(), expires: time.Now().Add(LinkCodeExpiration)}
+	return code, nil
+}
+
+// Confirm consumes the code and returns the link.
+// match checks the link is confirmed by the right user.
+// After a wrong code, the codes of the user are invalidated, so that codes cannot be guessed.
+func (l *LinkCodes) Confirm(code string, match func(link UserLink) bool) (UserLink, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pending, ok := l.codes[code]
+	if ok && time.Now().Before(pending.expires) && match(pending.link) {
+		delete(l.codes, code)
+		return pending.link, true
+	}
+
+	delete(l.codes, code)
+	for c, pending := range l.codes {
+		if match(pending.link) {
+			delete(l.codes, c)
+		}
+	}
+	return UserLink{}, false
+}
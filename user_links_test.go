@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUserLinksSet(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "user_links.json")
+	var u = NewUserLinks(path)
+
+	// links of old files may have duplicates
+	u.links = []UserLink{
+		{DiscordUser: "d1", SlackUser: "s1"},
+		{DiscordUser: "d2", SlackUser: "s2"},
+		{DiscordUser: "d1", SlackUser: "s3"},
+		{DiscordUser: "d3", SlackUser: "s2"},
+	}
+
+	u.Set(UserLink{DiscordUser: "d1", SlackUser: "s2", VoiceStatus: true})
+
+	if len(u.links) != 1 {
+		t.Fatalf("links = %+v, want only the new link", u.links)
+	}
+	if link, ok := u.FindBySlack("s2"); !ok || link.DiscordUser != "d1" || !link.VoiceStatus {
+		t.Errorf("FindBySlack = %+v, %v, want the new link", link, ok)
+	}
+	for _, user := range []string{"d2", "d3"} {
+		if _, ok := u.FindByDiscord(user); ok {
+			t.Errorf("the old link of %s is left", user)
+		}
+	}
+
+	u.Set(UserLink{DiscordUser: "d4", SlackUser: "s4"})
+	u.Remove("d1")
+
+	var loaded = NewUserLinks(path)
+	if len(loaded.links) != 1 || loaded.links[0].DiscordUser != "d4" {
+		t.Errorf("saved links = %+v, want only d4", loaded.links)
+	}
+}
+
+func TestLinkCodes(t *testing.T) {
+	var l = NewLinkCodes()
+	var link = UserLink{DiscordUser: "d1", SlackUser: "s1"}
+
+	code, err := l.Issue(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Issue(UserLink{DiscordUser: "d1", SlackUser: "s2"}); err != ErrorLinkCodeTooSoon {
+		t.Errorf("Issue again = %v, want ErrorLinkCodeTooSoon", err)
+	}
+
+	var bySlackUser = func(link UserLink) bool {
+		return link.SlackUser == "s1"
+	}
+
+	// a wrong code invalidates the code of the user
+	var wrong = "000000"
+	if wrong == code {
+		wrong = "000001"
+	}
+	if _, ok := l.Confirm(wrong, bySlackUser); ok {
+		t.Fatalf("Confirm of a wrong code succeeded")
+	}
+	if _, ok := l.Confirm(code, bySlackUser); ok {
+		t.Errorf("Confirm after a wrong code succeeded")
+	}
+
+	l = NewLinkCodes()
+	code, _ = l.Issue(link)
+	if confirmed, ok := l.Confirm(code, bySlackUser); !ok || confirmed != link {
+		t.Errorf("Confirm = %+v, %v, want %+v", confirmed, ok, link)
+	}
+	if _, ok := l.Confirm(code, bySlackUser); ok {
+		t.Errorf("Confirm of a used code succeeded")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
+)
+
+// now is replaced in tests
+var now = time.Now
+
+// VoiceSession is a record of a call, from the first member joins until the channel empties
+type VoiceSession struct {
+	GuildID      string              `json:"guild_id"`
+	ChannelID    string              `json:"channel_id"`
+	ChannelName  string              `json:"channel_name"`
+	Start        time.Time           `json:"start"`
+	End          time.Time           `json:"end"`
+	PeakUsers    int                 `json:"peak_users"`
+	Participants []*VoiceParticipant `json:"participants"`
+}
+
+type VoiceParticipant struct {
+	UserID  string        `json:"user_id"`
+	Name    string        `json:"name"`
+	Periods []VoicePeriod `json:"periods"`
+}
+
+type VoicePeriod struct {
+	Join  time.Time `json:"join"`
+	Leave time.Time `json:"leave"`
+}
+
+func NewVoiceSession(channel *discordgo.Channel) *VoiceSession {
+	return &VoiceSession{
+		GuildID:     channel.GuildID,
+		ChannelID:   channel.ID,
+		ChannelName: channel.Name,
+		Start:       now(),
+	}
+}
+
+// Join records a member joined. users is the number of members in the channel.
+func (s *VoiceSession) Join(member *discordgo.Member, users int) {
+	var name = member.Nick
+	if name == "" {
+		name = member.User.Username
+	}
+
+	var participant = s.participant(member.User.ID)
+	if participant == nil {
+		participant = &VoiceParticipant{UserID: member.User.ID}
+		s.Participants = append(s.Participants, participant)
+	}
+	participant.Name = name
+	participant.Periods = append(participant.Periods, VoicePeriod{Join: now()})
+
+	if users > s.PeakUsers {
+		s.PeakUsers = users
+	}
+}
+
+// Leave records a member left
+func (s *VoiceSession) Leave(userID string) {
+	var participant = s.participant(userID)
+	if participant == nil || len(participant.Periods) == 0 {
+		return
+	}
+
+	var last = &participant.Periods[len(participant.Periods)-1]
+	if last.Leave.IsZero() {
+		last.Leave = now()
+	}
+}
+
+// Finish closes the session and periods of remaining members
+func (s *VoiceSession) Finish() {
+	s.End = now()
+	for _, participant := range s.Participants {
+		s.Leave(participant.UserID)
+	}
+}
+
+func (s *VoiceSession) Duration() time.Duration {
+	if s.End.IsZero() {
+		return now().Sub(s.Start)
+	}
+	return s.End.Sub(s.Start)
+}
+
+// Duration returns the total time the participant was in the channel
+func (p *VoiceParticipant) Duration() time.Duration {
+	var total time.Duration
+	for _, period := range p.Periods {
+		var leave = period.Leave
+		if leave.IsZero() {
+			leave = now()
+		}
+		total += leave.Sub(period.Join)
+	}
+	return total
+}
+
+func (s *VoiceSession) participant(userID string) *VoiceParticipant {
+	for _, participant := range s.Participants {
+		if participant.UserID == userID {
+			return participant
+		}
+	}
+	return nil
+}
+
+// SlackBlocks makes the summary of the session
+func (s *VoiceSession) SlackBlocks(lc *locale.Catalog) []slack_webhook.BlockBase {
+	var participants = make([]*VoiceParticipant, len(s.Participants))
+	copy(participants, s.Participants)
+	sort.SliceStable(participants, func(i, j int) bool {
+		return participants[i].Duration() > participants[j].Duration()
+	})
+
+	var lines = []string{}
+	for _, participant := range participants {
+		lines = append(lines, fmt.Sprintf("%s (%s)", participant.Name, formatDuration(participant.Duration(), lc)))
+	}
+
+	var title = slack_webhook.SectionBlock()
+	title.Text = slack_webhook.MrkdwnElement(lc.T(
+		"voice.summary.title", s.GuildID, s.ChannelID, s.ChannelName,
+	))
+
+	var detail = slack_webhook.SectionBlock()
+	detail.Text = slack_webhook.MrkdwnElement(lc.T(
+		"voice.summary.detail",
+		formatDuration(s.Duration(), lc), s.PeakUsers, strings.Join(lines, "\n"),
+	))
+
+	return []slack_webhook.BlockBase{title, detail, slack_webhook.DividerBlock()}
+}
+
+func formatDuration(d time.Duration, lc *locale.Catalog) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return lc.T("duration.under_minute")
+	}
+	if d < time.Hour {
+		return lc.T("duration.minutes", int(d.Minutes()))
+	}
+	return lc.T("duration.hours", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// VoiceSessionStore saves finished sessions on disk as JSON lines
+type VoiceSessionStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewVoiceSessionStore(path string) *VoiceSessionStore {
+	return &VoiceSessionStore{path: path}
+}
+
+func (v *VoiceSessionStore) Add(session *VoiceSession) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	b, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	fp, err := os.OpenFile(v.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	_, err = fp.Write(append(b, '\n'))
+	return err
+}
+
+// Sessions returns sessions of the guild started after since.
+// If channelID is empty, sessions of all channels are returned.
+func (v *VoiceSessionStore) Sessions(guildID, channelID string, since time.Time) ([]VoiceSession, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fp, err := os.Open(v.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fp.Close()
+
+	var sessions = []VoiceSession{}
+
+	var scanner = bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var session VoiceSession
+		err := json.Unmarshal(scanner.Bytes(), &session)
+		if err != nil {
+			log.Printf("ParseVoiceSession: %s\n", err.Error())
+			continue
+		}
+		if session.GuildID != guildID || session.Start.Before(since) {
+			continue
+		}
+		if channelID != "" && session.ChannelID != channelID {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, scanner.Err()
+}
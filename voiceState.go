@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
 	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
 )
 
@@ -20,17 +21,78 @@ type DiscordVoiceChannels struct {
 
 type VoiceChannels struct {
 	Channels map[string]*VoiceChannel
+
+	// FinishedSessions holds sessions of channels which became empty
+	FinishedSessions []*VoiceSession
 }
 
 type VoiceChannel struct {
 	Users   map[string]*VoiceState
 	Channel *discordgo.Channel
+	Session *VoiceSession
 }
 
 type VoiceState struct {
 	Muted    bool
 	Deafened bool
 	Member   *discordgo.Member
+
+	ServerMuted    bool
+	ServerDeafened bool
+	Streaming      bool
+	Video          bool
+	Suppressed     bool
+	Speaker        bool
+}
+
+// channelTypeGuildStageVoice is the stage channel type, which discordgo does not define yet
+const channelTypeGuildStageVoice discordgo.ChannelType = 13
+
+// GatewayVoiceState is the voice state sent by the gateway, including the fields discordgo lacks
+type GatewayVoiceState struct {
+	discordgo.VoiceState
+	SelfStream bool `json:"self_stream"`
+	SelfVideo  bool `json:"self_video"`
+}
+
+// VoiceStateChange is a set of changed kinds of a voice state
+type VoiceStateChange int
+
+const (
+	VoiceMuteChanged VoiceStateChange = 1 << iota
+	VoiceStreamChanged
+	VoiceVideoChanged
+	VoiceStageChanged
+)
+
+// VoiceIndicators are the emoji shown beside user names
+type VoiceIndicators struct {
+	Muted          string `json:"Muted,omitempty"`
+	Deafened       string `json:"Deafened,omitempty"`
+	ServerMuted    string `json:"ServerMuted,omitempty"`
+	ServerDeafened string `json:"ServerDeafened,omitempty"`
+	Streaming      string `json:"Streaming,omitempty"`
+	Video          string `json:"Video,omitempty"`
+	Suppressed     string `json:"Suppressed,omitempty"`
+	Speaker        string `json:"Speaker,omitempty"`
+}
+
+// WithDefault fills empty indicators with the ones of the locale
+func (i VoiceIndicators) WithDefault(lc *locale.Catalog) VoiceIndicators {
+	var fill = func(s *string, key string) {
+		if *s == "" {
+			*s = lc.T(key)
+		}
+	}
+	fill(&i.Muted, "voice.indicator.muted")
+	fill(&i.Deafened, "voice.indicator.deafened")
+	fill(&i.ServerMuted, "voice.indicator.server_muted")
+	fill(&i.ServerDeafened, "voice.indicator.server_deafened")
+	fill(&i.Streaming, "voice.indicator.streaming")
+	fill(&i.Video, "voice.indicator.video")
+	fill(&i.Suppressed, "voice.indicator.suppressed")
+	fill(&i.Speaker, "voice.indicator.speaker")
+	return i
 }
 
 // Join returns already user exits
@@ -54,9 +116,22 @@ func (v *VoiceChannels) Join(channel *discordgo.Channel, member *discordgo.Membe
 			v.Leave(member.User.ID)
 		}
 	}
-	v.Channels[channel.ID].Users[member.User.ID] = &VoiceState{
-		Muted: false, Deafened: false, Member: member,
+	if exists {
+		v.Channels[channel.ID].Users[member.User.ID].Member = member
+	} else {
+		v.Channels[channel.ID].Users[member.User.ID] = &VoiceState{
+			Muted: false, Deafened: false, Member: member,
+		}
+	}
+
+	if !exists {
+		var voiceChannel = v.Channels[channel.ID]
+		if voiceChannel.Session == nil {
+			voiceChannel.Session = NewVoiceSession(channel)
+		}
+		voiceChannel.Session.Join(member, len(voiceChannel.Users))
 	}
+
 	return exists
 }
 
@@ -68,10 +143,48 @@ func (v *VoiceChannels) Leave(userID string) {
 		_, ok := channel.Users[userID]
 		if ok {
 			delete(channel.Users, userID)
+
+			if channel.Session == nil {
+				continue
+			}
+			channel.Session.Leave(userID)
+			if len(channel.Users) == 0 {
+				channel.Session.Finish()
+				v.FinishedSessions = append(v.FinishedSessions, channel.Session)
+				channel.Session = nil
+			}
 		}
 	}
 }
 
+// Filter returns the channels which satisfy f
+func (v *VoiceChannels) Filter(f func(channel *discordgo.Channel) bool) *VoiceChannels {
+	var filtered = &VoiceChannels{Channels: map[string]*VoiceChannel{}}
+	for id, channel := range v.Channels {
+		if f(channel.Channel) {
+			filtered.Channels[id] = channel
+		}
+	}
+	return filtered
+}
+
+// Occupied reports whether someone is in any of the channels
+func (v *VoiceChannels) Occupied() bool {
+	for _, channel := range v.Channels {
+		if len(channel.Users) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// PopFinishedSessions returns finished sessions and clears them
+func (v *VoiceChannels) PopFinishedSessions() []*VoiceSession {
+	var sessions = v.FinishedSessions
+	v.FinishedSessions = nil
+	return sessions
+}
+
 func (v *VoiceChannels) FindChannelHasUser(userID string) (string, bool) {
 	if v == nil || v.Channels == nil {
 		v.Channels = map[string]*VoiceChannel{}
@@ -85,6 +198,50 @@ func (v *VoiceChannels) FindChannelHasUser(userID string) (string, bool) {
 	return "", false
 }
 
+// SetState applies the voice state of a user and returns what has changed
+func (v *VoiceChannels) SetState(vs *GatewayVoiceState) VoiceStateChange {
+	if v == nil || v.Channels == nil {
+		v.Channels = map[string]*VoiceChannel{}
+	}
+
+	var change VoiceStateChange
+	for _, channel := range v.Channels {
+		user, ok := channel.Users[vs.UserID]
+		if !ok {
+			continue
+		}
+
+		var next = *user
+		next.Deafened = vs.SelfDeaf || vs.Deaf
+		next.Muted = vs.SelfMute || vs.Mute || next.Deafened
+		next.ServerDeafened = vs.Deaf
+		next.ServerMuted = vs.Mute
+		next.Streaming = vs.SelfStream
+		next.Video = vs.SelfVideo
+		// On stage channels, the audience is suppressed, so only speakers are marked
+		var stage = channel.Channel.Type == channelTypeGuildStageVoice
+		next.Suppressed = vs.Suppress && !stage
+		next.Speaker = stage && !vs.Suppress
+
+		if next.Muted != user.Muted || next.Deafened != user.Deafened ||
+			next.ServerMuted != user.ServerMuted || next.ServerDeafened != user.ServerDeafened {
+			change |= VoiceMuteChanged
+		}
+		if next.Streaming != user.Streaming {
+			change |= VoiceStreamChanged
+		}
+		if next.Video != user.Video {
+			change |= VoiceVideoChanged
+		}
+		if next.Suppressed != user.Suppressed || next.Speaker != user.Speaker {
+			change |= VoiceStageChanged
+		}
+
+		*user = next
+	}
+	return change
+}
+
 func (v *VoiceChannels) Muted(userID string) {
 	if v == nil || v.Channels == nil {
 		v.Channels = map[string]*VoiceChannel{}
@@ -111,7 +268,7 @@ func (v *VoiceChannels) Deafened(userID string) {
 	}
 }
 
-func (v VoiceChannels) SlackBlocksMultiChannel() ([]slack_webhook.BlockBase, error) {
+func (v VoiceChannels) SlackBlocksMultiChannel(indicators VoiceIndicators, lc *locale.Catalog) ([]slack_webhook.BlockBase, error) {
 	var blocks = []slack_webhook.BlockBase{}
 
 	for _, channel := range v.Channels {
@@ -119,18 +276,20 @@ func (v VoiceChannels) SlackBlocksMultiChannel() ([]slack_webhook.BlockBase, err
 			// skip no user channels
 			continue
 		}
-		var channelBlocks = channel.SlackBlocksSingleChannel()
+		var channelBlocks = channel.SlackBlocksSingleChannel(indicators, lc)
 		blocks = append(blocks, channelBlocks...)
 	}
 	if len(blocks) <= 1 {
-		element := slack_webhook.MrkdwnElement("誰もいない")
+		element := slack_webhook.MrkdwnElement(lc.T("voice.nobody"))
 		var block = slack_webhook.ContextBlock(element)
 		blocks = append(blocks, block)
 	}
 	return blocks, nil
 }
 
-func (c VoiceChannel) SlackBlocksSingleChannel() []slack_webhook.BlockBase {
+func (c VoiceChannel) SlackBlocksSingleChannel(indicators VoiceIndicators, lc *locale.Catalog) []slack_webhook.BlockBase {
+	indicators = indicators.WithDefault(lc)
+
 	var blocks = []slack_webhook.BlockBase{}
 
 	channelText := fmt.Sprintf("<https://discord.com/channels/%s|%s: >", c.Channel.GuildID, c.Channel.Name)
@@ -172,15 +331,7 @@ func (c VoiceChannel) SlackBlocksSingleChannel() []slack_webhook.BlockBase {
 
 		var imageElm = slack_webhook.ImageElement(userImage, username)
 
-		emoji := ""
-		if user.Muted {
-			emoji = ":discord_muted:"
-		}
-		if user.Deafened {
-			emoji = ":discord_deafened:"
-		}
-
-		text := fmt.Sprintf("%s%s ", emoji, username)
+		text := fmt.Sprintf("%s%s ", user.Indicator(indicators), username)
 		var userElm = slack_webhook.MrkdwnElement(text)
 
 		elements = append(elements, imageElm, userElm)
@@ -203,3 +354,31 @@ func (c VoiceChannel) SlackBlocksSingleChannel() []slack_webhook.BlockBase {
 
 	return blocks
 }
+
+// Indicator returns the emoji which represent the state
+func (user VoiceState) Indicator(indicators VoiceIndicators) string {
+	emoji := ""
+	switch {
+	case user.ServerDeafened:
+		emoji = indicators.ServerDeafened
+	case user.Deafened:
+		emoji = indicators.Deafened
+	case user.ServerMuted:
+		emoji = indicators.ServerMuted
+	case user.Muted:
+		emoji = indicators.Muted
+	}
+
+	if user.Speaker {
+		emoji += indicators.Speaker
+	} else if user.Suppressed {
+		emoji += indicators.Suppressed
+	}
+	if user.Streaming {
+		emoji += indicators.Streaming
+	}
+	if user.Video {
+		emoji += indicators.Video
+	}
+	return emoji
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/locale"
 )
 
 func TestVoiceState(t *testing.T) {
@@ -33,21 +36,21 @@ func TestVoiceState(t *testing.T) {
 		t.Fatalf("Expected channelID %s, but got %s", channelID1, channel)
 	}
 
-	block, err := voiceChannels.SlackBlocksMultiChannel()
+	block, err := voiceChannels.SlackBlocksMultiChannel(VoiceIndicators{}, locale.Default())
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Logf("%s", block)
+	t.Logf("%v", block)
 
 	voiceChannels.Muted(memberID1)
 	if !voiceChannels.Channels[channelID1].Users[memberID1].Muted {
 		t.Fatal("Expected the user is muted")
 	}
-	block, err = voiceChannels.SlackBlocksMultiChannel()
+	block, err = voiceChannels.SlackBlocksMultiChannel(VoiceIndicators{}, locale.Default())
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Logf("%s", block)
+	t.Logf("%v", block)
 
 	exists = voiceChannels.Join(channel1, member1)
 	if !exists {
@@ -57,11 +60,11 @@ func TestVoiceState(t *testing.T) {
 	if !voiceChannels.Channels[channelID1].Users[memberID1].Deafened {
 		t.Fatal("Expected the user is deafened")
 	}
-	block, err = voiceChannels.SlackBlocksMultiChannel()
+	block, err = voiceChannels.SlackBlocksMultiChannel(VoiceIndicators{}, locale.Default())
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Logf("%s", block)
+	t.Logf("%v", block)
 
 	voiceChannels.Join(channel1, member1)
 	voiceChannels.Leave(memberID1)
@@ -69,9 +72,98 @@ func TestVoiceState(t *testing.T) {
 		t.Fatalf("Expected 0 user in voice channel, But %v",
 			voiceChannels.Channels[channelID1].Users)
 	}
-	block, err = voiceChannels.SlackBlocksMultiChannel()
+	block, err = voiceChannels.SlackBlocksMultiChannel(VoiceIndicators{}, locale.Default())
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Logf("%s", block)
+	t.Logf("%v", block)
+}
+
+func TestVoiceSession(t *testing.T) {
+	var current = time.Date(2021, 4, 1, 20, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	voiceChannels := VoiceChannels{}
+
+	member1 := &discordgo.Member{User: &discordgo.User{ID: "wass80", Username: "user80"}}
+	member2 := &discordgo.Member{User: &discordgo.User{ID: "wass81", Username: "user81"}, Nick: "nick81"}
+	channel1 := &discordgo.Channel{ID: "general", GuildID: "guild", Name: "一般"}
+
+	voiceChannels.Join(channel1, member1)
+	current = current.Add(10 * time.Minute)
+	voiceChannels.Join(channel1, member2)
+	current = current.Add(20 * time.Minute)
+	voiceChannels.Leave("wass81")
+	if sessions := voiceChannels.PopFinishedSessions(); len(sessions) != 0 {
+		t.Fatalf("Expected no finished session, but got %d", len(sessions))
+	}
+	current = current.Add(30 * time.Minute)
+	voiceChannels.Leave("wass80")
+
+	sessions := voiceChannels.PopFinishedSessions()
+	if len(sessions) != 1 {
+		t.Fatalf("Expected 1 finished session, but got %d", len(sessions))
+	}
+	session := sessions[0]
+	if session.Duration() != time.Hour {
+		t.Fatalf("Expected the session lasts 1h, but %s", session.Duration())
+	}
+	if session.PeakUsers != 2 {
+		t.Fatalf("Expected peak 2 users, but %d", session.PeakUsers)
+	}
+	if d := session.participant("wass81").Duration(); d != 20*time.Minute {
+		t.Fatalf("Expected nick81 stayed 20m, but %s", d)
+	}
+	if voiceChannels.Channels["general"].Session != nil {
+		t.Fatal("Expected the session is cleared")
+	}
+
+	store := NewVoiceSessionStore(filepath.Join(t.TempDir(), "voice_sessions.jsonl"))
+	if err := store.Add(session); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.Sessions("guild", "", current.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].PeakUsers != 2 || len(stored[0].Participants) != 2 {
+		t.Fatalf("Unexpected stored sessions %v", stored)
+	}
+
+	t.Logf("%v", session.SlackBlocks(locale.Default()))
+}
+
+func TestVoiceStateChange(t *testing.T) {
+	voiceChannels := VoiceChannels{}
+
+	member1 := &discordgo.Member{User: &discordgo.User{ID: "wass80", Username: "user80"}}
+	stage := &discordgo.Channel{ID: "stage", Name: "ステージ", Type: channelTypeGuildStageVoice}
+
+	voiceChannels.Join(stage, member1)
+
+	var vs = &GatewayVoiceState{VoiceState: discordgo.VoiceState{UserID: "wass80", ChannelID: "stage", Suppress: true}}
+	if change := voiceChannels.SetState(vs); change != 0 {
+		t.Fatalf("Expected no change for an audience, but %b", change)
+	}
+
+	vs.Suppress = false
+	vs.SelfStream = true
+	change := voiceChannels.SetState(vs)
+	if change != VoiceStreamChanged|VoiceStageChanged {
+		t.Fatalf("Expected stream and stage changed, but %b", change)
+	}
+
+	user := voiceChannels.Channels["stage"].Users["wass80"]
+	if !user.Speaker || !user.Streaming {
+		t.Fatalf("Expected the user is a streaming speaker, but %+v", user)
+	}
+	if indicator := user.Indicator(VoiceIndicators{}.WithDefault(locale.Get("en"))); indicator != ":microphone::red_circle:" {
+		t.Fatalf("Unexpected indicator %s", indicator)
+	}
+
+	var setting = SendSetting{SendMuteState: true}
+	if setting.SendsVoiceStateChange(change) {
+		t.Fatal("Expected the change is not sent only with SendMuteState")
+	}
 }
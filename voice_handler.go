@@ -0,0 +1,483 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/kmc-jp/DiscordSlackSynchronizer/slack_webhook"
+	"github.com/pkg/errors"
+)
+
+type VoiceEvent int
+
+const (
+	VoiceLeft         VoiceEvent = iota
+	VoiceStateChanged VoiceEvent = iota
+	VoiceEntered      VoiceEvent = iota
+	VoiceRestored     VoiceEvent = iota
+)
+
+// VoiceTarget is a Slack channel where voice events are notified and how
+type VoiceTarget struct {
+	// Key identifies the live board message
+	Key          string
+	SlackChannel string
+
+	// DiscordChannel is "all", a voice channel or a category shown on the board
+	DiscordChannel string
+	// Single shows the board of just one voice channel
+	Single bool
+
+	Style   VoiceStyle
+	Setting SendSetting
+}
+
+// Shows reports whether the channel is shown on the board
+func (t VoiceTarget) Shows(channel *discordgo.Channel) bool {
+	return t.DiscordChannel == "all" || channel.ID == t.DiscordChannel || channel.ParentID == t.DiscordChannel
+}
+
+// voiceTargets returns where the events of the voice channel are notified.
+// Voice routes take precedence over the channel settings.
+func (d *DiscordHandler) voiceTargets(guildID string, channel *discordgo.Channel) []VoiceTarget {
+	var targets = []VoiceTarget{}
+
+	routes := d.settings.FindVoiceRoutes(guildID, channel.ID, channel.ParentID)
+	if len(routes) > 0 {
+		for _, route := range routes {
+			var style = route.Style
+			if style == "" {
+				style = VoiceStyleBoard
+			}
+			targets = append(targets, VoiceTarget{
+				Key:            route.Slack + "/" + route.Discord,
+				SlackChannel:   route.Slack,
+				DiscordChannel: route.Discord,
+				Single:         route.Discord == channel.ID,
+				Style:          style,
+				Setting:        route.Setting,
+			})
+		}
+		return targets
+	}
+
+	setting := d.settings.FindSlackChannel(channel.ID, guildID)
+	if setting.SlackChannel == "" {
+		return targets
+	}
+
+	var style VoiceStyle
+	switch {
+	case setting.Setting.SendVoiceState:
+		style = VoiceStyleBoard
+	case setting.Setting.SendVoiceSummary:
+		style = VoiceStyleSummary
+	default:
+		return targets
+	}
+
+	return append(targets, VoiceTarget{
+		Key:            setting.SlackChannel,
+		SlackChannel:   setting.SlackChannel,
+		DiscordChannel: setting.DiscordChannel,
+		Single:         setting.DiscordChannel != "all",
+		Style:          style,
+		Setting:        setting.Setting,
+	})
+}
+
+// gatewayEvent handles the voice states and the interactions with the raw data,
+// because discordgo drops some fields of them or does not know them
+func (d *DiscordHandler) gatewayEvent(s *discordgo.Session, e *discordgo.Event) {
+	switch e.Type {
+	case "VOICE_STATE_UPDATE":
+		var vs GatewayVoiceState
+		err := json.Unmarshal(e.RawData, &vs)
+		if err != nil {
+			log.Printf("ParseVoiceState: %s\n", err.Error())
+			return
+		}
+		d.voiceState(s, &vs)
+	case "GUILD_CREATE":
+		g, ok := e.Struct.(*discordgo.GuildCreate)
+		if !ok {
+			return
+		}
+		var raw struct {
+			VoiceStates []*GatewayVoiceState `json:"voice_states"`
+		}
+		err := json.Unmarshal(e.RawData, &raw)
+		if err != nil {
+			log.Printf("ParseGuild: %s\n", err.Error())
+			return
+		}
+		d.restoreVoiceState(s, g, raw.VoiceStates)
+
+		if d.settings.HasGuild(g.ID) {
+			err = d.registerCommands(s, g.ID)
+			if err != nil {
+				log.Printf("RegisterCommands: %s\n", err.Error())
+			}
+		}
+	case "INTERACTION_CREATE":
+		var i Interaction
+		err := json.Unmarshal(e.RawData, &i)
+		if err != nil {
+			log.Printf("ParseInteraction: %s\n", err.Error())
+			return
+		}
+		d.interactionCreate(s, &i)
+	}
+}
+
+func (d *DiscordHandler) voiceState(s *discordgo.Session, vs *GatewayVoiceState) {
+	voiceChannels.Mutex.Lock()
+	defer voiceChannels.Mutex.Unlock()
+
+	if vs.UserID == s.State.User.ID {
+		return
+	}
+
+	channel, e := s.State.Channel(vs.VoiceState.ChannelID)
+
+	if voiceChannels.Guilds[vs.GuildID] == nil {
+		voiceChannels.Guilds[vs.GuildID] = &VoiceChannels{}
+	}
+
+	channels := voiceChannels.Guilds[vs.GuildID]
+
+	// The channel where the user has been
+	var previous *discordgo.Channel
+	var previousState *VoiceState
+	if id, ok := channels.FindChannelHasUser(vs.UserID); ok {
+		previous = channels.Channels[id].Channel
+		previousState = channels.Channels[id].Users[vs.UserID]
+	}
+
+	if e != nil || vs.ChannelID == "" { // If the channel is missing, the user has left
+		if previous == nil {
+			return
+		}
+		channels.Leave(vs.UserID)
+		if d.settings.HasGuild(vs.GuildID) {
+			d.slackStatus.Leave(vs.UserID)
+		}
+		d.notifyVoice(vs.GuildID, channels, previous, previousState, VoiceLeft)
+	} else { // User joind or State changed
+		mem, err := s.GuildMember(vs.GuildID, vs.UserID)
+		if err != nil {
+			fmt.Printf("Failed to get info of a member: %v\n", err)
+			return
+		}
+		exists := channels.Join(channel, mem)
+		change := channels.SetState(vs)
+		user := channels.Channels[channel.ID].Users[vs.UserID]
+
+		if !exists {
+			if previous != nil { // User changed channels
+				d.notifyVoice(vs.GuildID, channels, previous, previousState, VoiceLeft)
+			}
+			// the status shows only the voice channels of the guilds bridged with Slack
+			if d.settings.HasGuild(vs.GuildID) {
+				d.slackStatus.Join(vs.UserID, channel.Name)
+			}
+			d.notifyVoice(vs.GuildID, channels, channel, user, VoiceEntered)
+		} else {
+			for _, target := range d.voiceTargets(vs.GuildID, channel) {
+				if target.Setting.SendsVoiceStateChange(change) {
+					d.sendVoiceState(vs.GuildID, target, channels, channel, user, VoiceStateChanged)
+				}
+			}
+		}
+	}
+
+	for _, session := range channels.PopFinishedSessions() {
+		d.finishVoiceSession(session)
+	}
+
+	d.appHome.Refresh()
+}
+
+func (d *DiscordHandler) notifyVoice(guildID string, channels *VoiceChannels, channel *discordgo.Channel, user *VoiceState, event VoiceEvent) {
+	for _, target := range d.voiceTargets(guildID, channel) {
+		d.sendVoiceState(guildID, target, channels, channel, user, event)
+	}
+}
+
+// restoreVoiceState rebuilds the voice channels from the guild state sent on connecting,
+// and updates or replaces the status messages posted before the restart.
+func (d *DiscordHandler) restoreVoiceState(s *discordgo.Session, g *discordgo.GuildCreate, states []*GatewayVoiceState) {
+	if !d.settings.HasGuild(g.ID) {
+		return
+	}
+
+	voiceChannels.Mutex.Lock()
+	defer voiceChannels.Mutex.Unlock()
+
+	if voiceChannels.Guilds[g.ID] == nil {
+		voiceChannels.Guilds[g.ID] = &VoiceChannels{}
+	}
+
+	channels := voiceChannels.Guilds[g.ID]
+
+	var connected = map[string]bool{}
+	for _, vs := range states {
+		if vs.UserID == s.State.User.ID || vs.ChannelID == "" {
+			continue
+		}
+
+		channel, err := s.State.Channel(vs.ChannelID)
+		if err != nil {
+			continue
+		}
+
+		mem, err := s.State.Member(g.ID, vs.UserID)
+		if err != nil {
+			mem, err = s.GuildMember(g.ID, vs.UserID)
+			if err != nil {
+				fmt.Printf("Failed to get info of a member: %v\n", err)
+				continue
+			}
+		}
+
+		if !channels.Join(channel, mem) {
+			d.slackStatus.Join(vs.UserID, channel.Name)
+		}
+		channels.SetState(vs)
+		connected[vs.UserID] = true
+	}
+
+	// Users who left while the bot was disconnected
+	for _, channel := range channels.Channels {
+		for userID := range channel.Users {
+			if !connected[userID] {
+				channels.Leave(userID)
+				d.slackStatus.Leave(userID)
+			}
+		}
+	}
+
+	for _, session := range channels.PopFinishedSessions() {
+		d.finishVoiceSession(session)
+	}
+
+	var targets = map[string]VoiceTarget{}
+	for _, channel := range channels.Channels {
+		if len(channel.Users) == 0 {
+			continue
+		}
+		for _, target := range d.voiceTargets(g.ID, channel.Channel) {
+			if target.Style == VoiceStyleBoard {
+				targets[target.Key] = target
+			}
+		}
+	}
+
+	for key, last := range d.slackLastMessages.Guild(g.ID) {
+		if _, ok := targets[key]; ok {
+			continue
+		}
+		// Nobody is in the channel any more
+		d.slackLastMessages.Delete(key)
+		d.slackHook.Remove(last.Channel(key), last.TS)
+	}
+
+	for _, target := range targets {
+		d.updateVoiceBoard(g.ID, target, channels, VoiceRestored)
+	}
+
+	d.appHome.Refresh()
+}
+
+// finishVoiceSession stores the session and posts its summary
+func (d *DiscordHandler) finishVoiceSession(session *VoiceSession) {
+	if d.voiceSessions != nil {
+		err := d.voiceSessions.Add(session)
+		if err != nil {
+			log.Printf("SaveVoiceSession: %s\n", err.Error())
+		}
+	}
+
+	channel, err := d.Session.State.Channel(session.ChannelID)
+	if err != nil {
+		channel = &discordgo.Channel{ID: session.ChannelID, GuildID: session.GuildID, Name: session.ChannelName}
+	}
+
+	var lc = d.settings.Locale(session.GuildID)
+	var sent = map[string]bool{}
+	for _, target := range d.voiceTargets(session.GuildID, channel) {
+		if target.Style != VoiceStyleSummary && !target.Setting.SendVoiceSummary {
+			continue
+		}
+		if sent[target.SlackChannel] {
+			continue
+		}
+		if session.Duration() < time.Duration(target.Setting.VoiceSummaryMinMinutes)*time.Minute {
+			continue
+		}
+
+		var message = slack_webhook.Message{
+			Channel:     target.SlackChannel,
+			Username:    lc.T("voice.bot_name"),
+			IconEmoji:   "discord",
+			UnfurlLinks: false,
+			UnfurlMedia: false,
+			Blocks:      session.SlackBlocks(lc),
+		}
+
+		_, err := d.slackHook.Send(message)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		sent[target.SlackChannel] = true
+	}
+}
+
+func (d *DiscordHandler) sendVoiceState(guildID string, target VoiceTarget, channels *VoiceChannels, channel *discordgo.Channel, user *VoiceState, event VoiceEvent) {
+	if target.SlackChannel == "" {
+		return
+	}
+
+	switch target.Style {
+	case VoiceStyleBoard:
+		d.updateVoiceBoard(guildID, target, channels, event)
+	case VoiceStyleLog:
+		d.sendVoiceLog(target, channel, user, event)
+	}
+}
+
+// updateVoiceBoard posts, updates or removes the live board
+func (d *DiscordHandler) updateVoiceBoard(guildID string, target VoiceTarget, channels *VoiceChannels, event VoiceEvent) {
+	var board = channels.Filter(target.Shows)
+	var lc = d.settings.Locale(guildID)
+
+	if !board.Occupied() {
+		old, ok := d.slackLastMessages.Get(target.Key)
+		if !ok {
+			return
+		}
+		d.slackLastMessages.Delete(target.Key)
+
+		d.slackHook.Remove(old.Channel(target.Key), old.TS)
+		return
+	}
+
+	var blocks []slack_webhook.BlockBase
+	var err error
+	if target.Single {
+		channel, ok := board.Channels[target.DiscordChannel]
+		if !ok {
+			log.Println("Failed to find channel")
+			return
+		}
+		blocks = channel.SlackBlocksSingleChannel(target.Setting.VoiceIndicators, lc)
+	} else {
+		blocks, err = board.SlackBlocksMultiChannel(target.Setting.VoiceIndicators, lc)
+		if err != nil {
+			fmt.Printf("%v\n", errors.Wrapf(err, "Failed SlackBlocks"))
+			return
+		}
+	}
+
+	var message = slack_webhook.Message{
+		Channel:     target.SlackChannel,
+		Username:    lc.T("voice.bot_name"),
+		IconEmoji:   "discord",
+		UnfurlLinks: false,
+		UnfurlMedia: false,
+		Blocks:      blocks,
+	}
+
+	var last = SlackLastMessage{GuildID: guildID, DiscordChannel: target.DiscordChannel, SlackChannel: target.SlackChannel}
+
+	switch event {
+	case VoiceEntered:
+		old, ok := d.slackLastMessages.Get(target.Key)
+		if ok {
+			d.slackHook.Remove(old.Channel(target.Key), old.TS)
+		}
+
+		last.TS, err = d.slackHook.Send(message)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		d.slackLastMessages.Set(target.Key, last)
+	case VoiceLeft, VoiceStateChanged, VoiceRestored:
+		old, ok := d.slackLastMessages.Get(target.Key)
+		if ok {
+			message.TS = old.TS
+			last.TS, err = d.slackHook.Update(message)
+			if err == nil {
+				d.slackLastMessages.Set(target.Key, last)
+				return
+			}
+			log.Println(err)
+			if event != VoiceRestored {
+				return
+			}
+
+			// The previous message has gone, so post it again
+			d.slackHook.Remove(old.Channel(target.Key), old.TS)
+			message.TS = ""
+		}
+
+		last.TS, err = d.slackHook.Send(message)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		d.slackLastMessages.Set(target.Key, last)
+	}
+}
+
+// sendVoiceLog posts a line for a user joined or left
+func (d *DiscordHandler) sendVoiceLog(target VoiceTarget, channel *discordgo.Channel, user *VoiceState, event VoiceEvent) {
+	if user == nil || user.Member == nil {
+		return
+	}
+
+	var key string
+	switch event {
+	case VoiceEntered:
+		key = "voice.joined"
+	case VoiceLeft:
+		key = "voice.left"
+	default:
+		return
+	}
+
+	var username = user.Member.Nick
+	if username == "" {
+		username = user.Member.User.Username
+	}
+
+	var lc = d.settings.Locale(channel.GuildID)
+	var text = lc.T(key, username, channel.GuildID, channel.ID, channel.Name)
+
+	var message = slack_webhook.Message{
+		Channel:     target.SlackChannel,
+		Username:    lc.T("voice.bot_name"),
+		IconEmoji:   "discord",
+		Text:        text,
+		UnfurlLinks: false,
+		UnfurlMedia: false,
+		Blocks: []slack_webhook.BlockBase{
+			slack_webhook.ContextBlock(
+				slack_webhook.ImageElement(user.Member.User.AvatarURL(""), username),
+				slack_webhook.MrkdwnElement(text),
+			),
+		},
+	}
+
+	_, err := d.slackHook.Send(message)
+	if err != nil {
+		log.Println(err)
+	}
+}